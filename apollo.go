@@ -28,7 +28,7 @@ func initApollo() {
 	cfg := new(apolloConfig)
 
 	if err := node.Unmarshal(cfg); err != nil {
-		logger.Error("yiigo: apollo init error", zap.Error(err))
+		logger().Error("yiigo: apollo init error", zap.Error(err))
 
 		return
 	}
@@ -42,7 +42,7 @@ func initApollo() {
 		AccesskeySecret:    cfg.AccesskeySecret,
 		InsecureSkipVerify: cfg.InsecureSkipVerify,
 	}); err != nil {
-		logger.Error("yiigo: apollo init error", zap.Error(err))
+		logger().Error("yiigo: apollo init error", zap.Error(err))
 
 		return
 	}
@@ -53,5 +53,5 @@ func initApollo() {
 
 	env.withApollo(cfg.Namespace)
 
-	logger.Info("yiigo: apollo is OK.")
+	logger().Info("yiigo: apollo is OK.")
 }
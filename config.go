@@ -0,0 +1,132 @@
+package yiigo
+
+import "github.com/pelletier/go-toml"
+
+// Config the config of resources, it's the counterpart of yiigo.toml, eg: to init without the config file (see Init).
+// The keys of maps are the names of resources, eg: AsDefault.
+type Config struct {
+	// Debug the app.debug
+	Debug  bool
+	Logger map[string]LoggerConfig
+	DB     map[string]DBConfig
+	Mongo  map[string]MongoConfig
+	Redis  map[string]RedisPoolConfig
+	EMail  map[string]EMailConfig
+}
+
+// Init registers the resources of cfg in order (logger, db, mongodb, redis and email) the same as yiigo.toml,
+// including the verification (eg: redis PING), the first error is returned.
+func Init(cfg *Config) error {
+	setDebug(cfg.Debug)
+
+	for _, fn := range cfg.inits() {
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// inits returns the init functions of modules in order.
+func (c *Config) inits() []func() error {
+	return []func() error{
+		func() error { return initLoggerConfigs(c.Logger) },
+		func() error { return initDBConfigs(c.DB) },
+		func() error { return initMongoConfigs(c.Mongo) },
+		func() error { return initRedisConfigs(c.Redis) },
+		func() error { return initEMailConfigs(c.EMail) },
+	}
+}
+
+// initConfig registers the resources of yiigo.toml, it's a thin layer of Init,
+// the failed modules are reported to the error handler (see SetErrorHandler), or panic.
+func initConfig() {
+	// all the problems are reported at once, instead of the first one of each module
+	if err := ValidateConfig(); err != nil {
+		handleInitError(&initError{module: "config", err: err})
+
+		return
+	}
+
+	cfg := envConfig(handleInitError)
+
+	for _, fn := range cfg.inits() {
+		if err := fn(); err != nil {
+			handleInitError(err)
+		}
+	}
+}
+
+// envConfig returns the config of yiigo.toml, the modules failed to unmarshal are reported to fn and left empty.
+func envConfig(fn func(err error)) *Config {
+	cfg := &Config{Debug: Env("app.debug").Bool(false)}
+
+	var err error
+
+	if cfg.Logger, err = envLoggerConfigs(); err != nil {
+		fn(err)
+	}
+
+	if cfg.DB, err = envDBConfigs(); err != nil {
+		fn(err)
+	}
+
+	if cfg.Mongo, err = envMongoConfigs(); err != nil {
+		fn(err)
+	}
+
+	if cfg.Redis, err = envRedisConfigs(); err != nil {
+		fn(err)
+	}
+
+	if cfg.EMail, err = envEMailConfigs(); err != nil {
+		fn(err)
+	}
+
+	return cfg
+}
+
+// initEnvConfig validates the loaded config (see ValidateConfig), and inits the resources of it by Init.
+func initEnvConfig() error {
+	if err := ValidateConfig(); err != nil {
+		return err
+	}
+
+	var err error
+
+	cfg := envConfig(func(e error) {
+		if err == nil {
+			err = e
+		}
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return Init(cfg)
+}
+
+// envSection calls fn with the named tables of the section in yiigo.toml in order.
+func envSection(section string, fn func(name string, node *toml.Tree) error) error {
+	tree, ok := env.get(section).(*toml.Tree)
+
+	if !ok {
+		return nil
+	}
+
+	for _, v := range tree.Keys() {
+		node, ok := tree.Get(v).(*toml.Tree)
+
+		if !ok {
+			continue
+		}
+
+		if err := fn(v, node); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
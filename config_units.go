@@ -0,0 +1,180 @@
+package yiigo
+
+import (
+	"encoding"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Duration the duration of config, it's parsed from the duration string (eg: "10s", "1m30s", "250ms"),
+// or the integer in seconds for backward compatibility.
+type Duration time.Duration
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (d *Duration) UnmarshalText(text []byte) error {
+	s := strings.TrimSpace(string(text))
+
+	if s == "" {
+		*d = 0
+
+		return nil
+	}
+
+	// the legacy seconds
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		*d = Duration(time.Duration(i) * time.Second)
+
+		return nil
+	}
+
+	v, err := time.ParseDuration(s)
+
+	if err != nil {
+		return fmt.Errorf("invalid duration %q, expects eg: 10s, 1m30s, 250ms or the seconds", s)
+	}
+
+	*d = Duration(v)
+
+	return nil
+}
+
+// Duration returns the time.Duration.
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// ByteSize the size of config in bytes, it's parsed from the size string (eg: "64MB", "1GiB", "512K"),
+// or the integer in MB for backward compatibility. The units are binary, eg: both 1MB and 1MiB are 1024 KB.
+type ByteSize int64
+
+// The units of ByteSize, eg: 64 * MiB
+const (
+	Byte ByteSize = 1
+	KiB           = 1024 * Byte
+	MiB           = 1024 * KiB
+	GiB           = 1024 * MiB
+	TiB           = 1024 * GiB
+)
+
+var byteSizeUnits = map[string]ByteSize{
+	"":    Byte,
+	"b":   Byte,
+	"k":   KiB,
+	"kb":  KiB,
+	"kib": KiB,
+	"m":   MiB,
+	"mb":  MiB,
+	"mib": MiB,
+	"g":   GiB,
+	"gb":  GiB,
+	"gib": GiB,
+	"t":   TiB,
+	"tb":  TiB,
+	"tib": TiB,
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	s := strings.TrimSpace(string(text))
+
+	if s == "" {
+		*b = 0
+
+		return nil
+	}
+
+	// the legacy MB
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		*b = ByteSize(i) * MiB
+
+		return nil
+	}
+
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+
+	if i <= 0 {
+		return fmt.Errorf("invalid size %q, expects eg: 64MB, 1GiB or the MB", s)
+	}
+
+	unit, ok := byteSizeUnits[strings.ToLower(strings.TrimSpace(s[i:]))]
+
+	if !ok {
+		return fmt.Errorf("invalid size %q, unknown unit %s", s, s[i:])
+	}
+
+	f, err := strconv.ParseFloat(s[:i], 64)
+
+	if err != nil || f*float64(unit) > math.MaxInt64 {
+		return fmt.Errorf("invalid size %q, expects eg: 64MB, 1GiB or the MB", s)
+	}
+
+	*b = ByteSize(f * float64(unit))
+
+	return nil
+}
+
+// megabytes returns the size in MB rounded up, eg: for the log rotation.
+func (b ByteSize) megabytes() int {
+	return int((b + MiB - 1) / MiB)
+}
+
+func (b ByteSize) String() string {
+	for _, u := range []struct {
+		unit ByteSize
+		name string
+	}{{TiB, "TiB"}, {GiB, "GiB"}, {MiB, "MiB"}, {KiB, "KiB"}} {
+		if b >= u.unit && b%u.unit == 0 {
+			return fmt.Sprintf("%d%s", b/u.unit, u.name)
+		}
+	}
+
+	return fmt.Sprintf("%dB", int64(b))
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// unmarshalConfigNode decodes the node into the struct pointed by dest, the parsing errors of Duration and ByteSize are named by the keys,
+// eg: read_timeout: invalid duration "10x".
+func unmarshalConfigNode(node *toml.Tree, dest interface{}) error {
+	err := node.Unmarshal(dest)
+
+	if err == nil {
+		return nil
+	}
+
+	rv := reflect.Indirect(reflect.ValueOf(dest))
+
+	if rv.Kind() != reflect.Struct {
+		return err
+	}
+
+	for i := 0; i < rv.NumField(); i++ {
+		f := rv.Type().Field(i)
+
+		key := strings.Split(f.Tag.Get("toml"), ",")[0]
+
+		if key == "" || !reflect.PtrTo(f.Type).Implements(textUnmarshalerType) || !node.Has(key) {
+			continue
+		}
+
+		v := reflect.New(f.Type).Interface().(encoding.TextUnmarshaler)
+
+		if e := v.UnmarshalText([]byte(fmt.Sprint(node.Get(key)))); e != nil {
+			return fmt.Errorf("%s: %w", key, e)
+		}
+	}
+
+	return err
+}
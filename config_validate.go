@@ -0,0 +1,323 @@
+package yiigo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pelletier/go-toml"
+)
+
+// ConfigTree the tree of a config section passed to the validators (see RegisterConfigValidator).
+type ConfigTree struct {
+	path string
+	tree *toml.Tree
+}
+
+// Path returns the dotted path of the tree, eg: redis.
+func (t ConfigTree) Path() string {
+	return t.path
+}
+
+// Keys returns the keys of the tree.
+func (t ConfigTree) Keys() []string {
+	if t.tree == nil {
+		return []string{}
+	}
+
+	return t.tree.Keys()
+}
+
+// Has reports whether the key (eg: default.address) exists.
+func (t ConfigTree) Has(key string) bool {
+	return t.tree != nil && t.tree.Has(key)
+}
+
+// Get returns the value of key (eg: default.address).
+func (t ConfigTree) Get(key string) *EnvValue {
+	if t.tree == nil {
+		return &EnvValue{}
+	}
+
+	return &EnvValue{value: t.tree.Get(key)}
+}
+
+// Sub returns the sub tree of key, false is returned when it's not a table.
+func (t ConfigTree) Sub(key string) (ConfigTree, bool) {
+	if t.tree == nil {
+		return ConfigTree{}, false
+	}
+
+	sub, ok := t.tree.Get(key).(*toml.Tree)
+
+	return ConfigTree{path: configPath(t.path, key), tree: sub}, ok
+}
+
+// Unmarshal decodes the tree into dest by the toml tags.
+func (t ConfigTree) Unmarshal(dest interface{}) error {
+	if t.tree == nil {
+		return ErrConfigNil
+	}
+
+	return t.tree.Unmarshal(dest)
+}
+
+// Errorf returns an error prefixed by the path of tree, eg: "redis.default: address is required".
+func (t ConfigTree) Errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s: %s", t.path, fmt.Sprintf(format, args...))
+}
+
+// ConfigErrors the problems found by the config validation, all of them are reported together.
+type ConfigErrors []error
+
+func (e ConfigErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+
+	return fmt.Sprintf("yiigo: invalid config (%d problems): %s", len(e), strings.Join(msgs, "; "))
+}
+
+var (
+	configValidators = map[string][]func(tree ConfigTree) error{
+		"log":   {validateLoggerConfig},
+		"db":    {validateDBConfig},
+		"mongo": {validateMongoConfig},
+		"redis": {validateRedisConfig},
+		"email": {validateEMailConfig},
+	}
+	configValidatorMutex sync.RWMutex
+)
+
+// RegisterConfigValidator registers fn to validate the section (eg: redis) before the resources are initialized,
+// it's not called when the section is missing. Return ConfigErrors to report multiple problems.
+func RegisterConfigValidator(section string, fn func(tree ConfigTree) error) {
+	configValidatorMutex.Lock()
+	defer configValidatorMutex.Unlock()
+
+	configValidators[section] = append(configValidators[section], fn)
+}
+
+// ValidateConfig validates the loaded config by the registered validators, all the problems are returned as ConfigErrors.
+func ValidateConfig() error {
+	configValidatorMutex.RLock()
+
+	sections := make([]string, 0, len(configValidators))
+
+	for k := range configValidators {
+		sections = append(sections, k)
+	}
+
+	validators := make(map[string][]func(tree ConfigTree) error, len(configValidators))
+
+	for k, v := range configValidators {
+		validators[k] = v
+	}
+
+	configValidatorMutex.RUnlock()
+
+	sort.Strings(sections)
+
+	env.mutex.RLock()
+	errs := append(ConfigErrors(nil), env.refErrors...)
+	env.mutex.RUnlock()
+
+	for _, section := range sections {
+		tree, ok := env.get(section).(*toml.Tree)
+
+		if !ok {
+			continue
+		}
+
+		for _, fn := range validators[section] {
+			errs = appendConfigError(errs, fn(ConfigTree{path: section, tree: tree}))
+		}
+	}
+
+	if len(errs) != 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// appendConfigError appends err to errs, and flattens ConfigErrors.
+func appendConfigError(errs ConfigErrors, err error) ConfigErrors {
+	if err == nil {
+		return errs
+	}
+
+	if e, ok := err.(ConfigErrors); ok {
+		return append(errs, e...)
+	}
+
+	return append(errs, err)
+}
+
+// configNodes calls fn with the named tables of the section in order, the names duplicated case-insensitively are reported.
+func configNodes(tree ConfigTree, fn func(node ConfigTree) error) error {
+	var errs ConfigErrors
+
+	names := make(map[string]string)
+
+	keys := tree.Keys()
+
+	sort.Strings(keys)
+
+	for _, v := range keys {
+		if name, ok := names[strings.ToLower(v)]; ok {
+			errs = append(errs, tree.Errorf("duplicate names %s and %s", name, v))
+		}
+
+		names[strings.ToLower(v)] = v
+
+		// skipped by the init as well
+		node, ok := tree.Sub(v)
+
+		if !ok {
+			continue
+		}
+
+		errs = appendConfigError(errs, fn(node))
+	}
+
+	if len(errs) != 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func validateLoggerConfig(tree ConfigTree) error {
+	return configNodes(tree, func(node ConfigTree) error {
+		cfg := LoggerConfig{}
+
+		if err := unmarshalConfigNode(node.tree, &cfg); err != nil {
+			return node.Errorf("%s", err)
+		}
+
+		if _, err := cfg.options(); err != nil {
+			return node.Errorf("%s", err)
+		}
+
+		if cfg.Encoding != "" && !InStrings(cfg.Encoding, "json", "console") {
+			return node.Errorf("unknown encoding %s, expects json, console", cfg.Encoding)
+		}
+
+		return nil
+	})
+}
+
+func validateDBConfig(tree ConfigTree) error {
+	return configNodes(tree, func(node ConfigTree) error {
+		cfg := DBConfig{}
+
+		if err := unmarshalConfigNode(node.tree, &cfg); err != nil {
+			return node.Errorf("%s", err)
+		}
+
+		var errs ConfigErrors
+
+		if !InStrings(cfg.Driver, string(MySQL), string(Postgres), string(SQLite)) {
+			errs = append(errs, node.Errorf("unknown driver %q, expects mysql, postgres, sqlite3", cfg.Driver))
+		}
+
+		if cfg.Dsn == "" {
+			errs = append(errs, node.Errorf("dsn is required"))
+		}
+
+		if cfg.MaxOpenConns > 0 && cfg.MaxIdleConns > cfg.MaxOpenConns {
+			errs = append(errs, node.Errorf("max_idle_conns (%d) > max_open_conns (%d)", cfg.MaxIdleConns, cfg.MaxOpenConns))
+		}
+
+		if len(errs) != 0 {
+			return errs
+		}
+
+		return nil
+	})
+}
+
+func validateMongoConfig(tree ConfigTree) error {
+	return configNodes(tree, func(node ConfigTree) error {
+		cfg := MongoConfig{}
+
+		if err := unmarshalConfigNode(node.tree, &cfg); err != nil {
+			return node.Errorf("%s", err)
+		}
+
+		var errs ConfigErrors
+
+		if cfg.Dsn == "" {
+			errs = append(errs, node.Errorf("dsn is required"))
+		}
+
+		if cfg.Mode != "" && !InStrings(cfg.Mode, string(Primary), string(PrimaryPreferred), string(Secondary), string(SecondaryPreferred), string(Nearest)) {
+			errs = append(errs, node.Errorf("unknown mode %s", cfg.Mode))
+		}
+
+		if cfg.MaxPoolSize > 0 && cfg.MinPoolSize > cfg.MaxPoolSize {
+			errs = append(errs, node.Errorf("min_pool_size (%d) > max_pool_size (%d)", cfg.MinPoolSize, cfg.MaxPoolSize))
+		}
+
+		if len(errs) != 0 {
+			return errs
+		}
+
+		return nil
+	})
+}
+
+func validateRedisConfig(tree ConfigTree) error {
+	return configNodes(tree, func(node ConfigTree) error {
+		cfg := RedisPoolConfig{}
+
+		if err := unmarshalConfigNode(node.tree, &cfg); err != nil {
+			return node.Errorf("%s", err)
+		}
+
+		var errs ConfigErrors
+
+		switch {
+		case cfg.SentinelMaster != "":
+			if len(cfg.SentinelAddrs) == 0 {
+				errs = append(errs, node.Errorf("sentinel_addrs is required for sentinel_master"))
+			}
+		case cfg.Address == "":
+			errs = append(errs, node.Errorf("address is required"))
+		case isRedisURL(cfg.Address):
+			if _, _, err := ParseRedisURL(cfg.Address); err != nil {
+				errs = append(errs, node.Errorf("%s", err))
+			}
+		}
+
+		if cfg.PoolSize > 0 && cfg.PoolLimit > 0 && cfg.PoolLimit < cfg.PoolSize {
+			errs = append(errs, node.Errorf("pool_limit (%d) < pool_size (%d)", cfg.PoolLimit, cfg.PoolSize))
+		}
+
+		if len(errs) != 0 {
+			return errs
+		}
+
+		return nil
+	})
+}
+
+func validateEMailConfig(tree ConfigTree) error {
+	return configNodes(tree, func(node ConfigTree) error {
+		cfg := EMailConfig{}
+
+		if err := unmarshalConfigNode(node.tree, &cfg); err != nil {
+			return node.Errorf("%s", err)
+		}
+
+		if cfg.Host == "" {
+			return node.Errorf("host is required")
+		}
+
+		return nil
+	})
+}
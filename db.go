@@ -1,8 +1,11 @@
 package yiigo
 
 import (
+	"context"
 	"fmt"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -23,122 +26,321 @@ const (
 )
 
 var (
-	defaultDB  *sqlx.DB
-	dbmap      sync.Map
-	defaultOrm *gorm.DB
+	// defaultDB holds the *sqlx.DB of AsDefault, read by DBE
+	defaultDB atomic.Value
+	dbmap     sync.Map
+	// defaultOrm holds the *gorm.DB of AsDefault, read by OrmE
+	defaultOrm atomic.Value
 	ormap      sync.Map
 )
 
-type dbConfig struct {
-	Driver          string `toml:"driver"`
-	Dsn             string `toml:"dsn"`
-	MaxOpenConns    int    `toml:"max_open_conns"`
-	MaxIdleConns    int    `toml:"max_idle_conns"`
-	ConnMaxLifetime int    `toml:"conn_max_lifetime"`
+// DBConfig the config of db, it's the [db.name] of yiigo.toml, or the DB of Config.
+type DBConfig struct {
+	Driver          string   `toml:"driver"`
+	Dsn             string   `toml:"dsn"`
+	MaxOpenConns    int      `toml:"max_open_conns"`
+	MaxIdleConns    int      `toml:"max_idle_conns"`
+	ConnMaxLifetime Duration `toml:"conn_max_lifetime"`
+	Replicas        []string `toml:"replicas"`
 }
 
-func dbDial(cfg *dbConfig, debug bool) (*gorm.DB, error) {
-	if !InStrings(cfg.Driver, string(MySQL), string(Postgres), string(SQLite)) {
-		return nil, fmt.Errorf("yiigo: unknown db driver %s, expects mysql, postgres, sqlite3", cfg.Driver)
+// options returns the db options of config.
+func (c *DBConfig) options() []DBOption {
+	return []DBOption{
+		WithDBMaxOpenConns(c.MaxOpenConns),
+		WithDBMaxIdleConns(c.MaxIdleConns),
+		WithDBConnMaxLifetime(c.ConnMaxLifetime.Duration()),
+		WithDBReplicas(c.Replicas...),
+	}
+}
+
+// dbPingTimeout the timeout to verify the db by PingContext
+const dbPingTimeout = 10 * time.Second
+
+// dbSetting db setting
+type dbSetting struct {
+	maxOpenConns    int
+	maxIdleConns    int
+	connMaxLifetime time.Duration
+	replicas        []string
+}
+
+// DBOption configures how we set up the db
+type DBOption interface {
+	apply(*dbSetting)
+}
+
+// funcDBOption implements db option
+type funcDBOption struct {
+	f func(*dbSetting)
+}
+
+func (fo *funcDBOption) apply(s *dbSetting) {
+	fo.f(s)
+}
+
+func newFuncDBOption(f func(*dbSetting)) *funcDBOption {
+	return &funcDBOption{f: f}
+}
+
+// WithDBMaxOpenConns specifies the maximum number of open connections, <= 0 means unlimited.
+func WithDBMaxOpenConns(n int) DBOption {
+	return newFuncDBOption(func(s *dbSetting) {
+		s.maxOpenConns = n
+	})
+}
+
+// WithDBMaxIdleConns specifies the maximum number of idle connections, <= 0 means no idle connections are retained.
+func WithDBMaxIdleConns(n int) DBOption {
+	return newFuncDBOption(func(s *dbSetting) {
+		s.maxIdleConns = n
+	})
+}
+
+// WithDBConnMaxLifetime specifies the maximum amount of time a connection may be reused, <= 0 means forever.
+func WithDBConnMaxLifetime(d time.Duration) DBOption {
+	return newFuncDBOption(func(s *dbSetting) {
+		s.connMaxLifetime = d
+	})
+}
+
+// WithDBReplicas specifies the dsns of read replicas, which share the driver and options of db (see DBReadOnly).
+func WithDBReplicas(dsns ...string) DBOption {
+	return newFuncDBOption(func(s *dbSetting) {
+		s.replicas = dsns
+	})
+}
+
+// newDBSetting returns a db setting by options.
+func newDBSetting(options ...DBOption) *dbSetting {
+	setting := new(dbSetting)
+
+	for _, option := range options {
+		option.apply(setting)
 	}
 
-	orm, err := gorm.Open(cfg.Driver, cfg.Dsn)
+	return setting
+}
+
+// dbOpen opens a db of the driver (mysql, postgres or sqlite3), which is verified by PingContext.
+func dbOpen(driver, dsn string, setting *dbSetting) (*sqlx.DB, error) {
+	if !InStrings(driver, string(MySQL), string(Postgres), string(SQLite)) {
+		return nil, fmt.Errorf("yiigo: unknown db driver %s, expects mysql, postgres, sqlite3", driver)
+	}
+
+	db, err := sqlx.Open(driver, dsn)
 
 	if err != nil {
 		return nil, err
 	}
 
-	if debug {
-		orm.LogMode(true)
+	db.SetMaxOpenConns(setting.maxOpenConns)
+	db.SetMaxIdleConns(setting.maxIdleConns)
+	db.SetConnMaxLifetime(setting.connMaxLifetime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), dbPingTimeout)
+
+	defer cancel()
+
+	if err = db.PingContext(ctx); err != nil {
+		db.Close()
+
+		return nil, err
 	}
 
-	orm.DB().SetMaxOpenConns(cfg.MaxOpenConns)
-	orm.DB().SetMaxIdleConns(cfg.MaxIdleConns)
-	orm.DB().SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetime) * time.Second)
+	return db, nil
+}
 
-	return orm, nil
+// RegisterDB registers a db with the given name, driver (mysql, postgres or sqlite3) and dsn.
+// It panics when failed to verify the db, unless an error handler is specified by SetErrorHandler.
+func RegisterDB(name, driver, dsn string, options ...DBOption) {
+	if err := initDB(name, driver, dsn, options...); err != nil && !handleError("db", name, err) {
+		logger().Panic("yiigo: db init error", zap.String("name", name), zap.Error(err))
+	}
 }
 
-func initDB() {
-	tree, ok := env.get("db").(*toml.Tree)
+func initDB(name, driver, dsn string, options ...DBOption) error {
+	setting := newDBSetting(options...)
 
-	if !ok {
-		return
+	db, err := dbOpen(driver, dsn, setting)
+
+	if err != nil {
+		return err
 	}
 
-	keys := tree.Keys()
+	orm, err := gorm.Open(driver, db.DB)
 
-	if len(keys) == 0 {
-		return
+	if err != nil {
+		db.Close()
+
+		return err
 	}
 
-	for _, v := range keys {
-		node, ok := tree.Get(v).(*toml.Tree)
+	var replicas *dbReplicas
 
-		if !ok {
-			continue
+	if len(setting.replicas) != 0 {
+		if replicas, err = newDBReplicas(name, driver, db, setting); err != nil {
+			db.Close()
+
+			return err
 		}
+	}
 
-		cfg := new(dbConfig)
+	if isDebug() {
+		orm.LogMode(true)
+	}
 
-		if err := node.Unmarshal(cfg); err != nil {
-			logger.Panic("yiigo: db init error", zap.String("name", v), zap.Error(err))
-		}
+	// the replaced one, closed after the running queries are finished
+	v, replaced := dbmap.Load(name)
 
-		orm, err := dbDial(cfg, debug)
+	if name == AsDefault {
+		defaultDB.Store(db)
+		defaultOrm.Store(orm)
+	}
+
+	dbmap.Store(name, db)
+	ormap.Store(name, orm)
+	setDBReplicas(name, replicas)
+
+	if replaced {
+		go v.(*sqlx.DB).Close()
+	}
+
+	logger().Info(fmt.Sprintf("yiigo: db.%s is OK.", name))
+
+	return nil
+}
+
+// InitDBE registers the dbs configured in yiigo.toml, the first error is returned instead of panic,
+// eg: to retry when the db is not up yet. The registered dbs are skipped, so that only the failed ones are retried.
+func InitDBE() error {
+	cfgs, err := envDBConfigs()
+
+	if err != nil {
+		return err
+	}
 
-		if err != nil {
-			logger.Panic("yiigo: db init error", zap.String("name", v), zap.Error(err))
+	return initDBConfigs(cfgs)
+}
+
+// envDBConfigs returns the db configs of yiigo.toml.
+func envDBConfigs() (map[string]DBConfig, error) {
+	cfgs := make(map[string]DBConfig)
+
+	err := envSection("db", func(name string, node *toml.Tree) error {
+		cfg := DBConfig{}
+
+		if err := unmarshalConfigNode(node, &cfg); err != nil {
+			return &initError{module: "db", name: name, err: err}
 		}
 
-		db := sqlx.NewDb(orm.DB(), cfg.Driver)
+		cfgs[name] = cfg
+
+		return nil
+	})
+
+	return cfgs, err
+}
 
-		if v == AsDefault {
-			defaultDB = db
-			defaultOrm = orm
+// initDBConfigs registers the dbs of cfgs, the registered ones are skipped.
+func initDBConfigs(cfgs map[string]DBConfig) error {
+	names := make([]string, 0, len(cfgs))
+
+	for k := range cfgs {
+		names = append(names, k)
+	}
+
+	sort.Strings(names)
+
+	for _, v := range names {
+		if _, ok := dbmap.Load(v); ok {
+			continue
 		}
 
-		dbmap.Store(v, db)
-		ormap.Store(v, orm)
+		cfg := cfgs[v]
 
-		logger.Info(fmt.Sprintf("yiigo: db.%s is OK.", v))
+		if err := initDB(v, cfg.Driver, cfg.Dsn, cfg.options()...); err != nil {
+			return &initError{module: "db", name: v, err: err}
+		}
 	}
+
+	return nil
+}
+
+func dbUnknownError(name string) error {
+	return fmt.Errorf("yiigo: unknown db.%s (forgotten configure?)", name)
 }
 
 // DB returns a db.
+// It panics when the db is not registered, unless an error handler is specified by SetErrorHandler (nil is returned then).
 func DB(name ...string) *sqlx.DB {
+	db, err := DBE(name...)
+
+	if err != nil {
+		if !handleError("db", resourceName(name), err) {
+			logger().Panic(err.Error())
+		}
+
+		return nil
+	}
+
+	return db
+}
+
+// DBE returns a db, an error is returned instead of panic when the db is not registered.
+func DBE(name ...string) (*sqlx.DB, error) {
 	if len(name) == 0 {
-		if defaultDB == nil {
-			logger.Panic(fmt.Sprintf("yiigo: unknown db.%s (forgotten configure?)", AsDefault))
+		db, _ := defaultDB.Load().(*sqlx.DB)
+
+		if db == nil {
+			return nil, dbUnknownError(AsDefault)
 		}
 
-		return defaultDB
+		return db, nil
 	}
 
 	v, ok := dbmap.Load(name[0])
 
 	if !ok {
-		logger.Panic(fmt.Sprintf("yiigo: unknown db.%s (forgotten configure?)", name[0]))
+		return nil, dbUnknownError(name[0])
 	}
 
-	return v.(*sqlx.DB)
+	return v.(*sqlx.DB), nil
 }
 
 // Orm returns an orm's db.
+// It panics when the db is not registered, unless an error handler is specified by SetErrorHandler (nil is returned then).
 func Orm(name ...string) *gorm.DB {
+	orm, err := OrmE(name...)
+
+	if err != nil {
+		if !handleError("db", resourceName(name), err) {
+			logger().Panic(err.Error())
+		}
+
+		return nil
+	}
+
+	return orm
+}
+
+// OrmE returns an orm's db, an error is returned instead of panic when the db is not registered.
+func OrmE(name ...string) (*gorm.DB, error) {
 	if len(name) == 0 || name[0] == AsDefault {
-		if defaultOrm == nil {
-			logger.Panic(fmt.Sprintf("yiigo: unknown db.%s (forgotten configure?)", AsDefault))
+		orm, _ := defaultOrm.Load().(*gorm.DB)
+
+		if orm == nil {
+			return nil, dbUnknownError(AsDefault)
 		}
 
-		return defaultOrm
+		return orm, nil
 	}
 
 	v, ok := ormap.Load(name[0])
 
 	if !ok {
-		logger.Panic(fmt.Sprintf("yiigo: unknown db.%s (forgotten configure?)", name[0]))
+		return nil, dbUnknownError(name[0])
 	}
 
-	return v.(*gorm.DB)
+	return v.(*gorm.DB), nil
 }
@@ -0,0 +1,197 @@
+package yiigo
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// dbReplicaCheckInterval how often the replicas are pinged, so that a recovered replica rejoins the rotation
+var dbReplicaCheckInterval = 10 * time.Second
+
+var dbReplicaMap sync.Map
+
+// dbReplica the replica of db
+type dbReplica struct {
+	healthy int32
+	dsn     string
+	db      *sqlx.DB
+}
+
+// dbReplicas the replicas of a registered db
+type dbReplicas struct {
+	next     uint32
+	name     string
+	primary  *sqlx.DB
+	replicas []*dbReplica
+	done     chan struct{}
+	once     sync.Once
+}
+
+// newDBReplicas opens the replicas which share the setting of primary, the ones failed to ping are out of rotation until recovered.
+func newDBReplicas(name, driver string, primary *sqlx.DB, setting *dbSetting) (*dbReplicas, error) {
+	r := &dbReplicas{
+		name:     name,
+		primary:  primary,
+		replicas: make([]*dbReplica, 0, len(setting.replicas)),
+		done:     make(chan struct{}),
+	}
+
+	for _, dsn := range setting.replicas {
+		db, err := sqlx.Open(driver, dsn)
+
+		if err != nil {
+			r.close()
+
+			return nil, err
+		}
+
+		db.SetMaxOpenConns(setting.maxOpenConns)
+		db.SetMaxIdleConns(setting.maxIdleConns)
+		db.SetConnMaxLifetime(setting.connMaxLifetime)
+
+		r.replicas = append(r.replicas, &dbReplica{dsn: dsn, db: db})
+	}
+
+	r.check()
+
+	go r.watch()
+
+	return r, nil
+}
+
+// check pings the replicas concurrently, and updates the health of them.
+func (r *dbReplicas) check() {
+	var wg sync.WaitGroup
+
+	for i, v := range r.replicas {
+		wg.Add(1)
+
+		go func(i int, v *dbReplica) {
+			defer wg.Done()
+
+			r.checkReplica(i, v)
+		}(i, v)
+	}
+
+	wg.Wait()
+}
+
+// checkReplica pings the replica, and logs the change of its health.
+func (r *dbReplicas) checkReplica(i int, v *dbReplica) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbPingTimeout)
+
+	err := v.db.PingContext(ctx)
+
+	cancel()
+
+	var healthy int32
+
+	if err == nil {
+		healthy = 1
+	}
+
+	if atomic.SwapInt32(&v.healthy, healthy) != healthy {
+		if err != nil {
+			logger().Warn("yiigo: db replica is down", zap.String("name", r.name), zap.Int("replica", i), zap.Error(err))
+		} else {
+			logger().Info("yiigo: db replica is up", zap.String("name", r.name), zap.Int("replica", i))
+		}
+	}
+}
+
+func (r *dbReplicas) watch() {
+	ticker := time.NewTicker(dbReplicaCheckInterval)
+
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+			r.check()
+		}
+	}
+}
+
+// readOnly returns a healthy replica in round-robin, the primary is returned when all replicas are down.
+func (r *dbReplicas) readOnly() *sqlx.DB {
+	n := len(r.replicas)
+
+	start := int(atomic.AddUint32(&r.next, 1))
+
+	for i := 0; i < n; i++ {
+		replica := r.replicas[(start+i)%n]
+
+		if atomic.LoadInt32(&replica.healthy) == 1 {
+			return replica.db
+		}
+	}
+
+	return r.primary
+}
+
+// close stops the health check and closes the replicas, the primary is not closed.
+func (r *dbReplicas) close() {
+	r.once.Do(func() {
+		close(r.done)
+
+		for _, v := range r.replicas {
+			v.db.Close()
+		}
+	})
+}
+
+// setDBReplicas registers the replicas of db, the replaced ones are closed.
+func setDBReplicas(name string, r *dbReplicas) {
+	v, ok := dbReplicaMap.Load(name)
+
+	if r != nil {
+		dbReplicaMap.Store(name, r)
+	} else {
+		dbReplicaMap.Delete(name)
+	}
+
+	if ok {
+		go v.(*dbReplicas).close()
+	}
+}
+
+// DBReadOnly returns a replica of db in round-robin for reads (see WithDBReplicas),
+// the db itself (primary) is returned when all replicas are down or not specified.
+// It panics when the db is not registered, unless an error handler is specified by SetErrorHandler (nil is returned then).
+func DBReadOnly(name ...string) *sqlx.DB {
+	db, err := DBReadOnlyE(name...)
+
+	if err != nil {
+		if !handleError("db", resourceName(name), err) {
+			logger().Panic(err.Error())
+		}
+
+		return nil
+	}
+
+	return db
+}
+
+// DBReadOnlyE returns a replica of db, an error is returned instead of panic when the db is not registered.
+func DBReadOnlyE(name ...string) (*sqlx.DB, error) {
+	primary, err := DBE(name...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	v, ok := dbReplicaMap.Load(resourceName(name))
+
+	if !ok {
+		return primary, nil
+	}
+
+	return v.(*dbReplicas).readOnly(), nil
+}
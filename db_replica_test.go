@@ -0,0 +1,85 @@
+package yiigo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDBReadOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yiigo_db")
+
+	assert.Nil(t, err)
+
+	defer os.RemoveAll(dir)
+
+	defaultInterval := dbReplicaCheckInterval
+	dbReplicaCheckInterval = 10 * time.Millisecond
+
+	defer func() {
+		dbReplicaCheckInterval = defaultInterval
+	}()
+
+	// the dir of replica b is missing, which fails to ping until created
+	replicaA := filepath.Join(dir, "a.db")
+	replicaB := filepath.Join(dir, "b", "b.db")
+
+	RegisterDB("replica", "sqlite3", filepath.Join(dir, "primary.db"), WithDBReplicas(replicaA, replicaB))
+
+	defer setDBReplicas("replica", nil)
+
+	primary := DB("replica")
+
+	v, ok := dbReplicaMap.Load("replica")
+
+	assert.True(t, ok)
+
+	replicas := v.(*dbReplicas).replicas
+
+	for i := 0; i < 4; i++ {
+		assert.True(t, DBReadOnly("replica") == replicas[0].db)
+	}
+
+	// recovered
+	assert.Nil(t, os.Mkdir(filepath.Join(dir, "b"), 0755))
+
+	time.Sleep(100 * time.Millisecond)
+
+	used := map[string]bool{}
+
+	for i := 0; i < 4; i++ {
+		db := DBReadOnly("replica")
+
+		assert.False(t, db == primary)
+
+		for _, r := range replicas {
+			if r.db == db {
+				used[r.dsn] = true
+			}
+		}
+	}
+
+	assert.Equal(t, map[string]bool{replicaA: true, replicaB: true}, used)
+
+	// all down, fallback to primary
+	for _, r := range replicas {
+		r.db.Close()
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	assert.True(t, DBReadOnly("replica") == primary)
+
+	// the db without replicas
+	RegisterDB("replica_none", "sqlite3", ":memory:")
+
+	assert.True(t, DBReadOnly("replica_none") == DB("replica_none"))
+
+	_, err = DBReadOnlyE("unknown")
+
+	assert.EqualError(t, err, "yiigo: unknown db.unknown (forgotten configure?)")
+}
@@ -0,0 +1,50 @@
+package yiigo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// DBTransaction runs fn in a transaction of db, which is committed when fn returns nil, or rolled back.
+// The transaction is rolled back as well when fn panics, and the panic is propagated after the rollback.
+func DBTransaction(ctx context.Context, db *sqlx.DB, fn func(tx *sqlx.Tx) error) error {
+	return DBTransactionWithOptions(ctx, db, nil, fn)
+}
+
+// DBTransactionWithOptions is the same as DBTransaction, with the tx options, eg: isolation level, read-only.
+// The error of fn keeps in the returned error when failed to rollback, so that errors.Is and errors.As still work.
+func DBTransactionWithOptions(ctx context.Context, db *sqlx.DB, opts *sql.TxOptions, fn func(tx *sqlx.Tx) error) error {
+	tx, err := db.BeginTxx(ctx, opts)
+
+	if err != nil {
+		return fmt.Errorf("yiigo: tx begin error: %w", err)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if rerr := tx.Rollback(); rerr != nil {
+				logger().Error("yiigo: tx rollback error", zap.Any("panic", r), zap.Error(rerr))
+			}
+
+			panic(r)
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			return fmt.Errorf("yiigo: tx rollback error: %v (caused by: %w)", rerr, err)
+		}
+
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("yiigo: tx commit error: %w", err)
+	}
+
+	return nil
+}
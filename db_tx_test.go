@@ -0,0 +1,101 @@
+package yiigo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDBTransaction(t *testing.T) {
+	// one conn for the :memory: db
+	db, err := dbOpen("sqlite3", ":memory:", newDBSetting(WithDBMaxOpenConns(1), WithDBMaxIdleConns(1)))
+
+	assert.Nil(t, err)
+
+	defer db.Close()
+
+	_, err = db.Exec("CREATE TABLE user (id INTEGER PRIMARY KEY, name TEXT)")
+
+	assert.Nil(t, err)
+
+	count := func() int {
+		var n int
+
+		assert.Nil(t, db.Get(&n, "SELECT COUNT(*) FROM user"))
+
+		return n
+	}
+
+	// commit
+	err = DBTransaction(context.Background(), db, func(tx *sqlx.Tx) error {
+		_, err := tx.Exec("INSERT INTO user (name) VALUES (?)", "shenghui")
+
+		return err
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count())
+
+	// rollback on error
+	errFailed := errors.New("failed")
+
+	err = DBTransaction(context.Background(), db, func(tx *sqlx.Tx) error {
+		if _, err := tx.Exec("INSERT INTO user (name) VALUES (?)", "iiinsomnia"); err != nil {
+			return err
+		}
+
+		return errFailed
+	})
+
+	assert.Equal(t, errFailed, err)
+	assert.Equal(t, 1, count())
+
+	// rollback on panic
+	assert.PanicsWithValue(t, "boom", func() {
+		DBTransaction(context.Background(), db, func(tx *sqlx.Tx) error {
+			if _, err := tx.Exec("INSERT INTO user (name) VALUES (?)", "iiinsomnia"); err != nil {
+				return err
+			}
+
+			panic("boom")
+		})
+	})
+
+	assert.Equal(t, 1, count())
+
+	// the error of fn is kept when failed to rollback
+	err = DBTransaction(context.Background(), db, func(tx *sqlx.Tx) error {
+		assert.Nil(t, tx.Commit())
+
+		return errFailed
+	})
+
+	assert.True(t, errors.Is(err, errFailed))
+	assert.Contains(t, err.Error(), "yiigo: tx rollback error")
+
+	// read-only
+	err = DBTransactionWithOptions(context.Background(), db, &sql.TxOptions{ReadOnly: true}, func(tx *sqlx.Tx) error {
+		var n int
+
+		return tx.Get(&n, "SELECT COUNT(*) FROM user")
+	})
+
+	assert.Nil(t, err)
+
+	// begin error
+	ctx, cancel := context.WithCancel(context.Background())
+
+	cancel()
+
+	err = DBTransaction(ctx, db, func(tx *sqlx.Tx) error {
+		t.Fatal("fn is called")
+
+		return nil
+	})
+
+	assert.True(t, errors.Is(err, context.Canceled))
+}
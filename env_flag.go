@@ -0,0 +1,193 @@
+package yiigo
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pelletier/go-toml"
+)
+
+// envFlagPrefix the prefix of the flags overriding the config, eg: --yiigo.redis.default.address=127.0.0.1:6380
+const envFlagPrefix = "yiigo."
+
+// envFlagValue the config value of a flag
+type envFlagValue struct {
+	key   string
+	value string
+	flag  string
+}
+
+var (
+	envFlagValues []envFlagValue
+	envFlagMutex  sync.Mutex
+)
+
+// BindFlags registers the flags overriding the config on fs, they take precedence over the config file and the environment variables:
+//
+//     --yiigo.<key>=<value> for the keys of the loaded config, eg: --yiigo.redis.default.address=127.0.0.1:6380
+//     --yiigo.set <key>=<value> repeatable for any key, eg: --yiigo.set app.workers=8
+//
+// The values are applied to Env on parse. Note: the resources are initialized before main, call InitE to reinit them after parse.
+func BindFlags(fs *flag.FlagSet) {
+	env.mutex.RLock()
+	keys := envLeafKeys(env.tree, nil)
+	env.mutex.RUnlock()
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		name := envFlagPrefix + k
+
+		if fs.Lookup(name) != nil {
+			continue
+		}
+
+		_, isBool := env.get(k).(bool)
+
+		fs.Var(&envFlag{key: k, name: name, isBool: isBool}, name, fmt.Sprintf("overrides the config %s", k))
+	}
+
+	if fs.Lookup(envFlagPrefix+"set") == nil {
+		fs.Var(&envSetFlag{}, envFlagPrefix+"set", "overrides the config by key=value, repeatable")
+	}
+}
+
+// InitE inits the resources of the loaded config the same as yiigo.toml, eg: after the flags are parsed (see BindFlags).
+// The problems of config are returned together (see ValidateConfig), or the first init error.
+// The registered dbs and mongodb clients are kept, the others are replaced.
+func InitE() error {
+	return initEnvConfig()
+}
+
+// envLeafKeys returns the dotted keys of the values (not tables) of tree.
+func envLeafKeys(tree *toml.Tree, path []string) []string {
+	keys := make([]string, 0)
+
+	for _, k := range tree.Keys() {
+		p := append(append(make([]string, 0, len(path)+1), path...), k)
+
+		switch t := tree.GetPath([]string{k}).(type) {
+		case *toml.Tree:
+			keys = append(keys, envLeafKeys(t, p)...)
+		case []*toml.Tree:
+			// the arrays of tables are not overridable
+		default:
+			keys = append(keys, strings.Join(p, "."))
+		}
+	}
+
+	return keys
+}
+
+// setEnvFlag records the value of flag, and reapplies the overrides.
+func setEnvFlag(key, value, name string) error {
+	env.mutex.RLock()
+	_, err := envFlagConvert(env.tree, key, value)
+	env.mutex.RUnlock()
+
+	if err != nil {
+		return err
+	}
+
+	envFlagMutex.Lock()
+	envFlagValues = append(envFlagValues, envFlagValue{key: key, value: value, flag: name})
+	envFlagMutex.Unlock()
+
+	env.override(os.Environ())
+
+	return nil
+}
+
+// overrideFlags applies the values of flags in order, the later ones win. It's called with the mutex held.
+func (c *config) overrideFlags() {
+	envFlagMutex.Lock()
+	values := append([]envFlagValue(nil), envFlagValues...)
+	envFlagMutex.Unlock()
+
+	for _, v := range values {
+		nv, err := envFlagConvert(c.tree, v.key, v.value)
+
+		if err != nil {
+			continue
+		}
+
+		c.tree.Set(v.key, nv)
+
+		c.overrides[v.key] = "flag --" + v.flag
+	}
+}
+
+// envFlagConvert converts the value to the type of key, the value of new key is parsed as toml (eg: 8, true), or string.
+func envFlagConvert(tree *toml.Tree, key, value string) (interface{}, error) {
+	if v := tree.Get(key); v != nil {
+		if _, ok := v.(*toml.Tree); ok {
+			return nil, fmt.Errorf("yiigo: config %s is a table", key)
+		}
+
+		return coerceEnvValue(v, value)
+	}
+
+	if t, err := toml.Load("v = " + value); err == nil {
+		if v := t.Get("v"); v != nil {
+			return v, nil
+		}
+	}
+
+	return value, nil
+}
+
+// envFlag the flag of a config key
+type envFlag struct {
+	key    string
+	name   string
+	value  string
+	isBool bool
+}
+
+func (f *envFlag) String() string {
+	return f.value
+}
+
+// IsBoolFlag reports whether the flag is bool, eg: --yiigo.app.debug without the value.
+func (f *envFlag) IsBoolFlag() bool {
+	return f.isBool
+}
+
+func (f *envFlag) Set(value string) error {
+	if err := setEnvFlag(f.key, value, f.name); err != nil {
+		return err
+	}
+
+	f.value = value
+
+	return nil
+}
+
+// envSetFlag the repeatable flag of key=value
+type envSetFlag struct {
+	values []string
+}
+
+func (f *envSetFlag) String() string {
+	return strings.Join(f.values, ",")
+}
+
+func (f *envSetFlag) Set(value string) error {
+	kv := strings.SplitN(value, "=", 2)
+
+	if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+		return fmt.Errorf("yiigo: invalid %s, expects key=value", value)
+	}
+
+	if err := setEnvFlag(strings.TrimSpace(kv[0]), kv[1], envFlagPrefix+"set"); err != nil {
+		return err
+	}
+
+	f.values = append(f.values, value)
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package yiigo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+	"gopkg.in/yaml.v2"
+)
+
+// envFiles the config files tried in order when loading the default config
+var envFiles = []string{"yiigo.toml", "yiigo.yaml", "yiigo.yml", "yiigo.json"}
+
+// isTOMLFile reports whether the config file is toml by its extension, the unknown one is considered as toml.
+func isTOMLFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		return false
+	}
+
+	return true
+}
+
+// loadEnvTree parses the config file by its extension (.toml, .yaml, .yml or .json) into the tree of toml,
+// so that the sections work identically regardless of format.
+func loadEnvTree(path string) (*toml.Tree, error) {
+	if isTOMLFile(path) {
+		return toml.LoadFile(path)
+	}
+
+	b, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return parseEnvTree(strings.ToLower(filepath.Ext(path)), b)
+}
+
+// parseEnvTree parses the content of format (.toml, .yaml, .yml or .json) into the tree of toml.
+func parseEnvTree(ext string, b []byte) (*toml.Tree, error) {
+	var v interface{}
+
+	switch ext {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(b, &v); err != nil {
+			return nil, err
+		}
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(b))
+
+		// keeps the integers as int64
+		decoder.UseNumber()
+
+		if err := decoder.Decode(&v); err != nil {
+			return nil, err
+		}
+	default:
+		return toml.LoadBytes(b)
+	}
+
+	// the empty file
+	if v == nil {
+		return toml.TreeFromMap(map[string]interface{}{})
+	}
+
+	v, err := normalizeEnvValue(v)
+
+	if err != nil {
+		return nil, err
+	}
+
+	m, ok := v.(map[string]interface{})
+
+	if !ok {
+		return nil, fmt.Errorf("yiigo: the root of config must be a table, got %T", v)
+	}
+
+	return toml.TreeFromMap(m)
+}
+
+// normalizeEnvValue converts the values of yaml and json to the ones of toml,
+// eg: map[interface{}]interface{} to map[string]interface{} and json.Number to int64 or float64.
+func normalizeEnvValue(v interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+
+		for k, v := range t {
+			nv, err := normalizeEnvValue(v)
+
+			if err != nil {
+				return nil, err
+			}
+
+			// toml doesn't support null
+			if nv != nil {
+				m[fmt.Sprint(k)] = nv
+			}
+		}
+
+		return m, nil
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+
+		for k, v := range t {
+			nv, err := normalizeEnvValue(v)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if nv != nil {
+				m[k] = nv
+			}
+		}
+
+		return m, nil
+	case []interface{}:
+		arr := make([]interface{}, 0, len(t))
+
+		for _, v := range t {
+			nv, err := normalizeEnvValue(v)
+
+			if err != nil {
+				return nil, err
+			}
+
+			// toml doesn't support null
+			if nv != nil {
+				arr = append(arr, nv)
+			}
+		}
+
+		return arr, nil
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i, nil
+		}
+
+		return t.Float64()
+	case int:
+		return int64(t), nil
+	case uint64:
+		return t, nil
+	case float64, string, bool:
+		return t, nil
+	case nil:
+		return nil, nil
+	default:
+		return fmt.Sprint(t), nil
+	}
+}
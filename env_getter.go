@@ -0,0 +1,232 @@
+package yiigo
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// EnvString returns the string of key (eg: app.name), the numbers and bools are formatted.
+// The defaultValue is returned when the key is missing, or the value can't be converted (logged at warn level).
+func EnvString(key, defaultValue string) string {
+	v := Env(key).value
+
+	if v == nil {
+		return defaultValue
+	}
+
+	switch t := v.(type) {
+	case string:
+		return t
+	case int64:
+		return strconv.FormatInt(t, 10)
+	case uint64:
+		return strconv.FormatUint(t, 10)
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(t)
+	}
+
+	envInvalid(key, v, "string")
+
+	return defaultValue
+}
+
+// EnvInt returns the int of key (eg: app.workers), the string is parsed (eg: "8080").
+// The defaultValue is returned when the key is missing, or the value can't be converted (logged at warn level).
+func EnvInt(key string, defaultValue int) int {
+	v := Env(key).value
+
+	if v == nil {
+		return defaultValue
+	}
+
+	switch t := v.(type) {
+	case int64:
+		if int64(int(t)) == t {
+			return int(t)
+		}
+	case uint64:
+		if t <= math.MaxInt64 && int64(int(t)) == int64(t) {
+			return int(t)
+		}
+	case float64:
+		if i := int64(t); float64(i) == t && int64(int(i)) == i {
+			return int(i)
+		}
+	case string:
+		if i, err := strconv.Atoi(strings.TrimSpace(t)); err == nil {
+			return i
+		}
+	}
+
+	envInvalid(key, v, "int")
+
+	return defaultValue
+}
+
+// EnvBool returns the bool of key (eg: app.debug), the string (eg: "true", "1") and the number (0 or 1) are parsed.
+// The defaultValue is returned when the key is missing, or the value can't be converted (logged at warn level).
+func EnvBool(key string, defaultValue bool) bool {
+	v := Env(key).value
+
+	if v == nil {
+		return defaultValue
+	}
+
+	switch t := v.(type) {
+	case bool:
+		return t
+	case int64:
+		if t == 0 || t == 1 {
+			return t == 1
+		}
+	case uint64:
+		if t == 0 || t == 1 {
+			return t == 1
+		}
+	case string:
+		if b, err := strconv.ParseBool(strings.TrimSpace(t)); err == nil {
+			return b
+		}
+	}
+
+	envInvalid(key, v, "bool")
+
+	return defaultValue
+}
+
+// EnvFloat64 returns the float64 of key, the integer and the string (eg: "0.5") are converted.
+// The defaultValue is returned when the key is missing, or the value can't be converted (logged at warn level).
+func EnvFloat64(key string, defaultValue float64) float64 {
+	v := Env(key).value
+
+	if v == nil {
+		return defaultValue
+	}
+
+	switch t := v.(type) {
+	case float64:
+		return t
+	case int64:
+		return float64(t)
+	case uint64:
+		return float64(t)
+	case string:
+		if f, err := strconv.ParseFloat(strings.TrimSpace(t), 64); err == nil {
+			return f
+		}
+	}
+
+	envInvalid(key, v, "float64")
+
+	return defaultValue
+}
+
+// EnvDuration returns the duration of key, the string is parsed by time.ParseDuration (eg: "500ms", "2h"), the number is in seconds.
+// The defaultValue is returned when the key is missing, or the value can't be converted (logged at warn level).
+func EnvDuration(key string, defaultValue time.Duration) time.Duration {
+	v := Env(key).value
+
+	if v == nil {
+		return defaultValue
+	}
+
+	switch t := v.(type) {
+	case string:
+		if d, err := time.ParseDuration(strings.TrimSpace(t)); err == nil {
+			return d
+		}
+	case int64:
+		return time.Duration(t) * time.Second
+	case uint64:
+		return time.Duration(t) * time.Second
+	case float64:
+		return time.Duration(t * float64(time.Second))
+	}
+
+	envInvalid(key, v, "duration")
+
+	return defaultValue
+}
+
+// EnvStrings returns the strings of array key, the elements are formatted as EnvString, and the string is separated by comma.
+// The defaultValue is returned when the key is missing, or the value can't be converted (logged at warn level).
+func EnvStrings(key string, defaultValue []string) []string {
+	v := Env(key).value
+
+	if v == nil {
+		return defaultValue
+	}
+
+	switch t := v.(type) {
+	case []interface{}:
+		result := make([]string, 0, len(t))
+
+		for _, elem := range t {
+			switch e := elem.(type) {
+			case string:
+				result = append(result, e)
+			case int64, uint64, float64, bool:
+				result = append(result, fmt.Sprint(e))
+			default:
+				envInvalid(key, v, "[]string")
+
+				return defaultValue
+			}
+		}
+
+		return result
+	case []string:
+		return t
+	case string:
+		result := make([]string, 0)
+
+		for _, s := range strings.Split(t, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				result = append(result, s)
+			}
+		}
+
+		return result
+	}
+
+	envInvalid(key, v, "[]string")
+
+	return defaultValue
+}
+
+// EnvTime returns the time of key, the string is parsed with layout (eg: time.RFC3339), the integer is the unix timestamp.
+// The defaultValue is returned when the key is missing, or the value can't be converted (logged at warn level).
+func EnvTime(key, layout string, defaultValue time.Time) time.Time {
+	v := Env(key).value
+
+	if v == nil {
+		return defaultValue
+	}
+
+	switch t := v.(type) {
+	case time.Time:
+		return t
+	case string:
+		if tm, err := time.Parse(layout, strings.TrimSpace(t)); err == nil {
+			return tm
+		}
+	case int64:
+		return time.Unix(t, 0)
+	}
+
+	envInvalid(key, v, "time")
+
+	return defaultValue
+}
+
+// envInvalid logs the value of key can't be converted to typ, the value is omitted in case of secrets.
+func envInvalid(key string, v interface{}, typ string) {
+	logger().Warn("yiigo: invalid config value, the default is used", zap.String("key", key), zap.String("expects", typ), zap.String("got", fmt.Sprintf("%T", v)))
+}
@@ -0,0 +1,124 @@
+package yiigo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+)
+
+// envRefRegexp matches the secret references in the config values, eg: ${ENV:REDIS_PASSWORD} and ${FILE:/run/secrets/redis_pw}
+var envRefRegexp = regexp.MustCompile(`\$\{(ENV|FILE):([^}]*)\}`)
+
+// interpolate resolves the secret references of the string values in place, the resolved keys are masked by PrintEffectiveConfig,
+// and the unresolvable ones are reported by ValidateConfig. It's called with the mutex held.
+func (c *config) interpolate() {
+	if c.secrets == nil {
+		c.secrets = make(map[string]bool)
+	}
+
+	c.refErrors = nil
+
+	c.interpolateTree(c.tree, nil)
+}
+
+func (c *config) interpolateTree(tree *toml.Tree, path []string) {
+	for _, k := range tree.Keys() {
+		keys := append(append(make([]string, 0, len(path)+1), path...), k)
+
+		switch t := tree.GetPath([]string{k}).(type) {
+		case *toml.Tree:
+			c.interpolateTree(t, keys)
+		case []*toml.Tree:
+			for _, sub := range t {
+				c.interpolateTree(sub, keys)
+			}
+		case string:
+			if v, ok := c.resolveRefs(keys, t); ok {
+				tree.SetPath([]string{k}, v)
+			}
+		case []interface{}:
+			arr := make([]interface{}, len(t))
+			resolved := false
+
+			for i, elem := range t {
+				arr[i] = elem
+
+				if s, ok := elem.(string); ok {
+					if v, ok := c.resolveRefs(keys, s); ok {
+						arr[i], resolved = v, true
+					}
+				}
+			}
+
+			if resolved {
+				tree.SetPath([]string{k}, arr)
+			}
+		}
+	}
+}
+
+// resolveRefs returns the value with the references of s resolved, false is returned when s has no references or failed to resolve.
+func (c *config) resolveRefs(keys []string, s string) (string, bool) {
+	if !strings.Contains(s, "${") {
+		return s, false
+	}
+
+	var err error
+
+	v := envRefRegexp.ReplaceAllStringFunc(s, func(ref string) string {
+		m := envRefRegexp.FindStringSubmatch(ref)
+
+		secret, e := resolveEnvRef(m[1], strings.TrimSpace(m[2]))
+
+		if e != nil && err == nil {
+			err = e
+		}
+
+		return secret
+	})
+
+	if v == s {
+		return s, false
+	}
+
+	key := strings.Join(keys, ".")
+
+	if err != nil {
+		c.refErrors = append(c.refErrors, fmt.Errorf("%s: %w", key, err))
+
+		return s, false
+	}
+
+	c.secrets[key] = true
+
+	return v, true
+}
+
+// resolveEnvRef returns the value of the environment variable, or the trimmed content of the file.
+func resolveEnvRef(kind, name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("empty %s reference", kind)
+	}
+
+	if kind == "FILE" {
+		b, err := ioutil.ReadFile(name)
+
+		if err != nil {
+			return "", fmt.Errorf("unresolvable reference ${FILE:%s}: %w", name, err)
+		}
+
+		return strings.TrimSpace(string(b)), nil
+	}
+
+	v, ok := os.LookupEnv(name)
+
+	if !ok {
+		return "", fmt.Errorf("unresolvable reference ${ENV:%s}: the environment variable is not set", name)
+	}
+
+	return v, nil
+}
@@ -0,0 +1,210 @@
+package yiigo
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml"
+	"go.uber.org/zap"
+)
+
+// envPrefix the prefix of the environment variables overriding the config, eg: YIIGO_REDIS_DEFAULT_ADDRESS
+var envPrefix = "YIIGO"
+
+// SetEnvPrefix specifies the prefix of the environment variables overriding the config, default is YIIGO, and reapplies the overrides.
+// Note: the resources of the config are initialized before main with the default prefix.
+func SetEnvPrefix(prefix string) {
+	envPrefix = prefix
+
+	env.override(os.Environ())
+}
+
+// envVarName returns the name of environment variable of the config key, eg: redis.default.address to YIIGO_REDIS_DEFAULT_ADDRESS.
+func envVarName(prefix string, keys []string) string {
+	name := strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(strings.Join(keys, "_")))
+
+	if prefix == "" {
+		return name
+	}
+
+	return strings.ToUpper(prefix) + "_" + name
+}
+
+// override overrides the values of config by the environment variables (KEY=value), the names are case-insensitive.
+// Only the existing keys are overridden, the values are coerced to the types of the keys.
+func (c *config) override(environ []string) {
+	vars := make(map[string]string)
+
+	for _, v := range environ {
+		if kv := strings.SplitN(v, "=", 2); len(kv) == 2 {
+			vars[strings.ToUpper(kv[0])] = kv[1]
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.overrides = make(map[string]string)
+
+	c.overrideTree(c.tree, nil, vars)
+
+	// file < env < flags
+	c.overrideFlags()
+
+	// eg: ${ENV:REDIS_PASSWORD} of the file or the overrides
+	c.interpolate()
+}
+
+func (c *config) overrideTree(tree *toml.Tree, path []string, vars map[string]string) {
+	for _, k := range tree.Keys() {
+		keys := append(append(make([]string, 0, len(path)+1), path...), k)
+
+		v := tree.GetPath([]string{k})
+
+		if sub, ok := v.(*toml.Tree); ok {
+			c.overrideTree(sub, keys, vars)
+
+			continue
+		}
+
+		name := envVarName(envPrefix, keys)
+
+		s, ok := vars[name]
+
+		if !ok {
+			continue
+		}
+
+		nv, err := coerceEnvValue(v, s)
+
+		if err != nil {
+			logger().Warn("yiigo: invalid config override", zap.String("name", name), zap.Error(err))
+
+			continue
+		}
+
+		tree.SetPath([]string{k}, nv)
+
+		c.overrides[strings.Join(keys, ".")] = "env " + name
+	}
+}
+
+// coerceEnvValue converts s to the type of v, the arrays are separated by comma.
+func coerceEnvValue(v interface{}, s string) (interface{}, error) {
+	switch t := v.(type) {
+	case string:
+		return s, nil
+	case int64:
+		return strconv.ParseInt(s, 10, 64)
+	case uint64:
+		return strconv.ParseUint(s, 10, 64)
+	case float64:
+		return strconv.ParseFloat(s, 64)
+	case bool:
+		return strconv.ParseBool(s)
+	case time.Time:
+		return time.Parse(time.RFC3339, s)
+	case []interface{}:
+		var elem interface{} = ""
+
+		if len(t) != 0 {
+			elem = t[0]
+		}
+
+		arr := make([]interface{}, 0)
+
+		for _, item := range strings.Split(s, ",") {
+			item = strings.TrimSpace(item)
+
+			if item == "" {
+				continue
+			}
+
+			nv, err := coerceEnvValue(elem, item)
+
+			if err != nil {
+				return nil, err
+			}
+
+			arr = append(arr, nv)
+		}
+
+		return arr, nil
+	default:
+		return nil, fmt.Errorf("yiigo: unsupported type %T to override", v)
+	}
+}
+
+// PrintEffectiveConfig writes the effective config in toml to w for debugging, the secrets (eg: password, token and the resolved references) are masked,
+// and the overridden values are commented with the layers, eg: "from env YIIGO_REDIS_DEFAULT_ADDRESS" or "from flag --yiigo.redis.default.address".
+func PrintEffectiveConfig(w io.Writer) error {
+	env.mutex.RLock()
+
+	tree, err := toml.TreeFromMap(env.tree.ToMap())
+
+	overrides := make(map[string]string, len(env.overrides))
+
+	for k, v := range env.overrides {
+		overrides[k] = v
+	}
+
+	secrets := make(map[string]bool, len(env.secrets))
+
+	for k := range env.secrets {
+		secrets[k] = true
+	}
+
+	env.mutex.RUnlock()
+
+	if err != nil {
+		return err
+	}
+
+	maskEnvTree(tree, nil, overrides, secrets)
+
+	_, err = tree.WriteTo(w)
+
+	return err
+}
+
+func maskEnvTree(tree *toml.Tree, path []string, overrides map[string]string, secrets map[string]bool) {
+	for _, k := range tree.Keys() {
+		keys := append(append(make([]string, 0, len(path)+1), path...), k)
+
+		v := tree.GetPath([]string{k})
+
+		switch t := v.(type) {
+		case *toml.Tree:
+			maskEnvTree(t, keys, overrides, secrets)
+
+			continue
+		case []*toml.Tree:
+			for _, sub := range t {
+				maskEnvTree(sub, keys, overrides, secrets)
+			}
+
+			continue
+		}
+
+		if f, ok := redactLogField(zap.Any(k, v)); ok {
+			v = f.String
+		}
+
+		// the resolved secret references
+		if secrets[strings.Join(keys, ".")] {
+			v = logRedacted
+		}
+
+		comment := ""
+
+		if layer, ok := overrides[strings.Join(keys, ".")]; ok {
+			comment = "from " + layer
+		}
+
+		tree.SetPathWithComment([]string{k}, comment, false, v)
+	}
+}
@@ -0,0 +1,81 @@
+package yiigo
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+)
+
+// envProfileSection the section of profiles, eg: [profiles.prod]
+const envProfileSection = "profiles"
+
+// ActiveProfile returns the name of the profile merged over the base config, empty for the base only.
+func ActiveProfile() string {
+	env.mutex.RLock()
+	defer env.mutex.RUnlock()
+
+	return env.profile
+}
+
+// envProfile returns the profile selected by the environment variable, eg: YIIGO_ENV=prod.
+func envProfile() string {
+	return strings.TrimSpace(os.Getenv(envVarName(envPrefix, []string{"env"})))
+}
+
+// InitWithProfile loads the config file with the profile (eg: prod) instead of YIIGO_ENV, and inits the resources of it
+// the same as yiigo.toml. The problems of config are returned together (see ValidateConfig), or the first init error.
+// The registered dbs and mongodb clients are kept, the others are replaced.
+func InitWithProfile(path, profile string) error {
+	if err := loadEnv(path, profile); err != nil {
+		return err
+	}
+
+	return initEnvConfig()
+}
+
+// applyEnvProfile deep-merges the profile over the base config, and removes the profiles section.
+// The tables are merged, the others (eg: scalars and arrays) are replaced.
+func applyEnvProfile(tree *toml.Tree, profile string) error {
+	profiles, _ := tree.Get(envProfileSection).(*toml.Tree)
+
+	if profiles != nil {
+		tree.Delete(envProfileSection)
+	}
+
+	if profile == "" {
+		return nil
+	}
+
+	var node *toml.Tree
+
+	if profiles != nil {
+		node, _ = profiles.GetPath([]string{profile}).(*toml.Tree)
+	}
+
+	if node == nil {
+		return fmt.Errorf("yiigo: unknown profile %s", profile)
+	}
+
+	mergeEnvTree(tree, node)
+
+	return nil
+}
+
+// mergeEnvTree merges src into dst, the tables are merged recursively and the others are replaced.
+func mergeEnvTree(dst, src *toml.Tree) {
+	for _, k := range src.Keys() {
+		v := src.GetPath([]string{k})
+
+		if st, ok := v.(*toml.Tree); ok {
+			if dt, ok := dst.GetPath([]string{k}).(*toml.Tree); ok {
+				mergeEnvTree(dt, st)
+
+				continue
+			}
+		}
+
+		dst.SetPath([]string{k}, v)
+	}
+}
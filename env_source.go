@@ -0,0 +1,629 @@
+package yiigo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ConfigSource the source of config, eg: the file, an HTTP(S) URL or consul KV.
+type ConfigSource interface {
+	// Load returns the content and format (toml, yaml or json) of config.
+	Load() ([]byte, string, error)
+	// Watch calls onChange with the new content when the config is changed, it watches in background.
+	Watch(onChange func([]byte))
+}
+
+// ErrConfigSourceNil returned when the config source is nil.
+var ErrConfigSourceNil = errors.New("yiigo: config source is nil")
+
+var (
+	// configSourceRetries the attempts to load a config source
+	configSourceRetries = 3
+	// configSourceRetryBackoff the backoff between the attempts, doubled on each attempt
+	configSourceRetryBackoff = time.Second
+)
+
+var (
+	envChangeFuncs []func()
+	envChangeMutex sync.RWMutex
+)
+
+// OnEnvChange registers fn called after the config is reloaded by the watched source, eg: to read the new values by Env.
+// Note: the registered resources (eg: redis pools) are not reinitialized.
+func OnEnvChange(fn func()) {
+	envChangeMutex.Lock()
+	defer envChangeMutex.Unlock()
+
+	envChangeFuncs = append(envChangeFuncs, fn)
+}
+
+func notifyEnvChange() {
+	envChangeMutex.RLock()
+	fns := envChangeFuncs
+	envChangeMutex.RUnlock()
+
+	for _, fn := range fns {
+		fn()
+	}
+}
+
+// LoadEnvFromSource loads the config from src with retries, and reloads it when src is changed (see OnEnvChange).
+// The profile of YIIGO_ENV is merged over the base config, and the values are overridden by the environment variables then.
+func LoadEnvFromSource(src ConfigSource) error {
+	if src == nil {
+		return ErrConfigSourceNil
+	}
+
+	b, format, err := loadConfigSource(src)
+
+	if err != nil {
+		return err
+	}
+
+	profile := envProfile()
+
+	if err = setEnvBytes(b, format, profile); err != nil {
+		return err
+	}
+
+	src.Watch(func(b []byte) {
+		if err := setEnvBytes(b, format, profile); err != nil {
+			logger().Error("yiigo: config reload error", zap.Error(err))
+
+			return
+		}
+
+		logger().Info("yiigo: config is reloaded")
+
+		notifyEnvChange()
+	})
+
+	return nil
+}
+
+// InitWithSource loads the config from src (see LoadEnvFromSource) instead of yiigo.toml, and inits the resources of it
+// the same as yiigo.toml. The problems of config are returned together (see ValidateConfig), or the first init error.
+// The registered dbs and mongodb clients are kept, the others are replaced.
+func InitWithSource(src ConfigSource) error {
+	if err := LoadEnvFromSource(src); err != nil {
+		return err
+	}
+
+	return initEnvConfig()
+}
+
+// loadConfigSource loads the config source with retries, the backoff is doubled on each attempt.
+func loadConfigSource(src ConfigSource) ([]byte, string, error) {
+	backoff := configSourceRetryBackoff
+
+	var err error
+
+	for i := 0; i < configSourceRetries; i++ {
+		if i > 0 {
+			time.Sleep(backoff)
+
+			backoff *= 2
+		}
+
+		var (
+			b      []byte
+			format string
+		)
+
+		b, format, err = src.Load()
+
+		if err == nil {
+			return b, format, nil
+		}
+
+		logger().Warn("yiigo: config source load error", zap.Int("attempt", i+1), zap.Error(err))
+	}
+
+	return nil, "", err
+}
+
+// setEnvBytes parses the content of format, and replaces the config with it.
+func setEnvBytes(b []byte, format, profile string) error {
+	t, err := parseEnvTree(configFormatExt(format), b)
+
+	if err != nil {
+		return err
+	}
+
+	return setEnvTree(t, profile)
+}
+
+// configFormatExt returns the extension of format, eg: yaml to .yaml, the default is .toml.
+func configFormatExt(format string) string {
+	format = strings.ToLower(strings.TrimSpace(format))
+
+	switch strings.TrimPrefix(format, ".") {
+	case "yaml", "yml":
+		return ".yaml"
+	case "json":
+		return ".json"
+	}
+
+	return ".toml"
+}
+
+// configFormatOf returns the format of the path by its extension, the default is toml.
+func configFormatOf(path string) string {
+	return strings.TrimPrefix(configFormatExt(filepath.Ext(path)), ".")
+}
+
+// configSourceSetting config source setting
+type configSourceSetting struct {
+	format   string
+	interval time.Duration
+	header   http.Header
+	client   *http.Client
+}
+
+// ConfigSourceOption configures how we set up the config source
+type ConfigSourceOption interface {
+	apply(*configSourceSetting)
+}
+
+// funcConfigSourceOption implements config source option
+type funcConfigSourceOption struct {
+	f func(*configSourceSetting)
+}
+
+func (fo *funcConfigSourceOption) apply(s *configSourceSetting) {
+	fo.f(s)
+}
+
+func newFuncConfigSourceOption(f func(*configSourceSetting)) *funcConfigSourceOption {
+	return &funcConfigSourceOption{f: f}
+}
+
+// WithConfigSourceFormat specifies the format of config (toml, yaml or json), default is detected by the extension of path, URL or key.
+func WithConfigSourceFormat(format string) ConfigSourceOption {
+	return newFuncConfigSourceOption(func(s *configSourceSetting) {
+		s.format = format
+	})
+}
+
+// WithConfigSourceInterval specifies the interval to poll the source for changes, default is 30 seconds.
+// For consul KV, it's the max wait of the blocking queries.
+func WithConfigSourceInterval(d time.Duration) ConfigSourceOption {
+	return newFuncConfigSourceOption(func(s *configSourceSetting) {
+		s.interval = d
+	})
+}
+
+// WithConfigSourceHeader specifies a header of the requests, eg: Authorization.
+func WithConfigSourceHeader(key, value string) ConfigSourceOption {
+	return newFuncConfigSourceOption(func(s *configSourceSetting) {
+		s.header.Set(key, value)
+	})
+}
+
+// WithConfigSourceClient specifies the http client of the requests, default is a client with 10 seconds timeout
+// (plus the interval for consul KV).
+func WithConfigSourceClient(c *http.Client) ConfigSourceOption {
+	return newFuncConfigSourceOption(func(s *configSourceSetting) {
+		s.client = c
+	})
+}
+
+func newConfigSourceSetting(path string, options ...ConfigSourceOption) *configSourceSetting {
+	setting := &configSourceSetting{
+		interval: 30 * time.Second,
+		header:   make(http.Header),
+	}
+
+	for _, option := range options {
+		option.apply(setting)
+	}
+
+	if setting.format == "" {
+		setting.format = configFormatOf(path)
+	}
+
+	return setting
+}
+
+// configSourceWatch runs the watch loop of a source in background, the sources implement io.Closer by it to stop watching,
+// the requests of the loop carry its ctx, so that they are cancelled by Close (eg: the blocking queries of consul).
+type configSourceWatch struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newConfigSourceWatch() *configSourceWatch {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &configSourceWatch{ctx: ctx, cancel: cancel}
+}
+
+func (w *configSourceWatch) run(fn func()) {
+	w.wg.Add(1)
+
+	go func() {
+		defer w.wg.Done()
+
+		fn()
+	}()
+}
+
+// wait waits for d, false is returned when the watch is closed.
+func (w *configSourceWatch) wait(d time.Duration) bool {
+	timer := time.NewTimer(d)
+
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-w.ctx.Done():
+		return false
+	}
+}
+
+func (w *configSourceWatch) closed() bool {
+	return w.ctx.Err() != nil
+}
+
+// Close stops watching and cancels the in-flight request, and waits for the loop to exit.
+func (w *configSourceWatch) Close() error {
+	w.cancel()
+
+	w.wg.Wait()
+
+	return nil
+}
+
+// fileConfigSource the config source of a local file
+type fileConfigSource struct {
+	*configSourceWatch
+	path    string
+	setting *configSourceSetting
+}
+
+// NewFileConfigSource returns a config source of the file, it's watched by polling the modification time.
+// The returned source implements io.Closer to stop watching, the same as the others.
+func NewFileConfigSource(path string, options ...ConfigSourceOption) ConfigSource {
+	return &fileConfigSource{
+		configSourceWatch: newConfigSourceWatch(),
+		path:              path,
+		setting:           newConfigSourceSetting(path, options...),
+	}
+}
+
+func (s *fileConfigSource) Load() ([]byte, string, error) {
+	b, err := ioutil.ReadFile(s.path)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return b, s.setting.format, nil
+}
+
+func (s *fileConfigSource) Watch(onChange func([]byte)) {
+	var modTime time.Time
+
+	if fi, err := os.Stat(s.path); err == nil {
+		modTime = fi.ModTime()
+	}
+
+	s.run(func() {
+		for s.wait(s.setting.interval) {
+			fi, err := os.Stat(s.path)
+
+			if err != nil || fi.ModTime().Equal(modTime) {
+				continue
+			}
+
+			b, _, err := s.Load()
+
+			if err != nil {
+				logger().Warn("yiigo: config source load error", zap.String("path", s.path), zap.Error(err))
+
+				continue
+			}
+
+			modTime = fi.ModTime()
+
+			onChange(b)
+		}
+	})
+}
+
+// httpConfigSource the config source of an HTTP(S) URL
+type httpConfigSource struct {
+	*configSourceWatch
+	url     string
+	setting *configSourceSetting
+	client  *http.Client
+	etag    string
+	content []byte
+	mutex   sync.Mutex
+}
+
+// NewHTTPConfigSource returns a config source of the URL, it's watched by polling (with If-None-Match when ETag is responded).
+func NewHTTPConfigSource(rawURL string, options ...ConfigSourceOption) ConfigSource {
+	path := rawURL
+
+	if u, err := url.Parse(rawURL); err == nil {
+		path = u.Path
+	}
+
+	setting := newConfigSourceSetting(path, options...)
+
+	client := setting.client
+
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &httpConfigSource{
+		configSourceWatch: newConfigSourceWatch(),
+		url:               rawURL,
+		setting:           setting,
+		client:            client,
+	}
+}
+
+func (s *httpConfigSource) Load() ([]byte, string, error) {
+	b, _, err := s.fetch(false)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return b, s.setting.format, nil
+}
+
+// fetch requests the URL, changed is false when the content is not modified.
+// The request of watching (conditional) is cancelled by Close.
+func (s *httpConfigSource) fetch(conditional bool) ([]byte, bool, error) {
+	ctx := context.Background()
+
+	if conditional {
+		ctx = s.ctx
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	for k, v := range s.setting.header {
+		req.Header[k] = v
+	}
+
+	s.mutex.Lock()
+	etag, content := s.etag, s.content
+	s.mutex.Unlock()
+
+	if conditional && etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := s.client.Do(req)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return content, false, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("yiigo: config source %s error: %s", s.url, resp.Status)
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	s.mutex.Lock()
+	s.etag, s.content = resp.Header.Get("ETag"), b
+	s.mutex.Unlock()
+
+	return b, !bytes.Equal(b, content), nil
+}
+
+func (s *httpConfigSource) Watch(onChange func([]byte)) {
+	s.run(func() {
+		for s.wait(s.setting.interval) {
+			b, changed, err := s.fetch(true)
+
+			if err != nil {
+				if s.closed() {
+					return
+				}
+
+				logger().Warn("yiigo: config source load error", zap.String("url", s.url), zap.Error(err))
+
+				continue
+			}
+
+			if changed {
+				onChange(b)
+			}
+		}
+	})
+}
+
+// consulConfigSource the config source of consul KV
+type consulConfigSource struct {
+	*configSourceWatch
+	address string
+	key     string
+	setting *configSourceSetting
+	client  *http.Client
+	index   uint64
+	content []byte
+	mutex   sync.Mutex
+}
+
+// NewConsulConfigSource returns a config source of the consul KV key (eg: config/app.toml) at address (eg: http://127.0.0.1:8500),
+// it's watched by the blocking queries. Specify the ACL token by WithConfigSourceHeader("X-Consul-Token", token).
+func NewConsulConfigSource(address, key string, options ...ConfigSourceOption) ConfigSource {
+	setting := newConfigSourceSetting(key, options...)
+
+	client := setting.client
+
+	if client == nil {
+		client = &http.Client{Timeout: 10*time.Second + setting.interval}
+	}
+
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+
+	return &consulConfigSource{
+		configSourceWatch: newConfigSourceWatch(),
+		address:           strings.TrimRight(address, "/"),
+		key:               strings.TrimLeft(key, "/"),
+		setting:           setting,
+		client:            client,
+	}
+}
+
+func (s *consulConfigSource) Load() ([]byte, string, error) {
+	b, _, err := s.fetch(false)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return b, s.setting.format, nil
+}
+
+// fetch gets the value of key, it blocks until the index is changed or the wait is timeout when blocking.
+// The blocking query is cancelled by Close.
+func (s *consulConfigSource) fetch(blocking bool) ([]byte, bool, error) {
+	ctx := context.Background()
+
+	if blocking {
+		ctx = s.ctx
+	}
+
+	s.mutex.Lock()
+	index, content := s.index, s.content
+	s.mutex.Unlock()
+
+	query := url.Values{}
+
+	query.Set("raw", "")
+
+	if blocking && index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", s.setting.interval.String())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/v1/kv/%s?%s", s.address, s.key, query.Encode()), nil)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	for k, v := range s.setting.header {
+		req.Header[k] = v
+	}
+
+	resp, err := s.client.Do(req)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, false, fmt.Errorf("yiigo: consul key %s not found", s.key)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("yiigo: consul key %s error: %s", s.key, resp.Status)
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	newIndex, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+
+	// the index goes backwards, eg: the consul is restored, resets it
+	if newIndex < index {
+		newIndex = 0
+	}
+
+	s.mutex.Lock()
+	s.index, s.content = newIndex, b
+	s.mutex.Unlock()
+
+	return b, !bytes.Equal(b, content), nil
+}
+
+func (s *consulConfigSource) Watch(onChange func([]byte)) {
+	retryBackoff := configSourceRetryBackoff
+
+	s.run(func() {
+		backoff := retryBackoff
+
+		for {
+			s.mutex.Lock()
+			blocking := s.index > 0
+			s.mutex.Unlock()
+
+			b, changed, err := s.fetch(true)
+
+			if err != nil {
+				if s.closed() {
+					return
+				}
+
+				logger().Warn("yiigo: config source load error", zap.String("key", s.key), zap.Error(err))
+
+				if !s.wait(backoff) {
+					return
+				}
+
+				if backoff *= 2; backoff > time.Minute {
+					backoff = time.Minute
+				}
+
+				continue
+			}
+
+			backoff = retryBackoff
+
+			if changed {
+				onChange(b)
+			}
+
+			// polls when the index is not responded
+			if s.closed() || (!blocking && !s.wait(s.setting.interval)) {
+				return
+			}
+		}
+	})
+}
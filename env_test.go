@@ -1,9 +1,23 @@
 package yiigo
 
 import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/pelletier/go-toml"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -150,3 +164,875 @@ func Test_env_Unmarshal(t *testing.T) {
 
 	assert.Nil(t, Env("app").Unmarshal(&App{}))
 }
+
+func TestEnvFormats(t *testing.T) {
+	contents := map[string]string{
+		".toml": `
+[app]
+name = "yiigo"
+timeout = "10s"
+retry = 3
+weight = 0.5
+
+[app.http]
+port = 8080
+
+[[app.servers]]
+host = "10.0.0.1"
+port = 80
+
+[[app.servers]]
+host = "10.0.0.2"
+port = 81
+
+[redis.default]
+address = "127.0.0.1:6379"
+
+[redis.cache]
+address = "127.0.0.1:6380"
+pool_size = 20
+`,
+		".yaml": `
+app:
+  name: yiigo
+  timeout: 10s
+  retry: 3
+  weight: 0.5
+  http:
+    port: 8080
+  servers:
+    - host: 10.0.0.1
+      port: 80
+    - host: 10.0.0.2
+      port: 81
+redis:
+  default:
+    address: 127.0.0.1:6379
+  cache:
+    address: 127.0.0.1:6380
+    pool_size: 20
+`,
+		".json": `{
+  "app": {
+    "name": "yiigo",
+    "timeout": "10s",
+    "retry": 3,
+    "weight": 0.5,
+    "http": {"port": 8080},
+    "servers": [{"host": "10.0.0.1", "port": 80}, {"host": "10.0.0.2", "port": 81}]
+  },
+  "redis": {
+    "default": {"address": "127.0.0.1:6379"},
+    "cache": {"address": "127.0.0.1:6380", "pool_size": 20}
+  }
+}`,
+	}
+
+	dir, err := ioutil.TempDir("", "yiigo")
+
+	assert.Nil(t, err)
+
+	defer os.RemoveAll(dir)
+
+	defaultTree := env.tree
+
+	defer func() {
+		env.tree = defaultTree
+	}()
+
+	for ext, content := range contents {
+		path := filepath.Join(dir, "yiigo"+ext)
+
+		assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0644))
+
+		tree, err := loadEnvTree(path)
+
+		assert.Nil(t, err, ext)
+
+		env.tree = tree
+
+		assert.Equal(t, "yiigo", Env("app.name").String(), ext)
+		assert.Equal(t, 10*time.Second, Env("app.timeout").Duration(), ext)
+		assert.Equal(t, 3*time.Second, Env("app.retry").Duration(), ext)
+		assert.Equal(t, 3, Env("app.retry").Int(), ext)
+		assert.Equal(t, 0.5, Env("app.weight").Float64(), ext)
+		assert.Equal(t, 8080, Env("app.http.port").Int(), ext)
+
+		app := new(struct {
+			Servers []struct {
+				Host string `toml:"host"`
+				Port int    `toml:"port"`
+			} `toml:"servers"`
+		})
+
+		assert.Nil(t, Env("app").Unmarshal(app), ext)
+		assert.Equal(t, 2, len(app.Servers), ext)
+		assert.Equal(t, "10.0.0.2", app.Servers[1].Host, ext)
+		assert.Equal(t, 81, app.Servers[1].Port, ext)
+
+		cfg := new(RedisPoolConfig)
+
+		assert.Nil(t, Env("redis.cache").Unmarshal(cfg), ext)
+		assert.Equal(t, "127.0.0.1:6380", cfg.Address, ext)
+		assert.Equal(t, 20, cfg.PoolSize, ext)
+		assert.Equal(t, 2, len(Env("redis").Map()), ext)
+	}
+
+	_, err = parseEnvTree(".json", []byte(`[1, 2]`))
+
+	assert.NotNil(t, err)
+}
+
+func TestEnvOverride(t *testing.T) {
+	tree, err := toml.Load(`
+[app]
+debug = true
+timeout = "10s"
+ports = [80, 81]
+
+[redis.default]
+address = "127.0.0.1:6379"
+password = "secret"
+pool_size = 10
+`)
+
+	assert.Nil(t, err)
+
+	defaultEnv := env
+
+	env = &config{tree: tree}
+
+	defer func() {
+		env = defaultEnv
+	}()
+
+	env.override([]string{
+		"YIIGO_REDIS_DEFAULT_ADDRESS=10.0.0.1:6379",
+		"yiigo_redis_default_pool_size=20",
+		"YIIGO_APP_DEBUG=false",
+		"YIIGO_APP_TIMEOUT=1m",
+		"YIIGO_APP_PORTS=8080, 8081",
+		"YIIGO_REDIS_DEFAULT_PASSWORD=hunter2",
+		// not exists in the config
+		"YIIGO_REDIS_DEFAULT_DATABASE=1",
+		// invalid int, keeps the config
+		"YIIGO_REDIS_CACHE_POOL_SIZE=x",
+	})
+
+	assert.Equal(t, "10.0.0.1:6379", Env("redis.default.address").String())
+	assert.Equal(t, 20, Env("redis.default.pool_size").Int())
+	assert.False(t, Env("app.debug").Bool(true))
+	assert.Equal(t, time.Minute, Env("app.timeout").Duration())
+	assert.Equal(t, []int{8080, 8081}, Env("app.ports").Ints())
+	assert.Nil(t, Env("redis.default.database").value)
+
+	cfg := new(RedisPoolConfig)
+
+	assert.Nil(t, Env("redis.default").Unmarshal(cfg))
+	assert.Equal(t, 20, cfg.PoolSize)
+
+	env.override([]string{"YIIGO_REDIS_DEFAULT_POOL_SIZE=x"})
+
+	// the invalid value is ignored
+	assert.Equal(t, 20, Env("redis.default.pool_size").Int())
+
+	buf := new(bytes.Buffer)
+
+	assert.Nil(t, PrintEffectiveConfig(buf))
+	assert.NotContains(t, buf.String(), "hunter2")
+	assert.Contains(t, buf.String(), `password = "***"`)
+
+	// the custom prefix
+	os.Setenv("APP_REDIS_DEFAULT_ADDRESS", "10.0.0.2:6379")
+
+	defer os.Unsetenv("APP_REDIS_DEFAULT_ADDRESS")
+
+	SetEnvPrefix("app")
+
+	defer func() {
+		envPrefix = "YIIGO"
+	}()
+
+	assert.Equal(t, "10.0.0.2:6379", Env("redis.default.address").String())
+
+	buf.Reset()
+
+	assert.Nil(t, PrintEffectiveConfig(buf))
+	assert.Contains(t, buf.String(), "# from env APP_REDIS_DEFAULT_ADDRESS")
+	assert.Contains(t, buf.String(), `address = "10.0.0.2:6379"`)
+}
+
+func TestEnvProfile(t *testing.T) {
+	tree, err := toml.Load(`
+[app]
+env = "dev"
+debug = true
+ports = [80, 81]
+
+[redis.default]
+address = "127.0.0.1:6379"
+pool_size = 10
+
+[redis.default.tls]
+enable = false
+ca = "ca.pem"
+
+[profiles.prod.app]
+debug = false
+ports = [8080]
+
+[profiles.prod.redis.default]
+address = "10.0.0.1:6379"
+
+[profiles.prod.redis.default.tls]
+enable = true
+
+[profiles.prod.redis.cache]
+address = "10.0.0.2:6379"
+
+[profiles.empty]
+`)
+
+	assert.Nil(t, err)
+
+	assert.Nil(t, applyEnvProfile(tree, "prod"))
+
+	// scalars replace
+	assert.Equal(t, false, tree.Get("app.debug"))
+	assert.Equal(t, "10.0.0.1:6379", tree.Get("redis.default.address"))
+	// arrays replace
+	assert.Equal(t, []interface{}{int64(8080)}, tree.Get("app.ports"))
+	// tables merge
+	assert.Equal(t, "dev", tree.Get("app.env"))
+	assert.Equal(t, int64(10), tree.Get("redis.default.pool_size"))
+	assert.Equal(t, true, tree.Get("redis.default.tls.enable"))
+	assert.Equal(t, "ca.pem", tree.Get("redis.default.tls.ca"))
+	// tables added
+	assert.Equal(t, "10.0.0.2:6379", tree.Get("redis.cache.address"))
+	// the profiles are removed
+	assert.False(t, tree.Has("profiles"))
+
+	tree, err = toml.Load(`
+[app]
+debug = true
+
+[profiles.test]
+app = "replaced"
+`)
+
+	assert.Nil(t, err)
+
+	// the scalar replaces the table
+	assert.Nil(t, applyEnvProfile(tree, "test"))
+	assert.Equal(t, "replaced", tree.Get("app"))
+
+	tree, err = toml.Load(`
+[app]
+debug = true
+
+[profiles.prod.app]
+debug = false
+`)
+
+	assert.Nil(t, err)
+
+	assert.Equal(t, "yiigo: unknown profile staging", applyEnvProfile(tree, "staging").Error())
+
+	// the base only
+	assert.Nil(t, applyEnvProfile(tree, ""))
+	assert.Equal(t, true, tree.Get("app.debug"))
+	assert.False(t, tree.Has("profiles"))
+}
+
+func TestInitWithProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yiigo")
+
+	assert.Nil(t, err)
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.toml")
+
+	err = ioutil.WriteFile(path, []byte(`
+[app]
+debug = false
+
+[db.profile_base]
+driver = "sqlite3"
+dsn = ":memory:"
+
+[profiles.prod.db.profile_prod]
+driver = "sqlite3"
+dsn = ":memory:"
+`), 0644)
+
+	assert.Nil(t, err)
+
+	defaultEnv := env
+	defaultDebug := isDebug()
+
+	env = &config{tree: defaultEnv.tree}
+
+	defer func() {
+		env = defaultEnv
+		setDebug(defaultDebug)
+	}()
+
+	assert.Equal(t, "", ActiveProfile())
+
+	assert.NotNil(t, InitWithProfile(path, "staging"))
+
+	assert.Nil(t, InitWithProfile(path, "prod"))
+	assert.Equal(t, "prod", ActiveProfile())
+
+	_, err = DBE("profile_base")
+	assert.Nil(t, err)
+
+	_, err = DBE("profile_prod")
+	assert.Nil(t, err)
+
+	// selected by YIIGO_ENV
+	os.Setenv("YIIGO_ENV", "prod")
+
+	defer os.Unsetenv("YIIGO_ENV")
+
+	LoadEnvFromFile(path)
+
+	assert.Equal(t, "prod", ActiveProfile())
+	assert.Equal(t, ":memory:", Env("db.profile_prod.dsn").String())
+}
+
+func TestEnvGetters(t *testing.T) {
+	tree, err := toml.Load(`
+[app]
+name = "svc"
+workers = 8
+port = "8080"
+debug = "true"
+verbose = 1
+ratio = 0.5
+threshold = "0.25"
+timeout = "500ms"
+interval = 2
+hosts = ["a", "b"]
+ports = [80, 81]
+tags = "x, y"
+start = "2024-05-01"
+born = 2024-05-01T00:00:00Z
+
+[app.nested]
+key = "value"
+`)
+
+	assert.Nil(t, err)
+
+	defaultEnv := env
+
+	env = &config{tree: tree}
+
+	defer func() {
+		env = defaultEnv
+	}()
+
+	assert.Equal(t, "svc", EnvString("app.name", "foo"))
+	assert.Equal(t, "8", EnvString("app.workers", ""))
+	assert.Equal(t, "foo", EnvString("app.missing", "foo"))
+	assert.Equal(t, "foo", EnvString("app.nested", "foo"))
+
+	assert.Equal(t, 8, EnvInt("app.workers", 4))
+	assert.Equal(t, 8080, EnvInt("app.port", 80))
+	assert.Equal(t, 4, EnvInt("app.missing", 4))
+	assert.Equal(t, 4, EnvInt("app.name", 4))
+	assert.Equal(t, 4, EnvInt("app.ratio", 4))
+
+	assert.True(t, EnvBool("app.debug", false))
+	assert.True(t, EnvBool("app.verbose", false))
+	assert.True(t, EnvBool("app.missing", true))
+	assert.False(t, EnvBool("app.workers", false))
+
+	assert.Equal(t, 0.5, EnvFloat64("app.ratio", 1))
+	assert.Equal(t, 0.25, EnvFloat64("app.threshold", 1))
+	assert.Equal(t, float64(8), EnvFloat64("app.workers", 1))
+	assert.Equal(t, float64(1), EnvFloat64("app.name", 1))
+
+	assert.Equal(t, 500*time.Millisecond, EnvDuration("app.timeout", time.Second))
+	assert.Equal(t, 2*time.Second, EnvDuration("app.interval", time.Second))
+	assert.Equal(t, time.Second, EnvDuration("app.name", time.Second))
+	assert.Equal(t, time.Second, EnvDuration("app.missing", time.Second))
+
+	assert.Equal(t, []string{"a", "b"}, EnvStrings("app.hosts", nil))
+	assert.Equal(t, []string{"80", "81"}, EnvStrings("app.ports", nil))
+	assert.Equal(t, []string{"x", "y"}, EnvStrings("app.tags", nil))
+	assert.Equal(t, []string{"z"}, EnvStrings("app.missing", []string{"z"}))
+	assert.Equal(t, []string{"z"}, EnvStrings("app.workers", []string{"z"}))
+
+	born := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, born, EnvTime("app.start", "2006-01-02", time.Time{}))
+	assert.True(t, born.Equal(EnvTime("app.born", time.RFC3339, time.Time{})))
+	assert.Equal(t, born, EnvTime("app.name", "2006-01-02", born))
+	assert.Equal(t, born, EnvTime("app.missing", "2006-01-02", born))
+}
+
+type testAppConfig struct {
+	Name     string        `config:"name"`
+	Workers  int           `config:"workers"`
+	MaxConns uint16        // max_conns
+	Ratio    float64       `config:"ratio"`
+	Timeout  time.Duration `config:"timeout"`
+	Interval time.Duration `config:"interval"`
+	Hosts    []string      `config:"hosts"`
+	Ignored  string        `config:"-"`
+	DB       testDBConfig  `config:"db"`
+	Cache    *testDBConfig `config:"cache"`
+	Queue    *testDBConfig `config:"queue"`
+	Backends []testBackend `config:"backends"`
+	Labels   map[string]string
+	Extra    interface{} `config:"extra"`
+	Size     ByteSize    `config:"size"`
+	testEmbedded
+}
+
+type testEmbedded struct {
+	Region string `config:"region"`
+}
+
+type testDBConfig struct {
+	DSN  string `config:"dsn"`
+	Pool struct {
+		Size int `config:"size"`
+	} `config:"pool"`
+}
+
+type testBackend struct {
+	Addr   string `config:"addr"`
+	Weight int    `config:"weight"`
+}
+
+func TestUnmarshalKey(t *testing.T) {
+	tree, err := toml.Load(`
+[app]
+name = "svc"
+workers = 8
+max_conns = 100
+ratio = 1
+timeout = "500ms"
+interval = 2
+hosts = ["a", "b"]
+region = "cn"
+extra = [1, 2]
+size = "1MB"
+
+[app.db]
+dsn = "mysql://localhost"
+
+[app.db.pool]
+size = 10
+
+[app.cache]
+dsn = "redis://localhost"
+
+[app.labels]
+env = "prod"
+
+[[app.backends]]
+addr = "10.0.0.1"
+weight = 1
+
+[[app.backends]]
+addr = "10.0.0.2"
+weight = 2
+
+[typo]
+name = "svc"
+wokers = 8
+ignored = "x"
+
+[typo.db]
+dnn = "x"
+
+[bad]
+workers = "8"
+`)
+
+	assert.Nil(t, err)
+
+	defaultEnv := env
+
+	env = &config{tree: tree}
+
+	defer func() {
+		env = defaultEnv
+	}()
+
+	cfg := new(testAppConfig)
+
+	assert.Nil(t, UnmarshalKey("app", cfg, WithUnmarshalStrict()))
+	assert.Equal(t, "svc", cfg.Name)
+	assert.Equal(t, 8, cfg.Workers)
+	assert.Equal(t, uint16(100), cfg.MaxConns)
+	assert.Equal(t, float64(1), cfg.Ratio)
+	assert.Equal(t, 500*time.Millisecond, cfg.Timeout)
+	assert.Equal(t, 2*time.Second, cfg.Interval)
+	assert.Equal(t, []string{"a", "b"}, cfg.Hosts)
+	assert.Equal(t, "cn", cfg.Region)
+	assert.Equal(t, "mysql://localhost", cfg.DB.DSN)
+	assert.Equal(t, 10, cfg.DB.Pool.Size)
+	assert.Equal(t, "redis://localhost", cfg.Cache.DSN)
+	// the missing optional section
+	assert.Nil(t, cfg.Queue)
+	assert.Equal(t, []testBackend{{Addr: "10.0.0.1", Weight: 1}, {Addr: "10.0.0.2", Weight: 2}}, cfg.Backends)
+	assert.Equal(t, map[string]string{"env": "prod"}, cfg.Labels)
+	assert.Equal(t, []interface{}{int64(1), int64(2)}, cfg.Extra)
+	assert.Equal(t, MiB, cfg.Size)
+
+	// the unknown keys are ignored by default
+	cfg = new(testAppConfig)
+
+	assert.Nil(t, UnmarshalKey("typo", cfg))
+	assert.Equal(t, "svc", cfg.Name)
+	assert.Equal(t, 0, cfg.Workers)
+	assert.Equal(t, "", cfg.Ignored)
+
+	err = UnmarshalKey("typo", new(testAppConfig), WithUnmarshalStrict())
+	assert.Equal(t, "yiigo: unknown config keys: typo.db.dnn, typo.ignored, typo.wokers", err.Error())
+
+	err = UnmarshalKey("bad", new(testAppConfig))
+	assert.Equal(t, "yiigo: config bad.workers expects int, got string", err.Error())
+
+	assert.Equal(t, ErrConfigNil, UnmarshalKey("missing", new(testAppConfig)))
+	assert.NotNil(t, UnmarshalKey("app", testAppConfig{}))
+
+	m := make(map[string]interface{})
+
+	assert.Nil(t, UnmarshalKey("app.labels", &m))
+	assert.Equal(t, map[string]interface{}{"env": "prod"}, m)
+}
+
+func TestHTTPConfigSource(t *testing.T) {
+	var (
+		content  atomic.Value
+		requests int32
+	)
+
+	content.Store(`[app]
+name = "v1"`)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// fails the first request for the retry
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+
+		s := content.Load().(string)
+		etag := fmt.Sprintf(`"%d"`, len(s))
+
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+
+			return
+		}
+
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(s))
+	}))
+
+	defaultEnv := env
+	defaultBackoff := configSourceRetryBackoff
+
+	env = &config{tree: defaultEnv.tree}
+	configSourceRetryBackoff = 10 * time.Millisecond
+
+	defer func() {
+		env = defaultEnv
+		configSourceRetryBackoff = defaultBackoff
+	}()
+
+	defer server.Close()
+
+	changes := make(chan string, 10)
+
+	OnEnvChange(func() {
+		select {
+		case changes <- Env("app.name").String():
+		default:
+		}
+	})
+
+	src := NewHTTPConfigSource(server.URL+"/app.toml", WithConfigSourceInterval(20*time.Millisecond), WithConfigSourceHeader("Authorization", "Bearer token"))
+
+	assert.Nil(t, LoadEnvFromSource(src))
+	assert.Equal(t, "v1", Env("app.name").String())
+
+	defer src.(io.Closer).Close()
+
+	content.Store(`[app]
+name = "v2.0"`)
+
+	select {
+	case v := <-changes:
+		assert.Equal(t, "v2.0", v)
+	case <-time.After(5 * time.Second):
+		t.Fatal("config is not reloaded")
+	}
+
+	assert.Equal(t, ErrConfigSourceNil, LoadEnvFromSource(nil))
+}
+
+func TestConsulConfigSource(t *testing.T) {
+	var (
+		mutex   sync.Mutex
+		index   = 10
+		content = "app:\n  name: v1\n"
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/kv/config/app.yaml" {
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		assert.Equal(t, "acl", r.Header.Get("X-Consul-Token"))
+
+		// the blocking query returns when the index is changed or timeout
+		if v := r.URL.Query().Get("index"); v != "" {
+			wait, _ := time.ParseDuration(r.URL.Query().Get("wait"))
+
+			for deadline := time.Now().Add(wait); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+				mutex.Lock()
+				changed := strconv.Itoa(index) != v
+				mutex.Unlock()
+
+				if changed || r.Context().Err() != nil {
+					break
+				}
+			}
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		w.Header().Set("X-Consul-Index", strconv.Itoa(index))
+		w.Write([]byte(content))
+	}))
+
+	defaultEnv := env
+
+	env = &config{tree: defaultEnv.tree}
+
+	defer func() {
+		env = defaultEnv
+	}()
+
+	defer server.Close()
+
+	changes := make(chan string, 10)
+
+	OnEnvChange(func() {
+		select {
+		case changes <- Env("app.name").String():
+		default:
+		}
+	})
+
+	_, _, err := NewConsulConfigSource(server.URL, "config/missing.toml").Load()
+	assert.Equal(t, "yiigo: consul key config/missing.toml not found", err.Error())
+
+	src := NewConsulConfigSource(server.URL, "/config/app.yaml", WithConfigSourceInterval(100*time.Millisecond), WithConfigSourceHeader("X-Consul-Token", "acl"))
+
+	assert.Nil(t, LoadEnvFromSource(src))
+	assert.Equal(t, "v1", Env("app.name").String())
+
+	defer src.(io.Closer).Close()
+
+	mutex.Lock()
+	index++
+	content = "app:\n  name: v2\n"
+	mutex.Unlock()
+
+	select {
+	case v := <-changes:
+		assert.Equal(t, "v2", v)
+	case <-time.After(5 * time.Second):
+		t.Fatal("config is not reloaded")
+	}
+
+	// Close cancels the in-flight blocking query
+	blocking := NewConsulConfigSource(server.URL, "config/app.yaml", WithConfigSourceInterval(time.Minute), WithConfigSourceHeader("X-Consul-Token", "acl"))
+
+	_, _, err = blocking.Load()
+
+	assert.Nil(t, err)
+
+	blocking.Watch(func([]byte) {})
+
+	time.Sleep(50 * time.Millisecond)
+
+	start := time.Now()
+
+	assert.Nil(t, blocking.(io.Closer).Close())
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestEnvInterpolation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yiigo")
+
+	assert.Nil(t, err)
+
+	defer os.RemoveAll(dir)
+
+	pwFile := filepath.Join(dir, "redis_pw")
+
+	assert.Nil(t, ioutil.WriteFile(pwFile, []byte("s3cr3t\n"), 0600))
+
+	os.Setenv("YIIGO_TEST_DB_USER", "admin")
+	os.Setenv("YIIGO_TEST_DB_PASS", "hunter2")
+
+	defer os.Unsetenv("YIIGO_TEST_DB_USER")
+	defer os.Unsetenv("YIIGO_TEST_DB_PASS")
+
+	tree, err := toml.Load(fmt.Sprintf(`
+[app]
+hosts = ["${ENV:YIIGO_TEST_DB_USER}", "127.0.0.1"]
+plain = "$HOME{x}"
+
+[db.default]
+driver = "mysql"
+dsn = "${ENV:YIIGO_TEST_DB_USER}:${ENV:YIIGO_TEST_DB_PASS}@tcp(localhost:3306)/test"
+
+[redis.default]
+address = "127.0.0.1:6379"
+password = "${FILE:%s}"
+
+[redis.cache]
+address = "127.0.0.1:6379"
+password = "${ENV:YIIGO_TEST_MISSING}"
+username = "${FILE:%s}"
+`, pwFile, filepath.Join(dir, "missing")))
+
+	assert.Nil(t, err)
+
+	defaultEnv := env
+
+	env = &config{tree: tree}
+
+	defer func() {
+		env = defaultEnv
+	}()
+
+	env.override(nil)
+
+	assert.Equal(t, "admin:hunter2@tcp(localhost:3306)/test", Env("db.default.dsn").String())
+	assert.Equal(t, "s3cr3t", Env("redis.default.password").String())
+	assert.Equal(t, []string{"admin", "127.0.0.1"}, Env("app.hosts").Strings())
+	assert.Equal(t, "$HOME{x}", Env("app.plain").String())
+	// the unresolvable references are kept
+	assert.Equal(t, "${ENV:YIIGO_TEST_MISSING}", Env("redis.cache.password").String())
+
+	err = ValidateConfig()
+
+	var errs ConfigErrors
+
+	assert.True(t, errors.As(err, &errs))
+	assert.Equal(t, 2, len(errs))
+	assert.Contains(t, err.Error(), "redis.cache.password: unresolvable reference ${ENV:YIIGO_TEST_MISSING}")
+	assert.Contains(t, err.Error(), "redis.cache.username: unresolvable reference ${FILE:")
+
+	buf := new(bytes.Buffer)
+
+	assert.Nil(t, PrintEffectiveConfig(buf))
+	assert.NotContains(t, buf.String(), "hunter2")
+	assert.NotContains(t, buf.String(), "s3cr3t")
+	assert.NotContains(t, buf.String(), "admin")
+	assert.Contains(t, buf.String(), `dsn = "***"`)
+}
+
+func TestBindFlags(t *testing.T) {
+	tree, err := toml.Load(`
+[app]
+debug = false
+ports = [80]
+
+[redis.default]
+address = "127.0.0.1:6379"
+pool_size = 10
+`)
+
+	assert.Nil(t, err)
+
+	defaultEnv := env
+
+	env = &config{tree: tree}
+
+	defer func() {
+		env = defaultEnv
+
+		envFlagMutex.Lock()
+		envFlagValues = nil
+		envFlagMutex.Unlock()
+	}()
+
+	os.Setenv("YIIGO_REDIS_DEFAULT_ADDRESS", "10.0.0.1:6379")
+	os.Setenv("YIIGO_REDIS_DEFAULT_POOL_SIZE", "20")
+
+	defer os.Unsetenv("YIIGO_REDIS_DEFAULT_ADDRESS")
+	defer os.Unsetenv("YIIGO_REDIS_DEFAULT_POOL_SIZE")
+
+	env.override(os.Environ())
+
+	fs := flag.NewFlagSet("app", flag.ContinueOnError)
+
+	fs.SetOutput(ioutil.Discard)
+
+	BindFlags(fs)
+
+	assert.NotNil(t, fs.Lookup("yiigo.redis.default.address"))
+	assert.NotNil(t, fs.Lookup("yiigo.set"))
+
+	err = fs.Parse([]string{
+		"--yiigo.redis.default.address=127.0.0.1:6380",
+		"--yiigo.app.debug",
+		"--yiigo.set", "app.workers=8",
+		"--yiigo.set", "app.ports=8080,8081",
+		"-yiigo.set=app.name=svc",
+		"run",
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"run"}, fs.Args())
+
+	// file < env < flags
+	assert.Equal(t, "127.0.0.1:6380", Env("redis.default.address").String())
+	assert.Equal(t, 20, Env("redis.default.pool_size").Int())
+	assert.True(t, Env("app.debug").Bool())
+	assert.Equal(t, int64(8), Env("app.workers").value)
+	assert.Equal(t, []int{8080, 8081}, Env("app.ports").Ints())
+	assert.Equal(t, "svc", Env("app.name").String())
+
+	// the flags are kept when the env vars are reapplied
+	env.override(os.Environ())
+
+	assert.Equal(t, "127.0.0.1:6380", Env("redis.default.address").String())
+
+	buf := new(bytes.Buffer)
+
+	assert.Nil(t, PrintEffectiveConfig(buf))
+	assert.Contains(t, buf.String(), "# from flag --yiigo.redis.default.address")
+	assert.Contains(t, buf.String(), "# from env YIIGO_REDIS_DEFAULT_POOL_SIZE")
+	assert.Contains(t, buf.String(), "# from flag --yiigo.set")
+
+	fs = flag.NewFlagSet("app", flag.ContinueOnError)
+
+	fs.SetOutput(ioutil.Discard)
+
+	BindFlags(fs)
+
+	assert.NotNil(t, fs.Parse([]string{"--yiigo.redis.default.pool_size=x"}))
+	assert.NotNil(t, fs.Parse([]string{"--yiigo.set", "invalid"}))
+	assert.NotNil(t, fs.Parse([]string{"--yiigo.set", "redis=x"}))
+}
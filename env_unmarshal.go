@@ -0,0 +1,392 @@
+package yiigo
+
+import (
+	"encoding"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml"
+)
+
+// unmarshalSetting unmarshal setting
+type unmarshalSetting struct {
+	strict bool
+}
+
+// UnmarshalOption configures how we unmarshal the config
+type UnmarshalOption interface {
+	apply(*unmarshalSetting)
+}
+
+// funcUnmarshalOption implements unmarshal option
+type funcUnmarshalOption struct {
+	f func(*unmarshalSetting)
+}
+
+func (fo *funcUnmarshalOption) apply(s *unmarshalSetting) {
+	fo.f(s)
+}
+
+func newFuncUnmarshalOption(f func(*unmarshalSetting)) *funcUnmarshalOption {
+	return &funcUnmarshalOption{f: f}
+}
+
+// WithUnmarshalStrict specifies to return an error for the keys not matching any field, eg: the typos.
+func WithUnmarshalStrict() UnmarshalOption {
+	return newFuncUnmarshalOption(func(s *unmarshalSetting) {
+		s.strict = true
+	})
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// UnmarshalKey decodes the config of path (eg: app, or empty for the whole config) into dest, a pointer to struct or map.
+// The keys match the fields by the tag `config:"name"` (`config:"-"` to skip), or the names case-insensitively regardless of underscores (eg: max_size to MaxSize).
+// The nested structs, slices of structs and maps are supported, the pointer fields are allocated when the keys exist, eg: for the optional sections.
+// The time.Duration is parsed by time.ParseDuration (eg: "500ms"), the number is in seconds. ErrConfigNil is returned when the path is missing.
+func UnmarshalKey(path string, dest interface{}, options ...UnmarshalOption) error {
+	rv := reflect.ValueOf(dest)
+
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("yiigo: unmarshal expects a non-nil pointer, got %T", dest)
+	}
+
+	setting := new(unmarshalSetting)
+
+	for _, option := range options {
+		option.apply(setting)
+	}
+
+	var v interface{}
+
+	if path == "" {
+		env.mutex.RLock()
+		v = env.tree
+		env.mutex.RUnlock()
+	} else {
+		v = Env(path).value
+	}
+
+	if v == nil {
+		return ErrConfigNil
+	}
+
+	if t, ok := v.(*toml.Tree); ok {
+		v = t.ToMap()
+	}
+
+	d := &configDecoder{strict: setting.strict}
+
+	if err := d.decode(path, v, rv.Elem()); err != nil {
+		return err
+	}
+
+	if len(d.unknown) != 0 {
+		sort.Strings(d.unknown)
+
+		return fmt.Errorf("yiigo: unknown config keys: %s", strings.Join(d.unknown, ", "))
+	}
+
+	return nil
+}
+
+// configDecoder decodes the config values into the go values by reflection
+type configDecoder struct {
+	strict  bool
+	unknown []string
+}
+
+func (d *configDecoder) decode(path string, v interface{}, rv reflect.Value) error {
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+
+		return d.decode(path, v, rv.Elem())
+	}
+
+	switch rv.Type() {
+	case durationType:
+		return d.decodeDuration(path, v, rv)
+	case timeType:
+		return d.decodeTime(path, v, rv)
+	}
+
+	// eg: Duration and ByteSize
+	if rv.CanAddr() && rv.Kind() != reflect.Struct && rv.Addr().Type().Implements(textUnmarshalerType) {
+		if err := rv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(fmt.Sprint(v))); err != nil {
+			return fmt.Errorf("yiigo: config %s error: %w", path, err)
+		}
+
+		return nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Interface:
+		if rv.NumMethod() != 0 {
+			return configTypeError(path, rv.Type(), v)
+		}
+
+		rv.Set(reflect.ValueOf(v))
+	case reflect.Struct:
+		m, ok := v.(map[string]interface{})
+
+		if !ok {
+			return configTypeError(path, rv.Type(), v)
+		}
+
+		return d.decodeStruct(path, m, rv)
+	case reflect.Map:
+		m, ok := v.(map[string]interface{})
+
+		if !ok || rv.Type().Key().Kind() != reflect.String {
+			return configTypeError(path, rv.Type(), v)
+		}
+
+		if rv.IsNil() {
+			rv.Set(reflect.MakeMapWithSize(rv.Type(), len(m)))
+		}
+
+		for k, item := range m {
+			elem := reflect.New(rv.Type().Elem()).Elem()
+
+			if err := d.decode(configPath(path, k), item, elem); err != nil {
+				return err
+			}
+
+			rv.SetMapIndex(reflect.ValueOf(k).Convert(rv.Type().Key()), elem)
+		}
+	case reflect.Slice:
+		items := reflect.ValueOf(v)
+
+		if items.Kind() != reflect.Slice {
+			return configTypeError(path, rv.Type(), v)
+		}
+
+		slice := reflect.MakeSlice(rv.Type(), items.Len(), items.Len())
+
+		for i := 0; i < items.Len(); i++ {
+			if err := d.decode(fmt.Sprintf("%s[%d]", path, i), items.Index(i).Interface(), slice.Index(i)); err != nil {
+				return err
+			}
+		}
+
+		rv.Set(slice)
+	case reflect.String:
+		s, ok := v.(string)
+
+		if !ok {
+			return configTypeError(path, rv.Type(), v)
+		}
+
+		rv.SetString(s)
+	case reflect.Bool:
+		b, ok := v.(bool)
+
+		if !ok {
+			return configTypeError(path, rv.Type(), v)
+		}
+
+		rv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := configInt(v)
+
+		if !ok || rv.OverflowInt(i) {
+			return configTypeError(path, rv.Type(), v)
+		}
+
+		rv.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, ok := v.(uint64)
+
+		if !ok {
+			i, isInt := configInt(v)
+
+			if !isInt || i < 0 {
+				return configTypeError(path, rv.Type(), v)
+			}
+
+			u = uint64(i)
+		}
+
+		if rv.OverflowUint(u) {
+			return configTypeError(path, rv.Type(), v)
+		}
+
+		rv.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		var f float64
+
+		switch t := v.(type) {
+		case float64:
+			f = t
+		case int64:
+			f = float64(t)
+		case uint64:
+			f = float64(t)
+		default:
+			return configTypeError(path, rv.Type(), v)
+		}
+
+		if rv.OverflowFloat(f) {
+			return configTypeError(path, rv.Type(), v)
+		}
+
+		rv.SetFloat(f)
+	default:
+		return configTypeError(path, rv.Type(), v)
+	}
+
+	return nil
+}
+
+func (d *configDecoder) decodeStruct(path string, m map[string]interface{}, rv reflect.Value) error {
+	fields := make(map[string]reflect.Value)
+
+	configFields(rv, fields)
+
+	keys := make([]string, 0, len(m))
+
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		field, ok := fields[k]
+
+		if !ok {
+			field, ok = fields[configFieldKey(k)]
+		}
+
+		if !ok {
+			if d.strict {
+				d.unknown = append(d.unknown, configPath(path, k))
+			}
+
+			continue
+		}
+
+		if err := d.decode(configPath(path, k), m[k], field); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *configDecoder) decodeDuration(path string, v interface{}, rv reflect.Value) error {
+	switch t := v.(type) {
+	case string:
+		dur, err := time.ParseDuration(t)
+
+		if err != nil {
+			return fmt.Errorf("yiigo: config %s error: %w", path, err)
+		}
+
+		rv.SetInt(int64(dur))
+	case int64:
+		rv.SetInt(int64(time.Duration(t) * time.Second))
+	case float64:
+		rv.SetInt(int64(t * float64(time.Second)))
+	default:
+		return configTypeError(path, rv.Type(), v)
+	}
+
+	return nil
+}
+
+func (d *configDecoder) decodeTime(path string, v interface{}, rv reflect.Value) error {
+	switch t := v.(type) {
+	case time.Time:
+		rv.Set(reflect.ValueOf(t))
+	case string:
+		tm, err := time.Parse(time.RFC3339, t)
+
+		if err != nil {
+			return fmt.Errorf("yiigo: config %s error: %w", path, err)
+		}
+
+		rv.Set(reflect.ValueOf(tm))
+	default:
+		return configTypeError(path, rv.Type(), v)
+	}
+
+	return nil
+}
+
+// configFields collects the settable fields of struct by the tag names and the normalized names, the embedded structs are flattened.
+func configFields(rv reflect.Value, fields map[string]reflect.Value) {
+	rt := rv.Type()
+
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+
+		tag := f.Tag.Get("config")
+
+		if tag == "-" {
+			continue
+		}
+
+		if f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct {
+			configFields(rv.Field(i), fields)
+
+			continue
+		}
+
+		// unexported
+		if f.PkgPath != "" {
+			continue
+		}
+
+		if tag != "" {
+			fields[tag] = rv.Field(i)
+
+			continue
+		}
+
+		if _, ok := fields[configFieldKey(f.Name)]; !ok {
+			fields[configFieldKey(f.Name)] = rv.Field(i)
+		}
+	}
+}
+
+// configFieldKey normalizes the name, eg: max_size and MaxSize to maxsize.
+func configFieldKey(name string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(name))
+}
+
+func configPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+// configInt returns the integer of v, the float is accepted when it's integral.
+func configInt(v interface{}) (int64, bool) {
+	switch t := v.(type) {
+	case int64:
+		return t, true
+	case uint64:
+		if t <= math.MaxInt64 {
+			return int64(t), true
+		}
+	case float64:
+		if i := int64(t); float64(i) == t {
+			return i, true
+		}
+	}
+
+	return 0, false
+}
+
+func configTypeError(path string, rt reflect.Type, v interface{}) error {
+	return fmt.Errorf("yiigo: config %s expects %s, got %T", path, rt, v)
+}
@@ -154,7 +154,7 @@ func WithHTTPProxy(proxyURL string) HTTPClientOption {
 		fixedURL, err := url.Parse(proxyURL)
 
 		if err != nil {
-			logger.Error("yiigo: parse proxy url error", zap.Error(err))
+			logger().Error("yiigo: parse proxy url error", zap.Error(err))
 
 			return
 		}
@@ -1,32 +1,123 @@
 package yiigo
 
-var debug bool
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+// debugMode the app.debug, 1 means debug mode, read by isDebug
+var debugMode int32
+
+// isDebug reports whether it's in debug mode (app.debug).
+func isDebug() bool {
+	return atomic.LoadInt32(&debugMode) == 1
+}
+
+// setDebug switches the debug mode, eg: by Init.
+func setDebug(debug bool) {
+	var v int32
+
+	if debug {
+		v = 1
+	}
+
+	atomic.StoreInt32(&debugMode, v)
+}
+
+var (
+	errorHandler func(module, name string, err error)
+	errorMutex   sync.RWMutex
+)
+
+// SetErrorHandler specifies the handler called instead of panic when a resource fails to init or is unknown,
+// eg: to retry or exit with a specific code. The module is the config section, eg: redis. A nil handler restores panic.
+// Note: the resources of yiigo.toml are initialized before main, use the E variants (eg: InitRedisE, InitDBE, InitMongoE) to handle the errors,
+// and the accessors (eg: RedisPoolE, DBE, MongoE) to handle the unknown names as errors.
+func SetErrorHandler(fn func(module, name string, err error)) {
+	errorMutex.Lock()
+	defer errorMutex.Unlock()
+
+	errorHandler = fn
+}
+
+// handleError reports the error to the error handler, false is returned when no handler specified.
+func handleError(module, name string, err error) bool {
+	errorMutex.RLock()
+	fn := errorHandler
+	errorMutex.RUnlock()
+
+	if fn == nil {
+		return false
+	}
+
+	fn(module, name, err)
+
+	return true
+}
+
+// initError the init error of a named resource
+type initError struct {
+	module string
+	name   string
+	err    error
+}
+
+func (e *initError) Error() string {
+	return fmt.Sprintf("yiigo: %s.%s init error: %s", e.module, e.name, e.err.Error())
+}
+
+func (e *initError) Unwrap() error {
+	return e.err
+}
+
+// handleInitError reports the init error to the error handler, it panics when no handler specified.
+func handleInitError(err error) {
+	var e *initError
+
+	if !errors.As(err, &e) {
+		e = &initError{err: err}
+	}
+
+	if !handleError(e.module, e.name, e.err) {
+		logger().Panic(fmt.Sprintf("yiigo: %s init error", e.module), zap.String("name", e.name), zap.Error(e.err))
+	}
+}
+
+// resourceName returns the name of the optional names, AsDefault is returned when it's empty.
+func resourceName(name []string) string {
+	if len(name) == 0 {
+		return AsDefault
+	}
+
+	return name[0]
+}
 
 func init() {
 	// init default logger
-	logger = newLogger(&logConfig{
-		Path:       "logs/app.log",
-		MaxSize:    500,
-		MaxBackups: 0,
-		MaxAge:     0,
-		Compress:   true,
-	}, false)
+	l, level, closers := newLogger("logs/app.log", newLogSetting(), false)
+
+	setBootLogger(l)
+	logLevels.Store(AsDefault, level)
+	storeLogClosers(AsDefault, l, closers)
 
 	// load env file: yiigo.toml
 	initEnv()
 
-	debug = Env("app.debug").Bool(false)
-
-	// init logger
-	initLogger()
-	// init db
-	initDB()
-	// init mongodb
-	initMongoDB()
-	// init redis
-	initRedis()
-	// init mailer
-	initMailer()
+	setDebug(Env("app.debug").Bool(false))
+
+	// init logger, db, mongodb, redis and mailer
+	initConfig()
 	// init apollo
 	initApollo()
 }
+
+// Close closes all the registered resources, eg: redis pools, for graceful shutdown.
+// The redis pools are closed concurrently, each waits at most 10s for the connections in use.
+func Close() {
+	closeAllRedis()
+	closeAllRedisCluster()
+}
@@ -0,0 +1,333 @@
+package yiigo
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pelletier/go-toml"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInitE(t *testing.T) {
+	defaultTree := env.tree
+
+	defer func() {
+		env.tree = defaultTree
+	}()
+
+	tree, err := toml.Load(`
+[db.init_bad]
+driver = "oracle"
+[mongo.init_bad]
+dsn = "mongodb://127.0.0.1:27017"
+mode = "unknown"`)
+
+	assert.Nil(t, err)
+
+	env.tree = tree
+
+	err = InitDBE()
+
+	var e *initError
+
+	assert.True(t, errors.As(err, &e))
+	assert.Equal(t, "db", e.module)
+	assert.Equal(t, "init_bad", e.name)
+	assert.Equal(t, "yiigo: db.init_bad init error: yiigo: unknown db driver oracle, expects mysql, postgres, sqlite3", err.Error())
+
+	err = InitMongoE()
+
+	assert.True(t, errors.As(err, &e))
+	assert.Equal(t, "mongodb", e.module)
+
+	tree, err = toml.Load(`
+[db.init_ok]
+driver = "sqlite3"
+dsn = ":memory:"`)
+
+	assert.Nil(t, err)
+
+	env.tree = tree
+
+	assert.Nil(t, InitDBE())
+	// the registered db is skipped
+	assert.Nil(t, InitDBE())
+
+	db, err := DBE("init_ok")
+
+	assert.Nil(t, err)
+	assert.Nil(t, db.Ping())
+
+	orm, err := OrmE("init_ok")
+
+	assert.Nil(t, err)
+	assert.NotNil(t, orm)
+}
+
+func TestRegisterDB(t *testing.T) {
+	RegisterDB("register", "sqlite3", ":memory:", WithDBMaxOpenConns(2), WithDBMaxIdleConns(1), WithDBConnMaxLifetime(time.Minute))
+
+	db := DB("register")
+
+	assert.Nil(t, db.Ping())
+	assert.Equal(t, 2, db.Stats().MaxOpenConnections)
+	assert.NotNil(t, Orm("register"))
+
+	// registered again, the old one is replaced
+	RegisterDB("register", "sqlite3", ":memory:")
+
+	assert.False(t, db == DB("register"))
+	assert.Equal(t, 0, DB("register").Stats().MaxOpenConnections)
+
+	var errs []error
+
+	SetErrorHandler(func(module, name string, err error) {
+		errs = append(errs, err)
+	})
+
+	defer SetErrorHandler(nil)
+
+	RegisterDB("register_bad", "oracle", "")
+
+	assert.Equal(t, 1, len(errs))
+	assert.EqualError(t, errs[0], "yiigo: unknown db driver oracle, expects mysql, postgres, sqlite3")
+
+	_, err := DBE("register_bad")
+
+	assert.NotNil(t, err)
+}
+
+func TestAccessorE(t *testing.T) {
+	_, err := DBE("unknown")
+	assert.Equal(t, "yiigo: unknown db.unknown (forgotten configure?)", err.Error())
+
+	_, err = OrmE("unknown")
+	assert.Equal(t, "yiigo: unknown db.unknown (forgotten configure?)", err.Error())
+
+	_, err = MongoE("unknown")
+	assert.Equal(t, "yiigo: unknown mongodb.unknown (forgotten configure?)", err.Error())
+
+	_, err = MailerE("unknown")
+	assert.Equal(t, "yiigo: unknown email.unknown (forgotten configure?)", err.Error())
+
+	_, err = LoggerE("unknown")
+	assert.Equal(t, "yiigo: unknown log.unknown (forgotten configure?)", err.Error())
+
+	var errs []string
+
+	SetErrorHandler(func(module, name string, err error) {
+		errs = append(errs, module+"."+name)
+	})
+
+	defer SetErrorHandler(nil)
+
+	assert.Nil(t, DB("unknown"))
+	assert.Nil(t, Orm("unknown"))
+	assert.Nil(t, Mongo("unknown"))
+	assert.Nil(t, Mailer("unknown"))
+	assert.Equal(t, []string{"db.unknown", "db.unknown", "mongodb.unknown", "email.unknown"}, errs)
+
+	// the strict accessors still panic without handler
+	SetErrorHandler(nil)
+
+	assert.Panics(t, func() {
+		DB("unknown")
+	})
+}
+
+func TestInit(t *testing.T) {
+	defaultDebug := isDebug()
+
+	defer func() {
+		setDebug(defaultDebug)
+	}()
+
+	err := Init(&Config{
+		DB: map[string]DBConfig{
+			"init_bad_driver": {Driver: "oracle"},
+		},
+	})
+
+	var e *initError
+
+	assert.True(t, errors.As(err, &e))
+	assert.Equal(t, "db", e.module)
+	assert.Equal(t, "init_bad_driver", e.name)
+
+	err = Init(&Config{
+		Logger: map[string]LoggerConfig{
+			"init_cfg": {Stdout: true},
+		},
+		DB: map[string]DBConfig{
+			"init_cfg": {Driver: "sqlite3", Dsn: ":memory:"},
+		},
+		EMail: map[string]EMailConfig{
+			"init_cfg": {Host: "smtp.example.com", Port: 25},
+		},
+	})
+
+	assert.Nil(t, err)
+	assert.False(t, isDebug())
+
+	l, err := LoggerE("init_cfg")
+
+	assert.Nil(t, err)
+	assert.NotNil(t, l)
+
+	db, err := DBE("init_cfg")
+
+	assert.Nil(t, err)
+	assert.Nil(t, db.Ping())
+
+	_, err = MailerE("init_cfg")
+
+	assert.Nil(t, err)
+}
+
+func TestValidateConfig(t *testing.T) {
+	defaultTree := env.tree
+
+	defer func() {
+		env.tree = defaultTree
+	}()
+
+	tree, err := toml.Load(`
+[log.default]
+level = "verbose"
+
+[db.default]
+driver = "oracle"
+
+[db.Default]
+driver = "mysql"
+dsn = "root@tcp(localhost:3306)/test"
+
+[redis.default]
+pool_size = 10
+pool_limit = 5
+
+[redis.cache]
+address = "127.0.0.1:6379"
+read_timeout = "10x"
+
+[email.default]
+host = "smtp.example.com"
+
+[mongo.default]
+dsn = "mongodb://127.0.0.1:27017"
+
+[app]
+workers = 0`)
+
+	assert.Nil(t, err)
+
+	env.tree = tree
+
+	RegisterConfigValidator("app", func(tree ConfigTree) error {
+		if tree.Get("workers").Int() <= 0 {
+			return tree.Errorf("workers should be positive")
+		}
+
+		return nil
+	})
+
+	defer func() {
+		configValidatorMutex.Lock()
+		delete(configValidators, "app")
+		configValidatorMutex.Unlock()
+	}()
+
+	err = ValidateConfig()
+
+	var errs ConfigErrors
+
+	assert.True(t, errors.As(err, &errs))
+
+	msgs := make([]string, 0, len(errs))
+
+	for _, v := range errs {
+		msgs = append(msgs, v.Error())
+	}
+
+	assert.Equal(t, []string{
+		"app: workers should be positive",
+		"db: duplicate names Default and default",
+		"db.default: unknown driver \"oracle\", expects mysql, postgres, sqlite3",
+		"db.default: dsn is required",
+		"log.default: unrecognized level: \"verbose\"",
+		"redis.cache: read_timeout: invalid duration \"10x\", expects eg: 10s, 1m30s, 250ms or the seconds",
+		"redis.default: address is required",
+		"redis.default: pool_limit (5) < pool_size (10)",
+	}, msgs)
+
+	assert.Contains(t, err.Error(), "yiigo: invalid config (8 problems): ")
+
+	tree, err = toml.Load(`
+[redis.default]
+address = "127.0.0.1:6379"`)
+
+	assert.Nil(t, err)
+
+	env.tree = tree
+
+	assert.Nil(t, ValidateConfig())
+}
+
+func TestConfigUnits(t *testing.T) {
+	tree, err := toml.Load(`
+[redis.default]
+address = "127.0.0.1:6379"
+conn_timeout = 10
+read_timeout = "1m30s"
+write_timeout = "250ms"
+
+[log.default]
+max_size = "64MB"
+
+[log.legacy]
+max_size = 100
+
+[log.bad]
+max_size = "64XB"
+`)
+
+	assert.Nil(t, err)
+
+	redisCfg := RedisPoolConfig{}
+
+	assert.Nil(t, unmarshalConfigNode(tree.Get("redis.default").(*toml.Tree), &redisCfg))
+	// the legacy seconds
+	assert.Equal(t, 10*time.Second, redisCfg.ConnTimeout.Duration())
+	assert.Equal(t, 90*time.Second, redisCfg.ReadTimeout.Duration())
+	assert.Equal(t, 250*time.Millisecond, redisCfg.WriteTimeout.Duration())
+
+	logCfg := LoggerConfig{}
+
+	assert.Nil(t, unmarshalConfigNode(tree.Get("log.default").(*toml.Tree), &logCfg))
+	assert.Equal(t, 64*MiB, logCfg.MaxSize)
+	assert.Equal(t, 64, logCfg.MaxSize.megabytes())
+
+	// the legacy MB
+	assert.Nil(t, unmarshalConfigNode(tree.Get("log.legacy").(*toml.Tree), &logCfg))
+	assert.Equal(t, 100*MiB, logCfg.MaxSize)
+
+	err = unmarshalConfigNode(tree.Get("log.bad").(*toml.Tree), &logCfg)
+	assert.Equal(t, "max_size: invalid size \"64XB\", unknown unit XB", err.Error())
+
+	var size ByteSize
+
+	for s, v := range map[string]ByteSize{"1GiB": GiB, "512K": 512 * KiB, "1.5gb": 3 * GiB / 2, "100B": 100, "2 MiB": 2 * MiB} {
+		assert.Nil(t, size.UnmarshalText([]byte(s)))
+		assert.Equal(t, v, size, s)
+	}
+
+	assert.NotNil(t, size.UnmarshalText([]byte("MB")))
+	assert.Equal(t, "1GiB", GiB.String())
+	assert.Equal(t, 1, (100 * Byte).megabytes())
+
+	var d Duration
+
+	assert.NotNil(t, d.UnmarshalText([]byte("1.5")))
+	assert.Equal(t, "1m30s", Duration(90*time.Second).String())
+}
@@ -1,7 +1,16 @@
 package yiigo
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pelletier/go-toml"
@@ -11,103 +20,880 @@ import (
 )
 
 var (
-	logger *zap.Logger
-	logMap sync.Map
+	// loggerValue holds the *zap.Logger of the internal logging, read by logger
+	loggerValue atomic.Value
+	logMap      sync.Map
+	// logLevels the levels of the registered loggers, adjustable at runtime
+	logLevels sync.Map
+	// bootLogger the logger of yiigo itself, restored by SetLogger(nil)
+	bootLogger *zap.Logger
+	// appLogger the logger specified by SetLogger, it's never overridden by yiigo
+	appLogger   *zap.Logger
+	loggerMutex sync.Mutex
+	// logStdout the stdout of WithLogStdout
+	logStdout io.Writer = os.Stdout
 )
 
-type logConfig struct {
-	Path       string `toml:"path"`
-	MaxSize    int    `toml:"max_size"`
-	MaxBackups int    `toml:"max_backups"`
-	MaxAge     int    `toml:"max_age"`
-	Compress   bool   `toml:"compress"`
+// SetLogger specifies the logger of all the internal logging (eg: redis errors, pool warnings, init panics) and Logger(),
+// so that they go to the same place as the application. A nil logger restores the default of yiigo.
+// It's never overridden by the log config of yiigo.toml, and safe to call while the resources are in use.
+func SetLogger(l *zap.Logger) {
+	loggerMutex.Lock()
+	defer loggerMutex.Unlock()
+
+	appLogger = l
+
+	if l == nil {
+		storeLogger(bootLogger)
+
+		return
+	}
+
+	// the credentials of yiigo's own logs are masked (see Secret)
+	storeLogger(l.WithOptions(zap.WrapCore(withLogRedaction)))
+}
+
+// setBootLogger sets the logger of yiigo itself, unless SetLogger is called.
+func setBootLogger(l *zap.Logger) {
+	loggerMutex.Lock()
+	defer loggerMutex.Unlock()
+
+	bootLogger = l
+
+	if appLogger == nil {
+		storeLogger(l)
+	}
+}
+
+// logger returns the logger of the internal logging, safe for concurrent use with SetLogger.
+func logger() *zap.Logger {
+	l, _ := loggerValue.Load().(*zap.Logger)
+
+	return l
+}
+
+// storeLogger replaces the logger of the internal logging.
+func storeLogger(l *zap.Logger) {
+	loggerValue.Store(l)
+}
+
+// LoggerConfig the config of logger, it's the [log.name] of yiigo.toml, or the settings of InitLogger.
+type LoggerConfig struct {
+	// Path the log file, rotated by MaxSize, MaxBackups, MaxAge and Compress (see WithLogMaxSize etc.)
+	Path       string   `toml:"path"`
+	MaxSize    ByteSize `toml:"max_size"`
+	MaxBackups int      `toml:"max_backups"`
+	MaxAge     int      `toml:"max_age"`
+	Compress   bool     `toml:"compress"`
+	// Level one of debug, info, warn and error
+	Level string `toml:"level"`
+	// Encoding json or console
+	Encoding string `toml:"encoding"`
+	// Stdout tees the entries to stdout, StdoutEncoding "console" encodes them in console format on stdout only
+	Stdout         bool   `toml:"stdout"`
+	StdoutEncoding string `toml:"stdout_encoding"`
+	// RotateDaily the pattern of the daily files, eg: logs/app-%Y-%m-%d.log
+	RotateDaily string `toml:"rotate_daily"`
+	// DisableCaller, CallerSkip and StacktraceLevel configure the caller and stacktrace (see WithLogCaller and WithLogStacktraceLevel)
+	DisableCaller   bool   `toml:"disable_caller"`
+	CallerSkip      int    `toml:"caller_skip"`
+	StacktraceLevel string `toml:"stacktrace_level"`
+	// SyslogNetwork, SyslogAddr and SyslogTag tee the entries to syslog (see WithLogSyslog), it's enabled when SyslogTag is not empty
+	SyslogNetwork string `toml:"syslog_network"`
+	SyslogAddr    string `toml:"syslog_addr"`
+	SyslogTag     string `toml:"syslog_tag"`
+}
+
+// options returns the logger options from config.
+func (c *LoggerConfig) options() ([]LoggerOption, error) {
+	options := []LoggerOption{
+		WithLogMaxSize(c.MaxSize.megabytes()),
+		WithLogMaxBackups(c.MaxBackups),
+		WithLogMaxAge(c.MaxAge),
+		WithLogCompress(c.Compress),
+	}
+
+	if c.Level != "" {
+		var level zapcore.Level
+
+		if err := level.UnmarshalText([]byte(c.Level)); err != nil {
+			return nil, err
+		}
+
+		options = append(options, WithLogLevel(level))
+	}
+
+	switch c.Encoding {
+	case "json":
+		options = append(options, WithLogJSON())
+	case "console":
+		options = append(options, WithLogConsole())
+	}
+
+	if c.Stdout {
+		options = append(options, WithLogStdout(true))
+	}
+
+	if c.StdoutEncoding == "console" {
+		options = append(options, WithLogStdoutConsole())
+	}
+
+	if c.RotateDaily != "" {
+		options = append(options, WithLogRotateDaily(c.RotateDaily))
+	}
+
+	if c.DisableCaller || c.CallerSkip != 0 {
+		options = append(options, WithLogCaller(!c.DisableCaller, c.CallerSkip))
+	}
+
+	if c.StacktraceLevel != "" {
+		options = append(options, WithLogStacktraceLevel(c.StacktraceLevel))
+	}
+
+	if c.SyslogTag != "" {
+		options = append(options, WithLogSyslog(c.SyslogNetwork, c.SyslogAddr, c.SyslogTag))
+	}
+
+	return options, nil
+}
+
+// logSetting logger setting
+type logSetting struct {
+	maxSize    int
+	maxBackups int
+	maxAge     int
+	compress   bool
+	level      zapcore.Level
+	encoding   string
+	timeEnc    zapcore.TimeEncoder
+	timeKey    string
+	levelKey   string
+	sampling   *logSampling
+	stdout     bool
+	stdoutEnc  string
+	daily      string
+	noCaller   bool
+	callerSkip int
+	// stacktrace nil means the default, warn in debug mode and none otherwise
+	stacktrace zapcore.LevelEnabler
+	syslog     *logSyslog
+	sinks      []*logRemoteSink
+}
+
+// logSampling the sampling of zapcore
+type logSampling struct {
+	initial    int
+	thereafter int
+	tick       time.Duration
+}
+
+// LoggerOption configures how we set up the logger
+type LoggerOption interface {
+	apply(*logSetting)
+}
+
+// funcLoggerOption implements logger option
+type funcLoggerOption struct {
+	f func(*logSetting)
+}
+
+func (fo *funcLoggerOption) apply(s *logSetting) {
+	fo.f(s)
+}
+
+func newFuncLoggerOption(f func(*logSetting)) *funcLoggerOption {
+	return &funcLoggerOption{f: f}
+}
+
+// WithLogMaxSize specifies the maximum size in megabytes of the log file before it gets rotated, default is 500.
+func WithLogMaxSize(mb int) LoggerOption {
+	return newFuncLoggerOption(func(s *logSetting) {
+		s.maxSize = mb
+	})
+}
+
+// WithLogMaxBackups specifies the maximum number of the rotated files to retain, 0 means retaining all (default).
+func WithLogMaxBackups(n int) LoggerOption {
+	return newFuncLoggerOption(func(s *logSetting) {
+		s.maxBackups = n
+	})
+}
+
+// WithLogMaxAge specifies the maximum number of days to retain the rotated files, 0 means not removing them by age (default).
+func WithLogMaxAge(days int) LoggerOption {
+	return newFuncLoggerOption(func(s *logSetting) {
+		s.maxAge = days
+	})
+}
+
+// WithLogCompress specifies whether the rotated files are compressed with gzip, default is true.
+func WithLogCompress(b bool) LoggerOption {
+	return newFuncLoggerOption(func(s *logSetting) {
+		s.compress = b
+	})
+}
+
+// WithLogLevel specifies the minimum enabled level of the logger, default is debug.
+func WithLogLevel(l zapcore.Level) LoggerOption {
+	return newFuncLoggerOption(func(s *logSetting) {
+		s.level = l
+	})
+}
+
+// WithLogJSON specifies to encode the entries as JSON lines, it's the default except for debug mode.
+func WithLogJSON() LoggerOption {
+	return newFuncLoggerOption(func(s *logSetting) {
+		s.encoding = "json"
+	})
+}
+
+// WithLogConsole specifies to encode the entries in human-readable console format with colored levels,
+// it's the default of debug mode.
+func WithLogConsole() LoggerOption {
+	return newFuncLoggerOption(func(s *logSetting) {
+		s.encoding = "console"
+	})
+}
+
+// WithLogTimeEncoder specifies the time format, eg: zapcore.ISO8601TimeEncoder or zapcore.EpochTimeEncoder,
+// default is MyTimeEncoder.
+func WithLogTimeEncoder(enc zapcore.TimeEncoder) LoggerOption {
+	return newFuncLoggerOption(func(s *logSetting) {
+		s.timeEnc = enc
+	})
+}
+
+// WithLogTimeKey specifies the key of time, default is "time" ("T" in debug mode).
+func WithLogTimeKey(key string) LoggerOption {
+	return newFuncLoggerOption(func(s *logSetting) {
+		s.timeKey = key
+	})
 }
 
-// newLogger returns a new logger.
-func newLogger(cfg *logConfig, debug bool) *zap.Logger {
+// WithLogLevelKey specifies the key of level, default is "level" ("L" in debug mode).
+func WithLogLevelKey(key string) LoggerOption {
+	return newFuncLoggerOption(func(s *logSetting) {
+		s.levelKey = key
+	})
+}
+
+// WithLogSampling specifies to sample the entries to survive log storms, it's off by default.
+// In each tick, the first initial entries of the same level and message are logged, then every thereafter-th one.
+func WithLogSampling(initial, thereafter int, tick time.Duration) LoggerOption {
+	return newFuncLoggerOption(func(s *logSetting) {
+		s.sampling = &logSampling{
+			initial:    initial,
+			thereafter: thereafter,
+			tick:       tick,
+		}
+	})
+}
+
+// WithLogStdout specifies whether to tee the entries to stdout in addition to the file, eg: for the collector of Kubernetes,
+// the entries go to stdout only when the path is empty. The stdout honors the same encoder and level of the file.
+func WithLogStdout(b bool) LoggerOption {
+	return newFuncLoggerOption(func(s *logSetting) {
+		s.stdout = b
+	})
+}
+
+// WithLogStdoutConsole specifies to encode the entries of stdout in console format, while the file keeps its encoding.
+func WithLogStdoutConsole() LoggerOption {
+	return newFuncLoggerOption(func(s *logSetting) {
+		s.stdoutEnc = "console"
+	})
+}
+
+// WithLogRotateDaily specifies to write one file per day named by pattern instead of path, eg: logs/app-%Y-%m-%d.log,
+// the placeholders are %Y, %y, %m, %d, %j and %%. The file is switched at local midnight, and its directory is created as needed.
+// The files older than the max age (see WithLogMaxAge) are removed, the size, backups and compress options are ignored.
+// Note: it's ignored in debug mode, the logger writes to stderr instead (see NewLogger).
+func WithLogRotateDaily(pattern string) LoggerOption {
+	return newFuncLoggerOption(func(s *logSetting) {
+		s.daily = pattern
+	})
+}
+
+// WithLogCaller specifies whether to annotate the entries with the caller, default is true,
+// skip is the number of the wrapper frames to skip, eg: 1 for the application's own logging helper, so that the caller points at its caller.
+func WithLogCaller(enabled bool, skip int) LoggerOption {
+	return newFuncLoggerOption(func(s *logSetting) {
+		s.noCaller = !enabled
+		s.callerSkip = skip
+	})
+}
+
+// WithLogStacktraceLevel specifies the minimum level (debug, info, warn, error, dpanic, panic or fatal) of the entries with stacktrace,
+// eg: panic to turn off the stacktraces of errors in production, "off" turns off them at all. The invalid level is ignored.
+func WithLogStacktraceLevel(level string) LoggerOption {
+	return newFuncLoggerOption(func(s *logSetting) {
+		if strings.ToLower(level) == "off" {
+			s.stacktrace = zap.LevelEnablerFunc(func(zapcore.Level) bool {
+				return false
+			})
+
+			return
+		}
+
+		var l zapcore.Level
+
+		if err := l.UnmarshalText([]byte(level)); err == nil {
+			s.stacktrace = l
+		}
+	})
+}
+
+// WithLogSyslog specifies to tee the entries to syslog in RFC5424 with the severity of their levels, eg: udp, 127.0.0.1:514, app,
+// the empty network means the local syslog (the unix socket of addr, or /dev/log etc.). The entries go to syslog only when the path is empty.
+// It reconnects on failure, the entries are written to stderr while the connection is down.
+func WithLogSyslog(network, addr, tag string) LoggerOption {
+	return newFuncLoggerOption(func(s *logSetting) {
+		s.syslog = &logSyslog{
+			network: network,
+			addr:    addr,
+			tag:     tag,
+		}
+	})
+}
+
+// WithLogRemoteSink specifies to tee the entries to the remote sink asynchronously, eg: Kafka or NSQ (see NewNSQLogSink),
+// they are buffered and written in batch when batchSize (default 100) entries buffered or every flushInterval (default 1s).
+// The logging is never blocked, the entries are dropped when the buffer is full or the sink is persistently failing (see LogSinkDropped).
+func WithLogRemoteSink(sink LogSink, batchSize int, flushInterval time.Duration) LoggerOption {
+	return newFuncLoggerOption(func(s *logSetting) {
+		s.sinks = append(s.sinks, &logRemoteSink{
+			sink:          sink,
+			batchSize:     batchSize,
+			flushInterval: flushInterval,
+		})
+	})
+}
+
+func newLogSetting(options ...LoggerOption) *logSetting {
+	setting := &logSetting{
+		maxSize:  500,
+		compress: true,
+		level:    zap.DebugLevel,
+		timeEnc:  MyTimeEncoder,
+	}
+
+	for _, option := range options {
+		option.apply(setting)
+	}
+
+	return setting
+}
+
+// NewLogger returns a new logger writes to the file of path (and stdout, see WithLogStdout), which is rotated by the options.
+// The rotation is safe under concurrent writes. In debug mode (app.debug), the logger writes to stderr in console format
+// instead of the files (path and RotateDaily), the syslog and remote sinks are still written.
+func NewLogger(path string, options ...LoggerOption) *zap.Logger {
+	l, _, _ := newLogger(path, newLogSetting(options...), isDebug())
+
+	return l
+}
+
+// encoderConfig applies the time format and keys to c.
+func (s *logSetting) encoderConfig(c zapcore.EncoderConfig) zapcore.EncoderConfig {
+	c.EncodeTime = s.timeEnc
+
+	if s.timeKey != "" {
+		c.TimeKey = s.timeKey
+	}
+
+	if s.levelKey != "" {
+		c.LevelKey = s.levelKey
+	}
+
+	return c
+}
+
+// sample wraps the core with sampler when the sampling is specified.
+func (s *logSetting) sample(core zapcore.Core) zapcore.Core {
+	if s.sampling == nil {
+		return core
+	}
+
+	return zapcore.NewSamplerWithOptions(core, s.sampling.tick, s.sampling.initial, s.sampling.thereafter)
+}
+
+// newLogger returns a new logger, its level and the closers of its writers (eg: files, syslog connection).
+// In debug mode, the files (path and RotateDaily) are replaced by stderr, the syslog and remote sinks are kept.
+func newLogger(path string, setting *logSetting, debug bool) (*zap.Logger, zap.AtomicLevel, []io.Closer) {
+	level := zap.NewAtomicLevelAt(setting.level)
+
 	if debug {
+		remotes, closers := setting.remoteCores(level)
+
 		cfg := zap.NewDevelopmentConfig()
 
+		cfg.Level = level
 		cfg.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
-		cfg.EncoderConfig.EncodeTime = MyTimeEncoder
 
-		l, _ := cfg.Build()
+		if setting.encoding != "" {
+			cfg.Encoding = setting.encoding
+		}
+
+		cfg.EncoderConfig = setting.encoderConfig(cfg.EncoderConfig)
+
+		cfg.DisableCaller = setting.noCaller
+
+		l, _ := cfg.Build(append(setting.zapOptions(), zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			return withLogRedaction(withLogHooks(setting.sample(zapcore.NewTee(append([]zapcore.Core{core}, remotes...)...))))
+		}))...)
 
-		return l
+		return l, level, closers
 	}
 
-	w := zapcore.AddSync(&lumberjack.Logger{
-		Filename:   cfg.Path,
-		MaxSize:    cfg.MaxSize,
-		MaxBackups: cfg.MaxBackups,
-		MaxAge:     cfg.MaxAge,
-		Compress:   cfg.Compress,
-	})
+	cores := make([]zapcore.Core, 0, 3+len(setting.sinks))
+	closers := make([]io.Closer, 0, 2+len(setting.sinks))
 
-	c := zap.NewProductionEncoderConfig()
+	if path != "" || setting.daily != "" || (!setting.stdout && setting.syslog == nil && len(setting.sinks) == 0) {
+		var w zapcore.WriteSyncer
 
-	c.TimeKey = "time"
-	c.EncodeTime = MyTimeEncoder
-	c.EncodeCaller = zapcore.FullCallerEncoder
+		if setting.daily != "" {
+			dw := newDailyWriter(setting.daily, setting.maxAge)
+
+			w = dw
+			closers = append(closers, dw)
+		} else {
+			// lumberjack.Logger is synchronized by itself
+			lw := &lumberjack.Logger{
+				Filename:   path,
+				MaxSize:    setting.maxSize,
+				MaxBackups: setting.maxBackups,
+				MaxAge:     setting.maxAge,
+				Compress:   setting.compress,
+			}
+
+			w = zapcore.AddSync(lw)
+			closers = append(closers, lw)
+		}
+
+		cores = append(cores, zapcore.NewCore(setting.encoder(setting.encoding), w, level))
+	}
+
+	if setting.stdout {
+		encoding := setting.encoding
 
-	core := zapcore.NewCore(zapcore.NewJSONEncoder(c), w, zap.DebugLevel)
+		if setting.stdoutEnc != "" {
+			encoding = setting.stdoutEnc
+		}
+
+		cores = append(cores, zapcore.NewCore(setting.encoder(encoding), zapcore.Lock(zapcore.AddSync(logStdout)), level))
+	}
+
+	remotes, remoteClosers := setting.remoteCores(level)
+
+	cores = append(cores, remotes...)
+	closers = append(closers, remoteClosers...)
+
+	core := withLogRedaction(withLogHooks(setting.sample(zapcore.NewTee(cores...))))
+
+	options := setting.zapOptions()
+
+	if !setting.noCaller {
+		options = append(options, zap.AddCaller())
+	}
 
-	return zap.New(core, zap.AddCaller())
+	return zap.New(core, options...), level, closers
 }
 
-func initLogger() {
-	tree, ok := env.get("log").(*toml.Tree)
+// remoteCores returns the cores of syslog and remote sinks, and the closers of them.
+func (s *logSetting) remoteCores(level zap.AtomicLevel) ([]zapcore.Core, []io.Closer) {
+	cores := make([]zapcore.Core, 0, 1+len(s.sinks))
+	closers := make([]io.Closer, 0, 1+len(s.sinks))
 
-	if !ok {
-		return
+	if s.syslog != nil {
+		w := newSyslogWriter(s.syslog)
+
+		cores = append(cores, newSyslogCore(s.encoder(s.encoding), w, level))
+		closers = append(closers, w)
 	}
 
-	keys := tree.Keys()
+	for _, v := range s.sinks {
+		buffer := newLogSinkBuffer(v)
 
-	if len(keys) == 0 {
-		return
+		cores = append(cores, newLogSinkCore(s.encoder(s.encoding), buffer, level))
+		closers = append(closers, buffer)
 	}
 
-	for _, v := range keys {
-		node, ok := tree.Get(v).(*toml.Tree)
+	return cores, closers
+}
+
+// zapOptions returns the caller skip and stacktrace options of zap.
+func (s *logSetting) zapOptions() []zap.Option {
+	options := make([]zap.Option, 0, 3)
 
-		if !ok {
-			continue
-		}
+	if s.callerSkip != 0 {
+		options = append(options, zap.AddCallerSkip(s.callerSkip))
+	}
+
+	if s.stacktrace != nil {
+		options = append(options, zap.AddStacktrace(s.stacktrace))
+	}
+
+	return options
+}
+
+// encoder returns the encoder of the files and stdout, JSON is the default.
+func (s *logSetting) encoder(encoding string) zapcore.Encoder {
+	c := zap.NewProductionEncoderConfig()
+
+	c.TimeKey = "time"
+	c.EncodeCaller = zapcore.FullCallerEncoder
+
+	if encoding == "console" {
+		c.EncodeLevel = zapcore.CapitalColorLevelEncoder
+
+		return zapcore.NewConsoleEncoder(s.encoderConfig(c))
+	}
 
-		cfg := &logConfig{
+	return zapcore.NewJSONEncoder(s.encoderConfig(c))
+}
+
+// envLoggerConfigs returns the logger configs of yiigo.toml.
+func envLoggerConfigs() (map[string]LoggerConfig, error) {
+	cfgs := make(map[string]LoggerConfig)
+
+	err := envSection("log", func(name string, node *toml.Tree) error {
+		cfg := LoggerConfig{
 			Path:       "app.log",
-			MaxSize:    500,
+			MaxSize:    500 * MiB,
 			MaxBackups: 0,
 			MaxAge:     0,
 			Compress:   true,
 		}
 
-		node.Unmarshal(cfg)
+		if err := unmarshalConfigNode(node, &cfg); err != nil {
+			return &initError{module: "log", name: name, err: err}
+		}
+
+		cfgs[name] = cfg
+
+		return nil
+	})
+
+	return cfgs, err
+}
+
+// initLoggerConfigs registers the loggers of cfgs, the default one replaces the logger of yiigo.
+func initLoggerConfigs(cfgs map[string]LoggerConfig) error {
+	names := make([]string, 0, len(cfgs))
 
-		l := newLogger(cfg, debug)
+	for k := range cfgs {
+		names = append(names, k)
+	}
+
+	sort.Strings(names)
 
-		if v == AsDefault {
-			logger = l
+	for _, v := range names {
+		if err := registerLoggerConfig(v, cfgs[v]); err != nil {
+			return &initError{module: "log", name: v, err: err}
 		}
+	}
+
+	return nil
+}
+
+// registerLoggerConfig registers the logger of cfg.
+// The zero MaxSize is 500, and the empty Path is logs/app.log unless Stdout, RotateDaily or syslog is specified.
+func registerLoggerConfig(name string, cfg LoggerConfig) error {
+	options, err := cfg.options()
+
+	if err != nil {
+		return err
+	}
+
+	if cfg.MaxSize == 0 {
+		options = append(options, WithLogMaxSize(500))
+	}
 
-		logMap.Store(v, l)
+	if cfg.Path == "" && !cfg.Stdout && cfg.RotateDaily == "" && cfg.SyslogTag == "" {
+		cfg.Path = "logs/app.log"
 	}
+
+	RegisterLogger(name, cfg.Path, options...)
+
+	return nil
 }
 
-// Logger returns a logger
-func Logger(name ...string) *zap.Logger {
+// ErrLoggerInitialized the error of calling InitLogger more than once
+var ErrLoggerInitialized = errors.New("yiigo: logger is already initialized")
+
+var loggerInited int32
+
+// InitLogger initializes the default logger (AsDefault) with cfg instead of yiigo.toml, eg: the settings from env vars.
+// Call it once before the other init functions (eg: InitRedisE), so that they log to it, ErrLoggerInitialized is returned for the later calls.
+// The zero MaxSize is 500, and the empty Path is logs/app.log unless Stdout, RotateDaily or syslog is specified.
+func InitLogger(cfg LoggerConfig) error {
+	if _, err := cfg.options(); err != nil {
+		return fmt.Errorf("yiigo: log init error: %w", err)
+	}
+
+	if !atomic.CompareAndSwapInt32(&loggerInited, 0, 1) {
+		return ErrLoggerInitialized
+	}
+
+	return registerLoggerConfig(AsDefault, cfg)
+}
+
+// RegisterLogger registers a logger with the given name, it writes to the file of path with its own options (eg: level).
+// The default one (AsDefault) replaces the logger of yiigo, unless SetLogger is called.
+// The replaced one is synced, and then its files, syslog connection and remote sinks are closed.
+func RegisterLogger(name, path string, options ...LoggerOption) {
+	l, level, closers := newLogger(path, newLogSetting(options...), isDebug())
+
+	if name == AsDefault {
+		setBootLogger(l)
+	}
+
+	logMap.Store(name, l)
+	logLevels.Store(name, level)
+
+	storeLogClosers(name, l, closers)
+}
+
+// logClosers the closers of the registered loggers, closed when replaced
+var logClosers sync.Map
+
+// logCloser the logger with the closers of its writers
+type logCloser struct {
+	logger  *zap.Logger
+	closers []io.Closer
+}
+
+// storeLogClosers stores the closers of the registered logger, the replaced logger is synced and closed.
+func storeLogClosers(name string, l *zap.Logger, closers []io.Closer) {
+	v, ok := logClosers.Load(name)
+
+	logClosers.Store(name, &logCloser{logger: l, closers: closers})
+
+	if !ok {
+		return
+	}
+
+	old := v.(*logCloser)
+
+	old.logger.Sync()
+
+	for _, c := range old.closers {
+		c.Close()
+	}
+}
+
+// SetLogLevel changes the level (debug, info, warn or error) of the registered logger at runtime, default is the default one.
+// Note: the logger specified by SetLogger is not affected.
+func SetLogLevel(level string, name ...string) error {
+	if len(name) == 0 {
+		name = []string{AsDefault}
+	}
+
+	lvl, err := logAtomicLevel(name[0])
+
+	if err != nil {
+		return err
+	}
+
+	var l zapcore.Level
+
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return err
+	}
+
+	switch l {
+	case zap.DebugLevel, zap.InfoLevel, zap.WarnLevel, zap.ErrorLevel:
+	default:
+		return fmt.Errorf("yiigo: invalid log level %q, expects debug, info, warn or error", level)
+	}
+
+	lvl.SetLevel(l)
+
+	return nil
+}
+
+// LogLevelHandler returns the http handler of the registered logger's level, default is the default one.
+// GET returns the level as JSON, and PUT changes it, eg: curl -X PUT -d '{"level":"debug"}' localhost:8080/log/level
+// It panics when the logger is not registered, unless an error handler is specified by SetErrorHandler.
+func LogLevelHandler(name ...string) http.Handler {
 	if len(name) == 0 {
-		return logger
+		name = []string{AsDefault}
+	}
+
+	lvl, err := logAtomicLevel(name[0])
+
+	if err != nil && !handleError("log", name[0], err) {
+		logger().Panic(err.Error())
+	}
+
+	return lvl
+}
+
+func logAtomicLevel(name string) (zap.AtomicLevel, error) {
+	v, ok := logLevels.Load(name)
+
+	if !ok {
+		return zap.NewAtomicLevel(), fmt.Errorf("yiigo: unknown log.%s (forgotten configure?)", name)
+	}
+
+	return v.(zap.AtomicLevel), nil
+}
+
+// Logger returns a logger, the default one is the logger of yiigo (see SetLogger).
+// It panics when the logger is not registered, unless an error handler is specified by SetErrorHandler.
+func Logger(name ...string) *zap.Logger {
+	l, err := LoggerE(name...)
+
+	if err != nil {
+		if !handleError("log", name[0], err) {
+			logger().Panic(err.Error())
+		}
+
+		return logger()
+	}
+
+	return l
+}
+
+// LoggerE returns a logger, an error is returned instead of panic when the logger is not registered.
+func LoggerE(name ...string) (*zap.Logger, error) {
+	if len(name) == 0 || name[0] == AsDefault {
+		return logger(), nil
 	}
 
 	v, ok := logMap.Load(name[0])
 
 	if !ok {
-		return logger
+		return nil, fmt.Errorf("yiigo: unknown log.%s (forgotten configure?)", name[0])
 	}
 
-	return v.(*zap.Logger)
+	return v.(*zap.Logger), nil
+}
+
+// Debugf logs a printf-style message at debug level with the default logger, it's a bridge for the migration from logrus,
+// the structured API (eg: Logger().Debug) is preferred. Use Logger(name).Sugar() for the named loggers.
+func Debugf(template string, args ...interface{}) {
+	logf(zap.DebugLevel, template, args...)
+}
+
+// Infof logs a printf-style message at info level with the default logger (see Debugf).
+func Infof(template string, args ...interface{}) {
+	logf(zap.InfoLevel, template, args...)
+}
+
+// Warnf logs a printf-style message at warn level with the default logger (see Debugf).
+func Warnf(template string, args ...interface{}) {
+	logf(zap.WarnLevel, template, args...)
+}
+
+// Errorf logs a printf-style message at error level with the default logger (see Debugf).
+func Errorf(template string, args ...interface{}) {
+	logf(zap.ErrorLevel, template, args...)
+}
+
+func logf(level zapcore.Level, template string, args ...interface{}) {
+	l := logger()
+
+	// skips the cloning of logger for the disabled level
+	if !l.Core().Enabled(level) {
+		return
+	}
+
+	// the caller of Debugf etc.
+	sugar := l.WithOptions(zap.AddCallerSkip(2)).Sugar()
+
+	switch level {
+	case zap.DebugLevel:
+		sugar.Debugf(template, args...)
+	case zap.InfoLevel:
+		sugar.Infof(template, args...)
+	case zap.WarnLevel:
+		sugar.Warnf(template, args...)
+	default:
+		sugar.Errorf(template, args...)
+	}
+}
+
+// logFieldsKey the context key of log fields
+type logFieldsKey struct{}
+
+// CtxWithLogFields returns a copy of ctx carrying the log fields (eg: trace_id) in addition to the ones of ctx,
+// they are added to the logs of CtxLogger, including the ones of yiigo's operations with the ctx (eg: redis errors).
+func CtxWithLogFields(ctx context.Context, fields ...zap.Field) context.Context {
+	if len(fields) == 0 {
+		return ctx
+	}
+
+	parent := ctxLogFields(ctx)
+
+	// never share the backing array with the parent
+	v := make([]zap.Field, 0, len(parent)+len(fields))
+	v = append(v, parent...)
+	v = append(v, fields...)
+
+	return context.WithValue(ctx, logFieldsKey{}, v)
+}
+
+// CtxLogger returns the logger (default is the default one) with the log fields of ctx.
+func CtxLogger(ctx context.Context, name ...string) *zap.Logger {
+	l := Logger(name...)
+
+	if fields := ctxLogFields(ctx); len(fields) != 0 {
+		return l.With(fields...)
+	}
+
+	return l
+}
+
+func ctxLogFields(ctx context.Context) []zap.Field {
+	if ctx == nil {
+		return nil
+	}
+
+	fields, _ := ctx.Value(logFieldsKey{}).([]zap.Field)
+
+	return fields
+}
+
+// logThrottleInterval the interval in which the identical logs of yiigo itself collapse into a counter
+var logThrottleInterval = 10 * time.Second
+
+// logThrottles the throttles of messages
+var logThrottles sync.Map
+
+// logThrottle counts the suppressed logs of a message
+type logThrottle struct {
+	last       int64
+	suppressed int64
+}
+
+// logThrottled logs the runtime errors of yiigo itself (eg: when redis is down) with the fields of ctx, independent of the sampling of logger.
+// The identical messages within logThrottleInterval are suppressed, the next one logged carries the number of them as "suppressed".
+func logThrottled(ctx context.Context, level zapcore.Level, msg string, fields ...zap.Field) {
+	v, ok := logThrottles.Load(msg)
+
+	if !ok {
+		v, _ = logThrottles.LoadOrStore(msg, new(logThrottle))
+	}
+
+	t := v.(*logThrottle)
+
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&t.last)
+
+	if (last != 0 && now-last < int64(logThrottleInterval)) || !atomic.CompareAndSwapInt64(&t.last, last, now) {
+		atomic.AddInt64(&t.suppressed, 1)
+
+		return
+	}
+
+	if n := atomic.SwapInt64(&t.suppressed, 0); n > 0 {
+		fields = append(fields, zap.Int64("suppressed", n))
+	}
+
+	if ce := CtxLogger(ctx).WithOptions(zap.AddCallerSkip(1)).Check(level, msg); ce != nil {
+		ce.Write(fields...)
+	}
 }
 
 // MyTimeEncoder zap time encoder.
@@ -0,0 +1,293 @@
+package yiigo
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// accessLogSetting access log setting
+type accessLogSetting struct {
+	logger    string
+	skipPaths map[string]bool
+	sampling  float64
+	bodyLimit int
+}
+
+// AccessLogOption configures how we set up the access log
+type AccessLogOption interface {
+	apply(*accessLogSetting)
+}
+
+// funcAccessLogOption implements access log option
+type funcAccessLogOption struct {
+	f func(*accessLogSetting)
+}
+
+func (fo *funcAccessLogOption) apply(s *accessLogSetting) {
+	fo.f(s)
+}
+
+func newFuncAccessLogOption(f func(*accessLogSetting)) *funcAccessLogOption {
+	return &funcAccessLogOption{f: f}
+}
+
+// WithAccessLogLogger specifies the name of logger, default is "access", the default logger is used when it's not registered.
+func WithAccessLogLogger(name string) AccessLogOption {
+	return newFuncAccessLogOption(func(s *accessLogSetting) {
+		s.logger = name
+	})
+}
+
+// WithAccessLogSkipPaths specifies the paths not logged, eg: /healthz.
+func WithAccessLogSkipPaths(paths ...string) AccessLogOption {
+	return newFuncAccessLogOption(func(s *accessLogSetting) {
+		for _, v := range paths {
+			s.skipPaths[v] = true
+		}
+	})
+}
+
+// WithAccessLogSampling specifies the ratio (0 to 1) of the successful (2xx) requests logged, default is 1,
+// the others are always logged.
+func WithAccessLogSampling(ratio float64) AccessLogOption {
+	return newFuncAccessLogOption(func(s *accessLogSetting) {
+		s.sampling = ratio
+	})
+}
+
+// WithAccessLogBody specifies to log the request and response bodies up to limit bytes for debugging, it's off by default.
+func WithAccessLogBody(limit int) AccessLogOption {
+	return newFuncAccessLogOption(func(s *accessLogSetting) {
+		s.bodyLimit = limit
+	})
+}
+
+// AccessLog returns a middleware logs the method, path, status, bytes, duration and client IP of the requests,
+// with the log fields of the request context (eg: trace_id, see CtxWithLogFields).
+// The 5xx are logged at error level, 4xx at warn level and the others at info level.
+func AccessLog(next http.Handler, options ...AccessLogOption) http.Handler {
+	setting := &accessLogSetting{
+		logger:    "access",
+		skipPaths: make(map[string]bool),
+		sampling:  1,
+	}
+
+	for _, option := range options {
+		option.apply(setting)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if setting.skipPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		start := time.Now()
+
+		aw := &accessLogWriter{ResponseWriter: w}
+
+		var reqBody *accessLogBody
+
+		if setting.bodyLimit > 0 {
+			aw.body = &accessLogBody{limit: setting.bodyLimit}
+
+			if r.Body != nil && r.Body != http.NoBody {
+				reqBody = &accessLogBody{limit: setting.bodyLimit}
+
+				r.Body = &accessLogReader{ReadCloser: r.Body, body: reqBody}
+			}
+		}
+
+		next.ServeHTTP(aw, r)
+
+		status := aw.status
+
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		if status >= 200 && status < 300 && setting.sampling < 1 && rand.Float64() >= setting.sampling {
+			return
+		}
+
+		l, err := LoggerE(setting.logger)
+
+		if err != nil {
+			l = logger()
+		}
+
+		fields := make([]zap.Field, 0, 10)
+
+		fields = append(fields, ctxLogFields(r.Context())...)
+		fields = append(fields,
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+			zap.Int("status", status),
+			zap.Int64("bytes", aw.bytes),
+			zap.Duration("duration", time.Since(start)),
+			zap.String("client_ip", accessLogClientIP(r)),
+		)
+
+		if reqBody != nil {
+			fields = append(fields, zap.String("request_body", reqBody.String()))
+		}
+
+		if aw.body != nil {
+			fields = append(fields, zap.String("response_body", aw.body.String()))
+		}
+
+		level := zapcore.InfoLevel
+
+		switch {
+		case status >= 500:
+			level = zapcore.ErrorLevel
+		case status >= 400:
+			level = zapcore.WarnLevel
+		}
+
+		if ce := l.Check(level, "access"); ce != nil {
+			ce.Write(fields...)
+		}
+	})
+}
+
+// accessLogClientIP returns the client IP of X-Forwarded-For, X-Real-IP or the remote address.
+func accessLogClientIP(r *http.Request) string {
+	if v := r.Header.Get("X-Forwarded-For"); v != "" {
+		if i := strings.IndexByte(v, ','); i >= 0 {
+			v = v[:i]
+		}
+
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+
+	if v := strings.TrimSpace(r.Header.Get("X-Real-IP")); v != "" {
+		return v
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// accessLogBody keeps the body up to limit bytes
+type accessLogBody struct {
+	limit     int
+	buf       []byte
+	truncated bool
+}
+
+func (b *accessLogBody) write(p []byte) {
+	if n := b.limit - len(b.buf); n < len(p) {
+		p = p[:n]
+
+		b.truncated = true
+	}
+
+	b.buf = append(b.buf, p...)
+}
+
+func (b *accessLogBody) String() string {
+	if b.truncated {
+		return string(b.buf) + "...(truncated)"
+	}
+
+	return string(b.buf)
+}
+
+// accessLogReader keeps the request body read by the handler
+type accessLogReader struct {
+	io.ReadCloser
+	body *accessLogBody
+}
+
+func (r *accessLogReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+
+	if n > 0 {
+		r.body.write(p[:n])
+	}
+
+	return n, err
+}
+
+// accessLogWriter records the status and bytes of response, it supports http.Flusher and http.Hijacker
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+	body   *accessLogBody
+}
+
+func (w *accessLogWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessLogWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	n, err := w.ResponseWriter.Write(p)
+
+	w.bytes += int64(n)
+
+	if w.body != nil && n > 0 {
+		w.body.write(p[:n])
+	}
+
+	return n, err
+}
+
+// Flush implements http.Flusher.
+func (w *accessLogWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker, the hijacked connection is logged with status 101.
+func (w *accessLogWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+
+	if !ok {
+		return nil, nil, errors.New("yiigo: the response writer does not support hijack")
+	}
+
+	conn, rw, err := h.Hijack()
+
+	if err == nil && w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+
+	return conn, rw, err
+}
+
+// Unwrap returns the original response writer, eg: for http.ResponseController.
+func (w *accessLogWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,158 @@
+package yiigo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logNow the clock of the daily rotation, replaced in tests
+var logNow = time.Now
+
+// dailyWriter the log writer switches files at local midnight, it's synchronized by itself
+type dailyWriter struct {
+	pattern string
+	maxAge  int
+	file    *os.File
+	day     string
+	mutex   sync.Mutex
+}
+
+func newDailyWriter(pattern string, maxAge int) *dailyWriter {
+	return &dailyWriter{
+		pattern: pattern,
+		maxAge:  maxAge,
+	}
+}
+
+// dailyLogName returns the file name of pattern at t, the placeholders are:
+// %Y (2006), %y (06), %m (01), %d (02), %j (day of year, 002) and %% (a literal %).
+func dailyLogName(pattern string, t time.Time) string {
+	var b strings.Builder
+
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' || i == len(pattern)-1 {
+			b.WriteByte(pattern[i])
+
+			continue
+		}
+
+		i++
+
+		switch pattern[i] {
+		case 'Y':
+			b.WriteString(t.Format("2006"))
+		case 'y':
+			b.WriteString(t.Format("06"))
+		case 'm':
+			b.WriteString(t.Format("01"))
+		case 'd':
+			b.WriteString(t.Format("02"))
+		case 'j':
+			b.WriteString(fmt.Sprintf("%03d", t.YearDay()))
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteByte('%')
+			b.WriteByte(pattern[i])
+		}
+	}
+
+	return b.String()
+}
+
+func (w *dailyWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	now := logNow()
+
+	if day := now.Format("2006-01-02"); w.file == nil || day != w.day {
+		if err := w.rotate(now); err != nil {
+			return 0, err
+		}
+
+		w.day = day
+	}
+
+	return w.file.Write(p)
+}
+
+// rotate closes the current file and opens the one of now.
+func (w *dailyWriter) rotate(now time.Time) error {
+	name := dailyLogName(w.pattern, now)
+
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	if w.file != nil {
+		w.file.Close()
+	}
+
+	w.file = f
+
+	if w.maxAge > 0 {
+		w.prune(now, name)
+	}
+
+	return nil
+}
+
+// prune removes the files of pattern older than maxAge days, except the current one.
+func (w *dailyWriter) prune(now time.Time, current string) {
+	glob := dailyLogName(strings.NewReplacer("%Y", "*", "%y", "*", "%m", "*", "%d", "*", "%j", "*").Replace(w.pattern), now)
+
+	matches, err := filepath.Glob(glob)
+
+	if err != nil {
+		return
+	}
+
+	cutoff := now.AddDate(0, 0, -w.maxAge)
+
+	for _, v := range matches {
+		if v == current {
+			continue
+		}
+
+		if fi, err := os.Stat(v); err == nil && !fi.IsDir() && fi.ModTime().Before(cutoff) {
+			os.Remove(v)
+		}
+	}
+}
+
+func (w *dailyWriter) Sync() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+
+	return w.file.Sync()
+}
+
+func (w *dailyWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+
+	err := w.file.Close()
+
+	w.file = nil
+
+	return err
+}
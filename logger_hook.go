@@ -0,0 +1,138 @@
+package yiigo
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// logHookQueueSize the capacity of the queue of log hooks, the entries are dropped when it's full
+var logHookQueueSize = 1024
+
+var (
+	logHooks     atomic.Value // []*logHook
+	logHookMutex sync.Mutex
+	logHookQueue chan logHookEntry
+	logHookOnce  sync.Once
+	// logHookDropped the number of entries dropped for the full queue
+	logHookDropped int64
+)
+
+type logHook struct {
+	fn func(entry zapcore.Entry, fields []zapcore.Field)
+	// panicked the panic is logged once
+	panicked int32
+}
+
+type logHookEntry struct {
+	entry  zapcore.Entry
+	fields []zapcore.Field
+}
+
+// RegisterLogHook registers a hook called for the Error (and above) entries of the loggers built by yiigo, eg: to forward them to Sentry.
+// The logger specified by SetLogger is not hooked.
+// The hooks are called in order on a background goroutine, so the logging is never blocked, the entries are dropped when the queue is full (see LogHookDropped).
+// A panicking hook is recovered and logged once.
+func RegisterLogHook(fn func(entry zapcore.Entry, fields []zapcore.Field)) {
+	logHookMutex.Lock()
+	defer logHookMutex.Unlock()
+
+	logHookOnce.Do(func() {
+		logHookQueue = make(chan logHookEntry, logHookQueueSize)
+
+		go runLogHooks(logHookQueue)
+	})
+
+	hooks, _ := logHooks.Load().([]*logHook)
+
+	// copy on write
+	v := make([]*logHook, 0, len(hooks)+1)
+	v = append(v, hooks...)
+	v = append(v, &logHook{fn: fn})
+
+	logHooks.Store(v)
+}
+
+// LogHookDropped returns the number of entries dropped by the log hooks for the full queue.
+func LogHookDropped() int64 {
+	return atomic.LoadInt64(&logHookDropped)
+}
+
+func runLogHooks(queue <-chan logHookEntry) {
+	for e := range queue {
+		hooks, _ := logHooks.Load().([]*logHook)
+
+		for _, h := range hooks {
+			h.call(e)
+		}
+	}
+}
+
+func (h *logHook) call(e logHookEntry) {
+	defer func() {
+		if err := recover(); err != nil && atomic.CompareAndSwapInt32(&h.panicked, 0, 1) {
+			// below the Error level, or it's hooked again
+			logger().Warn("yiigo: log hook panic", zap.Error(fmt.Errorf("%v", err)), zap.Stack("stack"))
+		}
+	}()
+
+	h.fn(e.entry, e.fields)
+}
+
+// logHookCore the core tees the Error (and above) entries to the log hooks
+type logHookCore struct {
+	fields []zapcore.Field
+}
+
+// withLogHooks wraps the core with the log hooks.
+func withLogHooks(core zapcore.Core) zapcore.Core {
+	return zapcore.NewTee(core, &logHookCore{})
+}
+
+func (c *logHookCore) Enabled(level zapcore.Level) bool {
+	if level < zapcore.ErrorLevel {
+		return false
+	}
+
+	hooks, _ := logHooks.Load().([]*logHook)
+
+	return len(hooks) != 0
+}
+
+func (c *logHookCore) With(fields []zapcore.Field) zapcore.Core {
+	return &logHookCore{fields: c.merge(fields)}
+}
+
+func (c *logHookCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return ce.AddCore(entry, c)
+	}
+
+	return ce
+}
+
+func (c *logHookCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	select {
+	case logHookQueue <- logHookEntry{entry: entry, fields: c.merge(fields)}:
+	default:
+		atomic.AddInt64(&logHookDropped, 1)
+	}
+
+	return nil
+}
+
+func (c *logHookCore) Sync() error {
+	return nil
+}
+
+// merge returns the fields of core followed by fields, it never shares the backing array.
+func (c *logHookCore) merge(fields []zapcore.Field) []zapcore.Field {
+	v := make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	v = append(v, c.fields...)
+	v = append(v, fields...)
+
+	return v
+}
@@ -0,0 +1,307 @@
+package yiigo
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// LogSink the remote sink of logs, eg: Kafka or NSQ, the entries are encoded without the trailing newline.
+type LogSink interface {
+	WriteBatch(entries [][]byte) error
+}
+
+var (
+	// logSinkBufferSize the capacity of the ring buffer of a remote sink, the oldest entries are dropped when it's full
+	logSinkBufferSize = 8192
+	// logSinkRetries the attempts to write a batch, it's dropped then
+	logSinkRetries = 3
+	// logSinkRetryBackoff the backoff between the attempts, doubled on each attempt
+	logSinkRetryBackoff = 100 * time.Millisecond
+	// logSinkDropped the number of entries dropped by the remote sinks
+	logSinkDropped int64
+)
+
+// LogSinkDropped returns the number of entries dropped by the remote sinks, for the full buffer or the failing sink.
+func LogSinkDropped() int64 {
+	return atomic.LoadInt64(&logSinkDropped)
+}
+
+// logRemoteSink the remote sink of WithLogRemoteSink
+type logRemoteSink struct {
+	sink          LogSink
+	batchSize     int
+	flushInterval time.Duration
+}
+
+// logSinkBuffer buffers the entries in a bounded ring, and flushes them to the sink in batch on a background goroutine
+type logSinkBuffer struct {
+	sink      LogSink
+	batchSize int
+	ring      [][]byte
+	head      int
+	count     int
+	mutex     sync.Mutex
+	notify    chan struct{}
+	flushes   chan chan struct{}
+	done      chan struct{}
+	stopped   chan struct{}
+	once      sync.Once
+}
+
+func newLogSinkBuffer(cfg *logRemoteSink) *logSinkBuffer {
+	batchSize := cfg.batchSize
+
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	interval := cfg.flushInterval
+
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	b := &logSinkBuffer{
+		sink:      cfg.sink,
+		batchSize: batchSize,
+		ring:      make([][]byte, logSinkBufferSize),
+		notify:    make(chan struct{}, 1),
+		flushes:   make(chan chan struct{}),
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+
+	go b.run(interval)
+
+	return b
+}
+
+// push appends the entry, drops the oldest one when the ring is full.
+func (b *logSinkBuffer) push(entry []byte) {
+	b.mutex.Lock()
+
+	if b.count == len(b.ring) {
+		b.ring[b.head] = nil
+		b.head = (b.head + 1) % len(b.ring)
+		b.count--
+
+		atomic.AddInt64(&logSinkDropped, 1)
+	}
+
+	b.ring[(b.head+b.count)%len(b.ring)] = entry
+	b.count++
+
+	full := b.count >= b.batchSize
+
+	b.mutex.Unlock()
+
+	if full {
+		select {
+		case b.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// pop takes at most n entries, the full batch only unless all.
+func (b *logSinkBuffer) pop(n int, all bool) [][]byte {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.count == 0 || (!all && b.count < n) {
+		return nil
+	}
+
+	if n > b.count {
+		n = b.count
+	}
+
+	batch := make([][]byte, n)
+
+	for i := 0; i < n; i++ {
+		batch[i] = b.ring[b.head]
+		b.ring[b.head] = nil
+		b.head = (b.head + 1) % len(b.ring)
+	}
+
+	b.count -= n
+
+	return batch
+}
+
+func (b *logSinkBuffer) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.notify:
+			b.flush(false)
+		case <-ticker.C:
+			b.flush(true)
+		case done := <-b.flushes:
+			b.flush(true)
+
+			close(done)
+		case <-b.done:
+			b.flush(true)
+
+			close(b.stopped)
+
+			return
+		}
+	}
+}
+
+// flush writes the full batches, and the rest when all.
+func (b *logSinkBuffer) flush(all bool) {
+	for {
+		batch := b.pop(b.batchSize, all)
+
+		if len(batch) == 0 {
+			return
+		}
+
+		b.write(batch)
+	}
+}
+
+// write writes the batch with retries, it's dropped when the sink is persistently failing.
+func (b *logSinkBuffer) write(batch [][]byte) {
+	backoff := logSinkRetryBackoff
+
+	for i := 0; i < logSinkRetries; i++ {
+		if i > 0 {
+			time.Sleep(backoff)
+
+			backoff *= 2
+		}
+
+		err := b.sink.WriteBatch(batch)
+
+		if err == nil {
+			return
+		}
+
+		if i == logSinkRetries-1 {
+			logThrottled(context.Background(), zap.WarnLevel, "yiigo: log sink error", zap.Int("dropped", len(batch)), zap.Error(err))
+		}
+	}
+
+	atomic.AddInt64(&logSinkDropped, int64(len(batch)))
+}
+
+// Sync flushes the buffered entries, it waits for at most 5 seconds.
+func (b *logSinkBuffer) Sync() error {
+	done := make(chan struct{})
+
+	timer := time.NewTimer(5 * time.Second)
+
+	defer timer.Stop()
+
+	select {
+	case b.flushes <- done:
+	case <-b.stopped:
+		return nil
+	case <-timer.C:
+		return errors.New("yiigo: log sink flush timeout")
+	}
+
+	select {
+	case <-done:
+		return nil
+	case <-timer.C:
+		return errors.New("yiigo: log sink flush timeout")
+	}
+}
+
+// Close stops the background goroutine after flushing the buffered entries, it waits for at most 5 seconds.
+func (b *logSinkBuffer) Close() error {
+	b.once.Do(func() {
+		close(b.done)
+	})
+
+	timer := time.NewTimer(5 * time.Second)
+
+	defer timer.Stop()
+
+	select {
+	case <-b.stopped:
+		return nil
+	case <-timer.C:
+		return errors.New("yiigo: log sink flush timeout")
+	}
+}
+
+// logSinkCore the core encodes the entries to the buffer of remote sink
+type logSinkCore struct {
+	zapcore.LevelEnabler
+	enc    zapcore.Encoder
+	buffer *logSinkBuffer
+}
+
+func newLogSinkCore(enc zapcore.Encoder, buffer *logSinkBuffer, enab zapcore.LevelEnabler) zapcore.Core {
+	return &logSinkCore{
+		LevelEnabler: enab,
+		enc:          enc,
+		buffer:       buffer,
+	}
+}
+
+func (c *logSinkCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := &logSinkCore{
+		LevelEnabler: c.LevelEnabler,
+		enc:          c.enc.Clone(),
+		buffer:       c.buffer,
+	}
+
+	for _, f := range fields {
+		f.AddTo(clone.enc)
+	}
+
+	return clone
+}
+
+func (c *logSinkCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return ce.AddCore(entry, c)
+	}
+
+	return ce
+}
+
+func (c *logSinkCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(entry, fields)
+
+	if err != nil {
+		return err
+	}
+
+	b := buf.Bytes()
+
+	if n := len(b); n > 0 && b[n-1] == '\n' {
+		b = b[:n-1]
+	}
+
+	// the buffer of zap is reused
+	entryBytes := make([]byte, len(b))
+
+	copy(entryBytes, b)
+
+	buf.Free()
+
+	c.buffer.push(entryBytes)
+
+	return nil
+}
+
+func (c *logSinkCore) Sync() error {
+	return c.buffer.Sync()
+}
@@ -0,0 +1,238 @@
+package yiigo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	// logStderr the fallback of syslog while the connection is down
+	logStderr io.Writer = os.Stderr
+	// syslogRedialInterval the minimum interval between the redials of syslog
+	syslogRedialInterval = time.Second
+	// syslogLocalAddrs the local syslog sockets tried in order
+	syslogLocalAddrs = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+)
+
+// syslogFacility the facility of the messages, LOG_USER
+const syslogFacility = 1
+
+// logSyslog the syslog endpoint of WithLogSyslog
+type logSyslog struct {
+	network string
+	addr    string
+	tag     string
+}
+
+// syslogWriter writes the messages to syslog, reconnects on failure, it's synchronized by itself
+type syslogWriter struct {
+	network  string
+	addr     string
+	tag      string
+	hostname string
+	pid      string
+	conn     net.Conn
+	dialed   time.Time
+	mutex    sync.Mutex
+}
+
+func newSyslogWriter(cfg *logSyslog) *syslogWriter {
+	hostname, _ := os.Hostname()
+
+	if hostname == "" {
+		hostname = "-"
+	}
+
+	tag := cfg.tag
+
+	if tag == "" {
+		tag = "-"
+	}
+
+	return &syslogWriter{
+		network:  cfg.network,
+		addr:     cfg.addr,
+		tag:      tag,
+		hostname: hostname,
+		pid:      strconv.Itoa(os.Getpid()),
+	}
+}
+
+// syslogSeverity maps the zap level to the syslog severity.
+func syslogSeverity(level zapcore.Level) int {
+	switch level {
+	case zapcore.DebugLevel:
+		return 7 // debug
+	case zapcore.InfoLevel:
+		return 6 // informational
+	case zapcore.WarnLevel:
+		return 4 // warning
+	case zapcore.ErrorLevel:
+		return 3 // error
+	case zapcore.DPanicLevel:
+		return 2 // critical
+	case zapcore.PanicLevel:
+		return 1 // alert
+	default:
+		return 0 // emergency
+	}
+}
+
+func (w *syslogWriter) dial() error {
+	if w.network != "" {
+		conn, err := net.DialTimeout(w.network, w.addr, 5*time.Second)
+
+		if err != nil {
+			return err
+		}
+
+		w.conn = conn
+
+		return nil
+	}
+
+	// the local syslog
+	addrs := syslogLocalAddrs
+
+	if w.addr != "" {
+		addrs = []string{w.addr}
+	}
+
+	for _, addr := range addrs {
+		for _, network := range []string{"unixgram", "unix"} {
+			if conn, err := net.Dial(network, addr); err == nil {
+				w.conn = conn
+
+				return nil
+			}
+		}
+	}
+
+	return errors.New("yiigo: local syslog is unavailable")
+}
+
+// message returns the RFC5424 message, the stream transports are framed by octet counting (RFC6587).
+func (w *syslogWriter) message(entry zapcore.Entry, msg []byte) []byte {
+	buf := new(bytes.Buffer)
+
+	fmt.Fprintf(buf, "<%d>1 %s %s %s %s - - ",
+		syslogFacility*8+syslogSeverity(entry.Level),
+		entry.Time.Format("2006-01-02T15:04:05.000000Z07:00"),
+		w.hostname,
+		w.tag,
+		w.pid,
+	)
+
+	buf.Write(bytes.TrimRight(msg, "\n"))
+
+	if w.network == "tcp" || w.network == "tcp4" || w.network == "tcp6" {
+		return append([]byte(strconv.Itoa(buf.Len())+" "), buf.Bytes()...)
+	}
+
+	return buf.Bytes()
+}
+
+// write writes the entry to syslog, or to stderr while the connection is down.
+func (w *syslogWriter) write(entry zapcore.Entry, msg []byte) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.conn == nil && time.Since(w.dialed) >= syslogRedialInterval {
+		w.dialed = time.Now()
+
+		w.dial()
+	}
+
+	if w.conn != nil {
+		if _, err := w.conn.Write(w.message(entry, msg)); err == nil {
+			return nil
+		}
+
+		// reconnects on the next write
+		w.conn.Close()
+		w.conn = nil
+	}
+
+	_, err := logStderr.Write(msg)
+
+	return err
+}
+
+func (w *syslogWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.conn == nil {
+		return nil
+	}
+
+	err := w.conn.Close()
+
+	w.conn = nil
+
+	return err
+}
+
+// syslogCore the core writes the entries to syslog with the severity of their levels
+type syslogCore struct {
+	zapcore.LevelEnabler
+	enc    zapcore.Encoder
+	writer *syslogWriter
+}
+
+func newSyslogCore(enc zapcore.Encoder, writer *syslogWriter, enab zapcore.LevelEnabler) zapcore.Core {
+	return &syslogCore{
+		LevelEnabler: enab,
+		enc:          enc,
+		writer:       writer,
+	}
+}
+
+func (c *syslogCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := &syslogCore{
+		LevelEnabler: c.LevelEnabler,
+		enc:          c.enc.Clone(),
+		writer:       c.writer,
+	}
+
+	for _, f := range fields {
+		f.AddTo(clone.enc)
+	}
+
+	return clone
+}
+
+func (c *syslogCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return ce.AddCore(entry, c)
+	}
+
+	return ce
+}
+
+func (c *syslogCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(entry, fields)
+
+	if err != nil {
+		return err
+	}
+
+	err = c.writer.write(entry, buf.Bytes())
+
+	buf.Free()
+
+	return err
+}
+
+func (c *syslogCore) Sync() error {
+	return nil
+}
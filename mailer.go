@@ -1,14 +1,15 @@
 package yiigo
 
 import (
+	"fmt"
 	"sync"
 
 	"github.com/pelletier/go-toml"
-	"go.uber.org/zap"
 	"gopkg.in/gomail.v2"
 )
 
-type emailConfig struct {
+// EMailConfig the config of mailer, it's the [email.name] of yiigo.toml, or the EMail of Config.
+type EMailConfig struct {
 	Host     string `toml:"host"`
 	Port     int    `toml:"port"`
 	Username string `toml:"username"`
@@ -126,57 +127,71 @@ var (
 	mailerMap     sync.Map
 )
 
-func initMailer() {
-	tree, ok := env.get("email").(*toml.Tree)
+// envEMailConfigs returns the email configs of yiigo.toml.
+func envEMailConfigs() (map[string]EMailConfig, error) {
+	cfgs := make(map[string]EMailConfig)
 
-	if !ok {
-		return
-	}
-
-	keys := tree.Keys()
-
-	if len(keys) == 0 {
-		return
-	}
+	err := envSection("email", func(name string, node *toml.Tree) error {
+		cfg := EMailConfig{}
 
-	for _, v := range keys {
-		node, ok := tree.Get(v).(*toml.Tree)
-
-		if !ok {
-			continue
+		if err := unmarshalConfigNode(node, &cfg); err != nil {
+			return &initError{module: "email", name: name, err: err}
 		}
 
-		cfg := new(emailConfig)
+		cfgs[name] = cfg
 
-		if err := node.Unmarshal(cfg); err != nil {
-			logger.Error("yiigo: email dialer init error", zap.String("name", v), zap.Error(err))
-		}
+		return nil
+	})
+
+	return cfgs, err
+}
 
+// initEMailConfigs registers the email dialers of cfgs.
+func initEMailConfigs(cfgs map[string]EMailConfig) error {
+	for k, cfg := range cfgs {
 		dialer := &EMailDialer{dialer: gomail.NewDialer(cfg.Host, cfg.Port, cfg.Username, cfg.Password)}
 
-		if v == AsDefault {
+		if k == AsDefault {
 			defaultMailer = dialer
 		}
 
-		mailerMap.Store(v, dialer)
+		mailerMap.Store(k, dialer)
 	}
+
+	return nil
 }
 
 // Mailer returns an email dialer.
+// It panics when the dialer is not registered, unless an error handler is specified by SetErrorHandler (nil is returned then).
 func Mailer(name ...string) *EMailDialer {
+	dialer, err := MailerE(name...)
+
+	if err != nil {
+		if !handleError("email", resourceName(name), err) {
+			logger().Panic(err.Error())
+		}
+
+		return nil
+	}
+
+	return dialer
+}
+
+// MailerE returns an email dialer, an error is returned instead of panic when the dialer is not registered.
+func MailerE(name ...string) (*EMailDialer, error) {
 	if len(name) == 0 {
 		if defaultMailer == nil {
-			logger.Panic("yiigo: invalid email dialer", zap.String("name", AsDefault))
+			return nil, fmt.Errorf("yiigo: unknown email.%s (forgotten configure?)", AsDefault)
 		}
 
-		return defaultMailer
+		return defaultMailer, nil
 	}
 
 	v, ok := mailerMap.Load(name[0])
 
 	if !ok {
-		logger.Panic("yiigo: invalid email dialer", zap.String("name", name[0]))
+		return nil, fmt.Errorf("yiigo: unknown email.%s (forgotten configure?)", name[0])
 	}
 
-	return v.(*EMailDialer)
+	return v.(*EMailDialer), nil
 }
@@ -3,14 +3,13 @@ package yiigo
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
-	"time"
 
 	"github.com/pelletier/go-toml"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
-	"go.uber.org/zap"
 )
 
 // MongoMode indicates the user's preference on reads.
@@ -24,13 +23,14 @@ const (
 	Nearest            MongoMode = "nearest"             // Read from one of the nearest members, irrespective of it being primary or secondary.
 )
 
-type mongoConfig struct {
-	Dsn             string `toml:"dsn"`
-	ConnectTimeout  int    `toml:"connect_timeout"`
-	MinPoolSize     int    `toml:"min_pool_size"`
-	MaxPoolSize     int    `toml:"max_pool_size"`
-	MaxConnIdleTime int    `toml:"max_conn_idle_time"`
-	Mode            string `toml:"mode"`
+// MongoConfig the config of mongodb, it's the [mongo.name] of yiigo.toml, or the Mongo of Config.
+type MongoConfig struct {
+	Dsn             string   `toml:"dsn"`
+	ConnectTimeout  Duration `toml:"connect_timeout"`
+	MinPoolSize     int      `toml:"min_pool_size"`
+	MaxPoolSize     int      `toml:"max_pool_size"`
+	MaxConnIdleTime Duration `toml:"max_conn_idle_time"`
+	Mode            string   `toml:"mode"`
 }
 
 var (
@@ -38,14 +38,14 @@ var (
 	mgoMap       sync.Map
 )
 
-func mongoDial(cfg *mongoConfig) (*mongo.Client, error) {
+func mongoDial(cfg *MongoConfig) (*mongo.Client, error) {
 	clientOptions := options.Client()
 
 	clientOptions.ApplyURI(cfg.Dsn)
-	clientOptions.SetConnectTimeout(time.Duration(cfg.ConnectTimeout) * time.Second)
+	clientOptions.SetConnectTimeout(cfg.ConnectTimeout.Duration())
 	clientOptions.SetMinPoolSize(uint64(cfg.MinPoolSize))
 	clientOptions.SetMaxPoolSize(uint64(cfg.MaxPoolSize))
-	clientOptions.SetMaxConnIdleTime(time.Duration(cfg.MaxConnIdleTime) * time.Second)
+	clientOptions.SetMaxConnIdleTime(cfg.MaxConnIdleTime.Duration())
 
 	if cfg.Mode != "" {
 		switch MongoMode(cfg.Mode) {
@@ -69,43 +69,65 @@ func mongoDial(cfg *mongoConfig) (*mongo.Client, error) {
 		return nil, err
 	}
 
-	ctx, cancel := context.WithTimeout(context.TODO(), time.Duration(cfg.ConnectTimeout)*time.Second)
+	ctx, cancel := context.WithTimeout(context.TODO(), cfg.ConnectTimeout.Duration())
 
 	defer cancel()
 
 	return mongo.Connect(ctx, clientOptions)
 }
 
-func initMongoDB() {
-	tree, ok := env.get("mongo").(*toml.Tree)
+// InitMongoE registers the mongodb clients configured in yiigo.toml, the first error is returned instead of panic,
+// eg: to retry when the mongodb is not up yet. The registered clients are skipped, so that only the failed ones are retried.
+func InitMongoE() error {
+	cfgs, err := envMongoConfigs()
 
-	if !ok {
-		return
+	if err != nil {
+		return err
 	}
 
-	keys := tree.Keys()
+	return initMongoConfigs(cfgs)
+}
 
-	if len(keys) == 0 {
-		return
-	}
+// envMongoConfigs returns the mongodb configs of yiigo.toml.
+func envMongoConfigs() (map[string]MongoConfig, error) {
+	cfgs := make(map[string]MongoConfig)
 
-	for _, v := range keys {
-		node, ok := tree.Get(v).(*toml.Tree)
+	err := envSection("mongo", func(name string, node *toml.Tree) error {
+		cfg := MongoConfig{}
 
-		if !ok {
-			continue
+		if err := unmarshalConfigNode(node, &cfg); err != nil {
+			return &initError{module: "mongodb", name: name, err: err}
 		}
 
-		cfg := new(mongoConfig)
+		cfgs[name] = cfg
+
+		return nil
+	})
+
+	return cfgs, err
+}
+
+// initMongoConfigs registers the mongodb clients of cfgs, the registered ones are skipped.
+func initMongoConfigs(cfgs map[string]MongoConfig) error {
+	names := make([]string, 0, len(cfgs))
+
+	for k := range cfgs {
+		names = append(names, k)
+	}
+
+	sort.Strings(names)
 
-		if err := node.Unmarshal(cfg); err != nil {
-			logger.Panic("yiigo: mongodb init error", zap.String("name", v), zap.Error(err))
+	for _, v := range names {
+		if _, ok := mgoMap.Load(v); ok {
+			continue
 		}
 
-		client, err := mongoDial(cfg)
+		cfg := cfgs[v]
+
+		client, err := mongoDial(&cfg)
 
 		if err != nil {
-			logger.Panic("yiigo: mongodb init error", zap.String("name", v), zap.Error(err))
+			return &initError{module: "mongodb", name: v, err: err}
 		}
 
 		if v == AsDefault {
@@ -114,25 +136,43 @@ func initMongoDB() {
 
 		mgoMap.Store(v, client)
 
-		logger.Info(fmt.Sprintf("yiigo: mongodb.%s is OK.", v))
+		logger().Info(fmt.Sprintf("yiigo: mongodb.%s is OK.", v))
 	}
+
+	return nil
 }
 
 // Mongo returns a mongo client.
+// It panics when the client is not registered, unless an error handler is specified by SetErrorHandler (nil is returned then).
 func Mongo(name ...string) *mongo.Client {
+	client, err := MongoE(name...)
+
+	if err != nil {
+		if !handleError("mongodb", resourceName(name), err) {
+			logger().Panic(err.Error())
+		}
+
+		return nil
+	}
+
+	return client
+}
+
+// MongoE returns a mongo client, an error is returned instead of panic when the client is not registered.
+func MongoE(name ...string) (*mongo.Client, error) {
 	if len(name) == 0 {
 		if defaultMongo == nil {
-			logger.Panic(fmt.Sprintf("yiigo: unknown mongodb.%s (forgotten configure?)", AsDefault))
+			return nil, fmt.Errorf("yiigo: unknown mongodb.%s (forgotten configure?)", AsDefault)
 		}
 
-		return defaultMongo
+		return defaultMongo, nil
 	}
 
 	v, ok := mgoMap.Load(name[0])
 
 	if !ok {
-		logger.Panic(fmt.Sprintf("yiigo: unknown mongodb.%s (forgotten configure?)", name[0]))
+		return nil, fmt.Errorf("yiigo: unknown mongodb.%s (forgotten configure?)", name[0])
 	}
 
-	return v.(*mongo.Client)
+	return v.(*mongo.Client), nil
 }
@@ -15,7 +15,7 @@ type NSQLogger struct{}
 
 // Output implements the NSQ logger interface
 func (l *NSQLogger) Output(calldepth int, s string) error {
-	logger.Error(s, zap.Int("call_depth", calldepth))
+	logger().Error(s, zap.Int("call_depth", calldepth))
 
 	return nil
 }
@@ -24,7 +24,7 @@ func initProducer(nsqd string) error {
 	p, err := nsq.NewProducer(nsqd, nsq.NewConfig())
 
 	if err != nil {
-		logger.Error("init producer error", zap.Error(err))
+		logger().Error("init producer error", zap.Error(err))
 
 		return err
 	}
@@ -74,6 +74,29 @@ func NSQDeferredPublish(topic string, msg NSQMessage, duration time.Duration) er
 	return nil
 }
 
+// NSQLogSink the remote log sink publishes the entries to a topic of NSQ (see WithLogRemoteSink)
+type NSQLogSink struct {
+	topic string
+}
+
+// NewNSQLogSink returns a log sink publishes to the topic, NSQ should be started by StartNSQ.
+func NewNSQLogSink(topic string) *NSQLogSink {
+	return &NSQLogSink{topic: topic}
+}
+
+// WriteBatch implements LogSink, the entries are published by MultiPublish.
+func (s *NSQLogSink) WriteBatch(entries [][]byte) error {
+	if producer == nil {
+		return errors.New("yiigo: nsq is not started")
+	}
+
+	if err := producer.MultiPublish(s.topic, entries); err != nil {
+		return errors.Wrap(err, "yiigo: publish nsq log error")
+	}
+
+	return nil
+}
+
 // NSQConsumer NSQ consumer
 type NSQConsumer interface {
 	nsq.Handler
@@ -137,7 +160,7 @@ func StartNSQ(consumers ...NSQConsumer) error {
 		return errors.Wrap(err, "yiigo: set nsq consumers error")
 	}
 
-	logger.Info("yiigo: nsq is OK.")
+	logger().Info("yiigo: nsq is OK.")
 
 	return nil
 }
@@ -0,0 +1,879 @@
+package yiigo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// poolSetting pool setting
+type poolSetting struct {
+	size         int
+	limit        int
+	idleTimeout  time.Duration
+	idleCheck    time.Duration
+	minIdle      int
+	waitTimeout  time.Duration
+	maxLifetime  time.Duration
+	prefill      int
+	prefillCount int
+	prefillAsync bool
+	hooks        []PoolHook
+}
+
+// prefillSize returns the number of resources to pre-fill, the whole pool unless WithPoolPrefillCount is specified.
+func (s *poolSetting) prefillSize() int {
+	if s.prefill <= 0 && !s.prefillAsync && s.prefillCount <= 0 {
+		return 0
+	}
+
+	if s.prefillCount > 0 && s.prefillCount < s.size {
+		return s.prefillCount
+	}
+
+	return s.size
+}
+
+// reaper reports whether the idle reaper is enabled.
+func (s *poolSetting) reaper() bool {
+	return s.idleCheck > 0 && s.idleTimeout > 0
+}
+
+// PoolOption configures how we set up the pool
+type PoolOption interface {
+	apply(*poolSetting)
+}
+
+// funcPoolOption implements pool option
+type funcPoolOption struct {
+	f func(*poolSetting)
+}
+
+func (fo *funcPoolOption) apply(s *poolSetting) {
+	fo.f(s)
+}
+
+func newFuncPoolOption(f func(*poolSetting)) *funcPoolOption {
+	return &funcPoolOption{f: f}
+}
+
+// WithPoolSize specifies the number of possible resources in the pool.
+func WithPoolSize(n int) PoolOption {
+	return newFuncPoolOption(func(s *poolSetting) {
+		s.size = n
+	})
+}
+
+// WithPoolLimit specifies the extent to which the pool can be resized in the future.
+// You cannot resize the pool beyond limit.
+func WithPoolLimit(n int) PoolOption {
+	return newFuncPoolOption(func(s *poolSetting) {
+		s.limit = n
+	})
+}
+
+// WithPoolIdleTimeout specifies the maximum amount of time a resource may be idle.
+// An idleTimeout of 0 means that there is no timeout.
+func WithPoolIdleTimeout(d time.Duration) PoolOption {
+	return newFuncPoolOption(func(s *poolSetting) {
+		s.idleTimeout = d
+	})
+}
+
+// WithPoolIdleCheckInterval specifies to run a reaper every d, which closes the resources idle longer than the idle timeout,
+// down to the minimum of WithPoolMinIdle. Without it, the idle resources are reopened in place and the pool never shrinks.
+func WithPoolIdleCheckInterval(d time.Duration) PoolOption {
+	return newFuncPoolOption(func(s *poolSetting) {
+		s.idleCheck = d
+	})
+}
+
+// WithPoolMinIdle specifies the number of idle resources kept by the reaper of WithPoolIdleCheckInterval.
+func WithPoolMinIdle(n int) PoolOption {
+	return newFuncPoolOption(func(s *poolSetting) {
+		s.minIdle = n
+	})
+}
+
+// WithPoolWaitTimeout specifies the maximum amount of time to wait for a resource from the pool.
+// It's the default deadline of Get when the ctx has none, an explicit deadline of ctx always wins.
+// A *PoolExhaustedError is returned when it's passed. A waitTimeout of 0 means that there is no timeout.
+func WithPoolWaitTimeout(d time.Duration) PoolOption {
+	return newFuncPoolOption(func(s *poolSetting) {
+		s.waitTimeout = d
+	})
+}
+
+// WithPoolMaxLifetime specifies the maximum amount of time a resource may be reused since created,
+// the older ones are closed and recreated by Get. A maxLifetime of 0 means that there is no limit.
+// Note: the resources of Pool must be comparable (eg: pointers) to be tracked, the redis pool tracks its connections itself.
+func WithPoolMaxLifetime(d time.Duration) PoolOption {
+	return newFuncPoolOption(func(s *poolSetting) {
+		s.maxLifetime = d
+	})
+}
+
+// WithPoolPrefill specifies how many resources can be opened in parallel when the pool is pre-filled.
+// A prefill of 0 means that the pool is not pre-filled, unless WithPoolPrefillAsync or WithPoolPrefillCount is specified.
+func WithPoolPrefill(parallelism int) PoolOption {
+	return newFuncPoolOption(func(s *poolSetting) {
+		s.prefill = parallelism
+	})
+}
+
+// WithPoolPrefillAsync specifies to pre-fill the pool in background, so that the pool is served without waiting for the dials.
+// The parallelism of WithPoolPrefill bounds the workers (default is 4), the failures are logged only.
+func WithPoolPrefillAsync() PoolOption {
+	return newFuncPoolOption(func(s *poolSetting) {
+		s.prefillAsync = true
+	})
+}
+
+// WithPoolPrefillCount specifies to pre-fill only n resources rather than the whole pool, eg: warm 5 of 50
+// to amortize the dial latency without flooding the server when many instances restart together.
+// It's clamped to the pool size, and composes with WithPoolPrefill and WithPoolPrefillAsync.
+func WithPoolPrefillCount(n int) PoolOption {
+	return newFuncPoolOption(func(s *poolSetting) {
+		s.prefillCount = n
+	})
+}
+
+// PoolHook observes the checkouts of pool, eg: for the metrics of waiting and holding, it must be safe for concurrent use.
+type PoolHook interface {
+	// OnGet is called after Get, waited is how long Get took and err is the error returned.
+	OnGet(name string, waited time.Duration, err error)
+	// OnPut is called by Put, held is how long the resource was checked out, broken reports whether it's discarded.
+	OnPut(name string, held time.Duration, broken bool)
+}
+
+// WithPoolHooks specifies the hooks called on Get and Put in order, it can be specified more than once.
+// The holding time is only tracked for the comparable resources (eg: pointers), the redis pool tracks its connections itself.
+func WithPoolHooks(hooks ...PoolHook) PoolOption {
+	return newFuncPoolOption(func(s *poolSetting) {
+		for _, h := range hooks {
+			if h != nil {
+				s.hooks = append(s.hooks, h)
+			}
+		}
+	})
+}
+
+// ErrPoolExhausted returned when no resource is available within the wait timeout, use errors.Is to check it.
+var ErrPoolExhausted = errors.New("yiigo: pool exhausted")
+
+// PoolExhaustedError the diagnostics of pool exhaustion, tells whether the pool is undersized or the resources are leaked.
+type PoolExhaustedError struct {
+	// Name the name of pool
+	Name string
+	// Size the current capacity of pool
+	Size int
+	// Limit the configured limit of pool
+	Limit int
+	// InUse the number of resources in use
+	InUse int64
+	// Waiters the number of callers waiting for a resource, including this one
+	Waiters int64
+	// Waited how long this caller waited
+	Waited time.Duration
+	// Err the error of the underlying pool
+	Err error
+}
+
+func (e *PoolExhaustedError) Error() string {
+	return fmt.Sprintf("%s (name: %s, size: %d, limit: %d, in_use: %d, waiters: %d, waited: %s): %v",
+		ErrPoolExhausted.Error(), e.Name, e.Size, e.Limit, e.InUse, e.Waiters, e.Waited, e.Err)
+}
+
+func (e *PoolExhaustedError) Is(target error) bool {
+	return target == ErrPoolExhausted
+}
+
+func (e *PoolExhaustedError) Unwrap() error {
+	return e.Err
+}
+
+// ErrPoolClosed returned by Get when the pool is closed.
+var ErrPoolClosed = errors.New("yiigo: pool is closed")
+
+var (
+	poolPrefillWorkers = 4
+	poolPrefillTimeout = 30 * time.Second
+)
+
+// PoolStats pool statistics
+type PoolStats struct {
+	Capacity  int64
+	Available int64
+	Active    int64
+	InUse     int64
+	Waiters   int64
+	WaitCount int64
+	WaitTime  time.Duration
+	Expired   int64
+	// Prefilled the number of resources created by the prefill
+	Prefilled int64
+	// IdleClosed the number of resources closed for the idle timeout
+	IdleClosed int64
+}
+
+// poolEntry a slot of the pool, the resource is nil for an empty slot which is filled on demand
+type poolEntry struct {
+	resource io.Closer
+	// created the creation time, tracked for the max lifetime
+	created time.Time
+	// used the time returned to the pool
+	used time.Time
+	// borrowed the checkout time, tracked for the hooks
+	borrowed time.Time
+	// comparable reports whether the resource can be matched on Put, checked once it's created
+	comparable bool
+}
+
+// Pool a resource pool configured by PoolOption, eg: for SMPP or thrift connections, the redis pool is built on it too.
+// The resources are io.Closer (no generics in go1.13), assert them to the concrete type after Get.
+type Pool struct {
+	// int64 first for the 64-bit alignment of atomic operations
+	capacity   int64
+	active     int64
+	inUse      int64
+	waiters    int64
+	waitCount  int64
+	waitTime   int64
+	expired    int64
+	prefilled  int64
+	idleClosed int64
+	closed     int32
+	drained    int32
+
+	name    string
+	setting *poolSetting
+	// factory creates the resources with the ctx of Get, so the dial is bounded by the caller's deadline
+	factory func(ctx context.Context) (io.Closer, error)
+	// slots the slots of capacity, a Get takes one and the Put returns it
+	slots chan poolEntry
+	// size the number of slots, guarded by mutex, it follows the capacity after resizing
+	size int
+	// mutex serializes the resizing and draining
+	mutex sync.Mutex
+	// done is closed by Close, it wakes up the waiters and stops the reaper
+	done chan struct{}
+	// track reports whether the entries checked out are tracked, for the max lifetime and the hooks
+	track bool
+	// lent the entries checked out in order, never outnumber the resources in use
+	lent      []poolEntry
+	lentMutex sync.Mutex
+}
+
+// NewPool returns a new resource pool, the resources are created by factory on demand.
+// The default size is 10, limit is 20, idle timeout is 60s and wait timeout is 10s.
+func NewPool(factory func() (io.Closer, error), options ...PoolOption) *Pool {
+	setting := &poolSetting{
+		size:        10,
+		limit:       20,
+		idleTimeout: 60 * time.Second,
+		waitTimeout: 10 * time.Second,
+	}
+
+	for _, option := range options {
+		option.apply(setting)
+	}
+
+	return newPool("", func(ctx context.Context) (io.Closer, error) {
+		return factory()
+	}, setting, setting.maxLifetime > 0 || len(setting.hooks) != 0)
+}
+
+// newPool returns a new resource pool, track specifies to track the entries checked out (see Pool.lent),
+// the redis pool tracks its connections itself.
+func newPool(name string, factory func(ctx context.Context) (io.Closer, error), setting *poolSetting, track bool) *Pool {
+	if setting.size <= 0 || setting.limit <= 0 || setting.size > setting.limit {
+		panic(fmt.Errorf("yiigo: invalid pool size %d with limit %d", setting.size, setting.limit))
+	}
+
+	p := &Pool{
+		capacity: int64(setting.size),
+		size:     setting.size,
+		name:     name,
+		setting:  setting,
+		factory:  factory,
+		slots:    make(chan poolEntry, setting.limit),
+		done:     make(chan struct{}),
+		track:    track,
+	}
+
+	for i := 0; i < setting.size; i++ {
+		p.slots <- poolEntry{}
+	}
+
+	if n := setting.prefillSize(); n > 0 {
+		if setting.prefillAsync {
+			go p.prefill(n)
+		} else {
+			p.prefill(n)
+		}
+	}
+
+	if setting.idleTimeout > 0 {
+		go p.reapIdle()
+	}
+
+	return p
+}
+
+// prefill creates n resources, bounded by the prefill parallelism (default is 4).
+func (p *Pool) prefill(n int) {
+	workers := p.setting.prefill
+
+	if workers <= 0 {
+		workers = poolPrefillWorkers
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), poolPrefillTimeout)
+
+	defer cancel()
+
+	sem := make(chan struct{}, workers)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+
+		sem <- struct{}{}
+
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			resource, err := p.get(ctx)
+
+			if err != nil {
+				if _, ok := err.(*PoolExhaustedError); !ok && err != ErrPoolClosed {
+					logThrottled(ctx, zap.WarnLevel, "yiigo: pool prefill error", zap.String("name", p.name), zap.Error(err))
+				}
+
+				return
+			}
+
+			atomic.AddInt64(&p.prefilled, 1)
+
+			p.release(resource)
+		}()
+	}
+
+	wg.Wait()
+}
+
+// Get returns a resource from the pool, it waits for a returned one when all are in use,
+// bounded by the deadline of ctx, or the wait timeout when ctx has no deadline.
+// A *PoolExhaustedError is returned when the waiting times out, ErrPoolClosed when the pool is closed,
+// and the error of factory when failed to create the resource.
+func (p *Pool) Get(ctx context.Context) (io.Closer, error) {
+	if len(p.setting.hooks) == 0 {
+		return p.acquire(ctx)
+	}
+
+	start := time.Now()
+
+	resource, err := p.acquire(ctx)
+
+	p.onGet(p.name, time.Since(start), err)
+
+	return resource, err
+}
+
+func (p *Pool) onGet(name string, waited time.Duration, err error) {
+	for _, h := range p.setting.hooks {
+		h.OnGet(name, waited, err)
+	}
+}
+
+func (p *Pool) onPut(name string, held time.Duration, broken bool) {
+	for _, h := range p.setting.hooks {
+		h.OnPut(name, held, broken)
+	}
+}
+
+// acquire is Get without the hooks.
+func (p *Pool) acquire(ctx context.Context) (io.Closer, error) {
+	if _, ok := ctx.Deadline(); !ok && p.setting.waitTimeout != 0 {
+		c, cancel := context.WithTimeout(ctx, p.setting.waitTimeout)
+
+		defer cancel()
+
+		ctx = c
+	}
+
+	return p.get(ctx)
+}
+
+// get takes a slot and fills it when empty, the expired or idle timed out resource is closed and recreated.
+func (p *Pool) get(ctx context.Context) (io.Closer, error) {
+	if atomic.LoadInt32(&p.closed) == 1 {
+		return nil, ErrPoolClosed
+	}
+
+	var entry poolEntry
+
+	select {
+	// don't race with the slots when ctx is done already
+	case <-ctx.Done():
+		return nil, p.exhausted(ctx.Err(), atomic.LoadInt64(&p.waiters)+1, 0)
+	default:
+	}
+
+	select {
+	case entry = <-p.slots:
+	default:
+		e, err := p.wait(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		entry = e
+	}
+
+	// returned by others while closing, leave it to the draining
+	if atomic.LoadInt32(&p.closed) == 1 {
+		p.slots <- entry
+
+		return nil, ErrPoolClosed
+	}
+
+	if entry.resource != nil && p.isExpired(entry) {
+		atomic.AddInt64(&p.expired, 1)
+
+		p.discard(entry.resource)
+
+		entry.resource = nil
+	}
+
+	if entry.resource == nil {
+		resource, err := p.open(ctx)
+
+		if err != nil {
+			// the slot is kept for the next try
+			p.slots <- poolEntry{}
+
+			return nil, err
+		}
+
+		entry = p.newEntry(resource)
+	}
+
+	if p.track {
+		entry.borrowed = time.Now()
+
+		p.lend(entry)
+	}
+
+	atomic.AddInt64(&p.inUse, 1)
+
+	return entry.resource, nil
+}
+
+// wait waits for a slot when all are taken, bounded by ctx.
+func (p *Pool) wait(ctx context.Context) (poolEntry, error) {
+	waiters := atomic.AddInt64(&p.waiters, 1)
+
+	defer atomic.AddInt64(&p.waiters, -1)
+
+	start := time.Now()
+
+	select {
+	case entry := <-p.slots:
+		atomic.AddInt64(&p.waitCount, 1)
+		atomic.AddInt64(&p.waitTime, int64(time.Since(start)))
+
+		return entry, nil
+	case <-ctx.Done():
+		return poolEntry{}, p.exhausted(ctx.Err(), waiters, time.Since(start))
+	case <-p.done:
+		return poolEntry{}, ErrPoolClosed
+	}
+}
+
+func (p *Pool) exhausted(err error, waiters int64, waited time.Duration) *PoolExhaustedError {
+	return &PoolExhaustedError{
+		Name:    p.name,
+		Size:    int(atomic.LoadInt64(&p.capacity)),
+		Limit:   p.setting.limit,
+		InUse:   atomic.LoadInt64(&p.inUse),
+		Waiters: waiters,
+		Waited:  waited,
+		Err:     err,
+	}
+}
+
+// open creates a new resource by the factory, bounded by ctx.
+func (p *Pool) open(ctx context.Context) (io.Closer, error) {
+	resource, err := p.factory(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	atomic.AddInt64(&p.active, 1)
+
+	return resource, nil
+}
+
+// newEntry returns the entry of a resource just created.
+func (p *Pool) newEntry(resource io.Closer) poolEntry {
+	now := time.Now()
+
+	entry := poolEntry{resource: resource, created: now, used: now}
+
+	if p.track {
+		entry.comparable = reflect.TypeOf(resource).Comparable()
+	}
+
+	return entry
+}
+
+// lend records the entry checked out.
+func (p *Pool) lend(entry poolEntry) {
+	p.lentMutex.Lock()
+
+	p.lent = append(p.lent, entry)
+
+	p.lentMutex.Unlock()
+}
+
+// giveBack takes the entry of the returned resource out of the ones checked out, false is returned when it's not found.
+// The oldest one is taken out for a nil or unknown resource (eg: closed by the caller), so that the entries never outnumber the checkouts.
+func (p *Pool) giveBack(resource io.Closer) (poolEntry, bool) {
+	p.lentMutex.Lock()
+
+	defer p.lentMutex.Unlock()
+
+	if len(p.lent) == 0 {
+		return poolEntry{}, false
+	}
+
+	index, found := 0, false
+
+	if resource != nil {
+		for i, v := range p.lent {
+			// the same dynamic type is comparable too
+			if v.comparable && v.resource == resource {
+				index, found = i, true
+
+				break
+			}
+		}
+	}
+
+	entry := p.lent[index]
+
+	copy(p.lent[index:], p.lent[index+1:])
+
+	// so that the resource is not retained by the backing array
+	p.lent[len(p.lent)-1] = poolEntry{}
+	p.lent = p.lent[:len(p.lent)-1]
+
+	return entry, found
+}
+
+// discard closes the resource taken out of the pool, its slot is left empty.
+func (p *Pool) discard(resource io.Closer) {
+	resource.Close()
+
+	atomic.AddInt64(&p.active, -1)
+}
+
+// reapIdle checks the idle resources until the pool is closed,
+// every idle timeout / 10 like vitess_pool did, or the interval of WithPoolIdleCheckInterval.
+func (p *Pool) reapIdle() {
+	interval := p.setting.idleTimeout / 10
+
+	if p.setting.reaper() {
+		interval = p.setting.idleCheck
+	}
+
+	ticker := time.NewTicker(interval)
+
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			p.reap()
+		}
+	}
+}
+
+// reap closes the resources idle longer than the idle timeout, down to the min idle when the reaper is enabled,
+// otherwise they are reopened in place. Only the slots in the pool are visited, the resources checked out are never touched.
+func (p *Pool) reap() {
+	shrink := p.setting.reaper()
+
+	var kept []poolEntry
+
+loop:
+	for n := len(p.slots); n > 0 && atomic.LoadInt32(&p.closed) == 0; n-- {
+		var entry poolEntry
+
+		select {
+		case entry = <-p.slots:
+		default:
+			break loop
+		}
+
+		// the idle ones: opened and not in use
+		idle := atomic.LoadInt64(&p.active) - atomic.LoadInt64(&p.inUse)
+
+		if entry.resource != nil && time.Since(entry.used) > p.setting.idleTimeout && (!shrink || idle > int64(p.setting.minIdle)) {
+			atomic.AddInt64(&p.idleClosed, 1)
+
+			p.discard(entry.resource)
+
+			entry = poolEntry{}
+
+			if !shrink {
+				if resource, err := p.reopen(); err == nil {
+					entry = p.newEntry(resource)
+				}
+			}
+		}
+
+		kept = append(kept, entry)
+	}
+
+	for _, entry := range kept {
+		p.slots <- entry
+	}
+}
+
+// reopen creates a resource in place of the idle timed out one, bounded by the wait timeout.
+func (p *Pool) reopen() (io.Closer, error) {
+	ctx := context.Background()
+
+	if p.setting.waitTimeout != 0 {
+		c, cancel := context.WithTimeout(ctx, p.setting.waitTimeout)
+
+		defer cancel()
+
+		ctx = c
+	}
+
+	return p.open(ctx)
+}
+
+// isExpired reports whether the resource of entry is older than the max lifetime, the untracked ones never expire.
+func (p *Pool) isExpired(entry poolEntry) bool {
+	return p.track && p.setting.maxLifetime > 0 && time.Since(entry.created) > p.setting.maxLifetime
+}
+
+// Put returns a resource to the pool, every successful Get requires a Put.
+// The broken resource (its Err() returns an error, eg: redis.Conn) is closed and its slot is left empty,
+// a new one is created by the next Get, so is the nil, which should be passed instead of a resource closed by the caller
+// (the holding time of hooks is unknown then, and the oldest checkout is assumed to be returned).
+// The resource returned to a closed pool is closed.
+func (p *Pool) Put(resource io.Closer) {
+	if len(p.setting.hooks) == 0 {
+		p.release(resource)
+
+		return
+	}
+
+	broken := poolBroken(resource)
+
+	var held time.Duration
+
+	if borrowed := p.release(resource); !borrowed.IsZero() {
+		held = time.Since(borrowed)
+	}
+
+	p.onPut(p.name, held, broken)
+}
+
+// poolBroken reports whether the returned resource is discarded, nil or its Err() returns an error.
+func poolBroken(resource io.Closer) bool {
+	if resource == nil {
+		return true
+	}
+
+	v, ok := resource.(interface{ Err() error })
+
+	return ok && v.Err() != nil
+}
+
+// release is Put without the hooks, the checkout time of a tracked resource is returned.
+func (p *Pool) release(resource io.Closer) time.Time {
+	var lent poolEntry
+
+	if p.track {
+		// the nil and unknown ones are treated as new
+		if e, found := p.giveBack(resource); found {
+			lent = e
+		}
+	}
+
+	if atomic.LoadInt32(&p.closed) == 1 {
+		p.putClosed(resource)
+
+		return lent.borrowed
+	}
+
+	var entry poolEntry
+
+	// the slot of broken one is left empty and filled by the next Get, so that Put never waits for the factory
+	if poolBroken(resource) {
+		if resource != nil {
+			p.discard(resource)
+		} else {
+			atomic.AddInt64(&p.active, -1)
+		}
+	} else if lent.resource != nil {
+		entry = lent
+		entry.used = time.Now()
+		entry.borrowed = time.Time{}
+	} else {
+		entry = p.newEntry(resource)
+	}
+
+	select {
+	case p.slots <- entry:
+	default:
+		panic(errors.New("yiigo: put into a full pool"))
+	}
+
+	atomic.AddInt64(&p.inUse, -1)
+
+	return lent.borrowed
+}
+
+// putClosed closes the resource returned to the closed pool, the empty slot is left to the draining.
+func (p *Pool) putClosed(resource io.Closer) {
+	if resource != nil {
+		p.discard(resource)
+	} else {
+		atomic.AddInt64(&p.active, -1)
+	}
+
+	// an extra Put after drained
+	if atomic.LoadInt32(&p.drained) == 1 {
+		return
+	}
+
+	select {
+	case p.slots <- poolEntry{}:
+	default:
+	}
+
+	atomic.AddInt64(&p.inUse, -1)
+}
+
+// SetCapacity resizes the pool within (0, limit], it waits for the resources in use to be returned when shrinking.
+func (p *Pool) SetCapacity(size int) error {
+	if size <= 0 || size > p.setting.limit {
+		return fmt.Errorf("yiigo: pool capacity %d is out of range (0, %d]", size, p.setting.limit)
+	}
+
+	p.mutex.Lock()
+
+	defer p.mutex.Unlock()
+
+	if atomic.LoadInt32(&p.closed) == 1 {
+		return ErrPoolClosed
+	}
+
+	atomic.StoreInt64(&p.capacity, int64(size))
+
+	for ; p.size > size; p.size-- {
+		var entry poolEntry
+
+		select {
+		case entry = <-p.slots:
+		case <-p.done:
+			return ErrPoolClosed
+		}
+
+		if entry.resource != nil {
+			p.discard(entry.resource)
+		}
+	}
+
+	for ; p.size < size; p.size++ {
+		p.slots <- poolEntry{}
+	}
+
+	return nil
+}
+
+// IsClosed reports whether the pool is closed.
+func (p *Pool) IsClosed() bool {
+	return atomic.LoadInt32(&p.closed) == 1
+}
+
+// Close stops handing out resources, waits for the resources in use to be returned and closes all of them.
+// When ctx is done before all are returned, an error with the number of the abandoned resources is returned,
+// they are still closed if returned (Put) later. Closing a closed pool returns nil.
+func (p *Pool) Close(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&p.closed, 0, 1) {
+		return nil
+	}
+
+	close(p.done)
+
+	done := make(chan struct{})
+
+	go func() {
+		p.drain()
+
+		atomic.StoreInt32(&p.drained, 1)
+
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("yiigo: pool closed with %d resources abandoned: %w", atomic.LoadInt64(&p.inUse), ctx.Err())
+	}
+}
+
+// drain takes all the slots back and closes the resources.
+func (p *Pool) drain() {
+	p.mutex.Lock()
+
+	defer p.mutex.Unlock()
+
+	atomic.StoreInt64(&p.capacity, 0)
+
+	for ; p.size > 0; p.size-- {
+		if entry := <-p.slots; entry.resource != nil {
+			p.discard(entry.resource)
+		}
+	}
+}
+
+// Stats returns the pool statistics.
+func (p *Pool) Stats() PoolStats {
+	return PoolStats{
+		Capacity:   atomic.LoadInt64(&p.capacity),
+		Available:  int64(len(p.slots)),
+		Active:     atomic.LoadInt64(&p.active),
+		InUse:      atomic.LoadInt64(&p.inUse),
+		Waiters:    atomic.LoadInt64(&p.waiters),
+		WaitCount:  atomic.LoadInt64(&p.waitCount),
+		WaitTime:   time.Duration(atomic.LoadInt64(&p.waitTime)),
+		Expired:    atomic.LoadInt64(&p.expired),
+		Prefilled:  atomic.LoadInt64(&p.prefilled),
+		IdleClosed: atomic.LoadInt64(&p.idleClosed),
+	}
+}
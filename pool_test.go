@@ -0,0 +1,647 @@
+package yiigo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shenghui0779/vitess_pool"
+	"github.com/stretchr/testify/assert"
+)
+
+type testPoolConn struct {
+	id     int64
+	err    error
+	closed int32
+}
+
+func (c *testPoolConn) Close() error {
+	atomic.StoreInt32(&c.closed, 1)
+
+	return nil
+}
+
+func (c *testPoolConn) Err() error {
+	return c.err
+}
+
+func TestPool(t *testing.T) {
+	var created int64
+
+	pool := NewPool(func() (io.Closer, error) {
+		return &testPoolConn{id: atomic.AddInt64(&created, 1)}, nil
+	}, WithPoolSize(1), WithPoolLimit(2), WithPoolWaitTimeout(20*time.Millisecond))
+
+	ctx := context.Background()
+
+	resource, err := pool.Get(ctx)
+
+	assert.Nil(t, err)
+
+	conn := resource.(*testPoolConn)
+
+	assert.Equal(t, int64(1), conn.id)
+	assert.Equal(t, int64(1), pool.Stats().InUse)
+
+	// exhausted
+	_, err = pool.Get(ctx)
+
+	assert.True(t, errors.Is(err, ErrPoolExhausted))
+
+	// reused
+	pool.Put(conn)
+
+	resource, err = pool.Get(ctx)
+
+	assert.Nil(t, err)
+	assert.Equal(t, conn, resource)
+
+	// the broken resource is closed and replaced
+	conn.err = errors.New("broken")
+
+	pool.Put(conn)
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&conn.closed))
+
+	resource, err = pool.Get(ctx)
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), resource.(*testPoolConn).id)
+
+	pool.Put(resource)
+
+	stats := pool.Stats()
+
+	assert.Equal(t, int64(1), stats.Capacity)
+	assert.Equal(t, int64(0), stats.InUse)
+
+	assert.Nil(t, pool.Close(context.Background()))
+	assert.True(t, pool.IsClosed())
+
+	_, err = pool.Get(ctx)
+
+	assert.Equal(t, ErrPoolClosed, err)
+}
+
+func TestPoolFactoryError(t *testing.T) {
+	pool := NewPool(func() (io.Closer, error) {
+		return nil, errors.New("dial error")
+	}, WithPoolSize(1))
+
+	defer pool.Close(context.Background())
+
+	_, err := pool.Get(context.Background())
+
+	assert.EqualError(t, err, "dial error")
+
+	// the slot is kept for the next try
+	assert.Equal(t, int64(1), pool.Stats().Available)
+}
+
+func TestPoolPutBroken(t *testing.T) {
+	var (
+		created int64
+		failed  int32
+	)
+
+	// slow after the first one, and fails when failed is set
+	pool := NewPool(func() (io.Closer, error) {
+		if atomic.AddInt64(&created, 1) > 1 {
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		if atomic.LoadInt32(&failed) == 1 {
+			return nil, errors.New("dial error")
+		}
+
+		return &testPoolConn{}, nil
+	}, WithPoolSize(1))
+
+	defer pool.Close(context.Background())
+
+	resource, err := pool.Get(context.Background())
+
+	assert.Nil(t, err)
+
+	resource.(*testPoolConn).err = errors.New("broken")
+
+	// never waits for the factory
+	start := time.Now()
+
+	pool.Put(resource)
+
+	assert.True(t, time.Since(start) < 50*time.Millisecond)
+	assert.Equal(t, int64(1), atomic.LoadInt64(&created))
+
+	stats := pool.Stats()
+
+	assert.Equal(t, int64(1), stats.Available)
+	assert.Equal(t, int64(0), stats.Active)
+	assert.Equal(t, int64(0), stats.InUse)
+
+	// the nil of a resource closed by the caller
+	atomic.StoreInt32(&failed, 1)
+
+	_, err = pool.Get(context.Background())
+
+	assert.EqualError(t, err, "dial error")
+
+	atomic.StoreInt32(&failed, 0)
+
+	resource, err = pool.Get(context.Background())
+
+	assert.Nil(t, err)
+
+	atomic.StoreInt32(&failed, 1)
+
+	start = time.Now()
+
+	pool.Put(nil)
+
+	assert.True(t, time.Since(start) < 50*time.Millisecond)
+	assert.Equal(t, int64(3), atomic.LoadInt64(&created))
+	assert.Equal(t, int64(0), pool.Stats().Active)
+	assert.Equal(t, int64(1), pool.Stats().Available)
+}
+
+func TestPoolMaxLifetime(t *testing.T) {
+	var created int64
+
+	pool := NewPool(func() (io.Closer, error) {
+		return &testPoolConn{id: atomic.AddInt64(&created, 1)}, nil
+	}, WithPoolSize(1), WithPoolMaxLifetime(50*time.Millisecond))
+
+	defer pool.Close(context.Background())
+
+	ctx := context.Background()
+
+	resource, err := pool.Get(ctx)
+
+	assert.Nil(t, err)
+
+	old := resource.(*testPoolConn)
+
+	pool.Put(old)
+
+	// not expired yet
+	resource, err = pool.Get(ctx)
+
+	assert.Nil(t, err)
+	assert.Equal(t, old, resource)
+
+	pool.Put(resource)
+
+	time.Sleep(60 * time.Millisecond)
+
+	resource, err = pool.Get(ctx)
+
+	assert.Nil(t, err)
+	assert.NotEqual(t, old, resource)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&old.closed))
+	assert.Equal(t, int64(1), pool.Stats().Expired)
+
+	pool.Put(resource)
+}
+
+func TestPoolCloseWhileBorrowed(t *testing.T) {
+	pool := NewPool(func() (io.Closer, error) {
+		return &testPoolConn{}, nil
+	}, WithPoolSize(2))
+
+	ctx := context.Background()
+
+	a, err := pool.Get(ctx)
+
+	assert.Nil(t, err)
+
+	b, err := pool.Get(ctx)
+
+	assert.Nil(t, err)
+
+	// a is returned in time, b is abandoned
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+
+		pool.Put(a)
+	}()
+
+	cctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+
+	defer cancel()
+
+	err = pool.Close(cctx)
+
+	assert.EqualError(t, err, "yiigo: pool closed with 1 resources abandoned: context deadline exceeded")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&a.(*testPoolConn).closed))
+
+	// no more resource is handed out
+	_, err = pool.Get(ctx)
+
+	assert.Equal(t, ErrPoolClosed, err)
+
+	// closed on return without panic
+	pool.Put(b)
+
+	for i := 0; i < 100 && atomic.LoadInt32(&b.(*testPoolConn).closed) == 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&b.(*testPoolConn).closed))
+
+	// double close
+	assert.Nil(t, pool.Close(ctx))
+
+	// an extra Put after drained
+	c := &testPoolConn{}
+
+	assert.NotPanics(t, func() {
+		pool.Put(c)
+	})
+	assert.Equal(t, int32(1), atomic.LoadInt32(&c.closed))
+}
+
+func TestPoolWaitTimeout(t *testing.T) {
+	pool := NewPool(func() (io.Closer, error) {
+		return &testPoolConn{}, nil
+	}, WithPoolSize(1), WithPoolWaitTimeout(20*time.Millisecond))
+
+	defer pool.Close(context.Background())
+
+	resource, err := pool.Get(context.Background())
+
+	assert.Nil(t, err)
+
+	// the default deadline
+	_, err = pool.Get(context.Background())
+
+	var e *PoolExhaustedError
+
+	assert.True(t, errors.As(err, &e))
+	assert.True(t, e.Waited >= 20*time.Millisecond && e.Waited < time.Second)
+
+	// the explicit deadline wins, even if it's longer
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+
+		pool.Put(resource)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+
+	defer cancel()
+
+	start := time.Now()
+
+	resource, err = pool.Get(ctx)
+
+	assert.Nil(t, err)
+	assert.True(t, time.Since(start) >= 40*time.Millisecond)
+
+	pool.Put(resource)
+}
+
+func TestPoolPrefillCount(t *testing.T) {
+	var created int64
+
+	factory := func() (io.Closer, error) {
+		return &testPoolConn{id: atomic.AddInt64(&created, 1)}, nil
+	}
+
+	pool := NewPool(factory, WithPoolSize(10), WithPoolPrefillCount(3))
+
+	stats := pool.Stats()
+
+	assert.Equal(t, int64(3), atomic.LoadInt64(&created))
+	assert.Equal(t, int64(3), stats.Prefilled)
+	assert.Equal(t, int64(3), stats.Active)
+	assert.Equal(t, int64(10), stats.Available)
+
+	assert.Nil(t, pool.Close(context.Background()))
+
+	// clamped to the pool size, in background
+	atomic.StoreInt64(&created, 0)
+
+	pool = NewPool(factory, WithPoolSize(2), WithPoolPrefillCount(5), WithPoolPrefillAsync())
+
+	defer pool.Close(context.Background())
+
+	for i := 0; i < 100 && pool.Stats().Prefilled < 2; i++ {
+		time.Sleep(time.Millisecond)
+	}
+
+	assert.Equal(t, int64(2), pool.Stats().Prefilled)
+	assert.Equal(t, int64(2), atomic.LoadInt64(&created))
+}
+
+func TestPoolIdleReaper(t *testing.T) {
+	pool := NewPool(func() (io.Closer, error) {
+		return &testPoolConn{}, nil
+	}, WithPoolSize(5), WithPoolIdleTimeout(30*time.Millisecond), WithPoolIdleCheckInterval(10*time.Millisecond), WithPoolMinIdle(1))
+
+	ctx := context.Background()
+
+	conns := make([]io.Closer, 0, 5)
+
+	for i := 0; i < 5; i++ {
+		resource, err := pool.Get(ctx)
+
+		assert.Nil(t, err)
+
+		conns = append(conns, resource)
+	}
+
+	// the checked out one is never closed
+	for _, v := range conns[1:] {
+		pool.Put(v)
+	}
+
+	for i := 0; i < 100 && pool.Stats().IdleClosed < 3; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	stats := pool.Stats()
+
+	assert.Equal(t, int64(3), stats.IdleClosed)
+	assert.Equal(t, int64(2), stats.Active)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&conns[0].(*testPoolConn).closed))
+
+	// the min idle is kept
+	time.Sleep(50 * time.Millisecond)
+
+	assert.Equal(t, int64(3), pool.Stats().IdleClosed)
+
+	pool.Put(conns[0])
+
+	// the reaped slots are served again
+	for i := 0; i < 5; i++ {
+		resource, err := pool.Get(ctx)
+
+		assert.Nil(t, err)
+
+		conns[i] = resource
+	}
+
+	for _, v := range conns {
+		pool.Put(v)
+	}
+
+	assert.Nil(t, pool.Close(ctx))
+}
+
+type testPoolHook struct {
+	mutex  sync.Mutex
+	events []string
+	held   time.Duration
+}
+
+func (h *testPoolHook) OnGet(name string, waited time.Duration, err error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.events = append(h.events, fmt.Sprintf("get %s %v", name, err))
+}
+
+func (h *testPoolHook) OnPut(name string, held time.Duration, broken bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.events = append(h.events, fmt.Sprintf("put %s %v", name, broken))
+	h.held = held
+}
+
+func TestPoolHooks(t *testing.T) {
+	a, b := new(testPoolHook), new(testPoolHook)
+
+	pool := NewPool(func() (io.Closer, error) {
+		return &testPoolConn{}, nil
+	}, WithPoolSize(1), WithPoolWaitTimeout(10*time.Millisecond), WithPoolHooks(a, nil), WithPoolHooks(b))
+
+	defer pool.Close(context.Background())
+
+	ctx := context.Background()
+
+	resource, err := pool.Get(ctx)
+
+	assert.Nil(t, err)
+
+	_, exhausted := pool.Get(ctx)
+
+	assert.True(t, errors.Is(exhausted, ErrPoolExhausted))
+
+	time.Sleep(20 * time.Millisecond)
+
+	pool.Put(resource)
+
+	assert.True(t, a.held >= 20*time.Millisecond)
+
+	resource, err = pool.Get(ctx)
+
+	assert.Nil(t, err)
+
+	resource.(*testPoolConn).err = errors.New("broken")
+
+	pool.Put(resource)
+
+	expected := []string{
+		"get  <nil>",
+		"get  " + exhausted.Error(),
+		"put  false",
+		"get  <nil>",
+		"put  true",
+	}
+
+	assert.Equal(t, expected, a.events)
+	assert.Equal(t, expected, b.events)
+}
+
+func TestPoolPutNil(t *testing.T) {
+	var created int64
+
+	hook := new(testPoolHook)
+
+	pool := NewPool(func() (io.Closer, error) {
+		return &testPoolConn{id: atomic.AddInt64(&created, 1)}, nil
+	}, WithPoolSize(2), WithPoolMaxLifetime(time.Minute), WithPoolHooks(hook))
+
+	defer pool.Close(context.Background())
+
+	ctx := context.Background()
+
+	// closed by the caller, the entries checked out never outnumber the resources in use
+	for i := 0; i < 100; i++ {
+		resource, err := pool.Get(ctx)
+
+		assert.Nil(t, err)
+
+		resource.Close()
+
+		pool.Put(nil)
+	}
+
+	assert.Equal(t, 0, len(pool.lent))
+	assert.Equal(t, int64(100), atomic.LoadInt64(&created))
+
+	// the creation time is kept through the checkouts
+	a, err := pool.Get(ctx)
+
+	assert.Nil(t, err)
+
+	b, err := pool.Get(ctx)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(pool.lent))
+
+	time.Sleep(10 * time.Millisecond)
+
+	pool.Put(b)
+
+	assert.Equal(t, 1, len(pool.lent))
+	assert.True(t, hook.held >= 10*time.Millisecond)
+
+	entry := <-pool.slots
+
+	assert.Equal(t, b, entry.resource)
+	assert.True(t, time.Since(entry.created) >= 10*time.Millisecond)
+
+	pool.slots <- entry
+
+	pool.Put(a)
+
+	assert.Equal(t, 0, len(pool.lent))
+}
+
+func TestPoolStress(t *testing.T) {
+	var created, closed int64
+
+	pool := NewPool(func() (io.Closer, error) {
+		atomic.AddInt64(&created, 1)
+
+		return &testPoolConn{}, nil
+	}, WithPoolSize(4), WithPoolLimit(8), WithPoolWaitTimeout(time.Second), WithPoolIdleTimeout(time.Millisecond),
+		WithPoolIdleCheckInterval(time.Millisecond), WithPoolMaxLifetime(5*time.Millisecond), WithPoolHooks(new(testPoolHook)))
+
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < 500; j++ {
+				resource, err := pool.Get(ctx)
+
+				if !assert.Nil(t, err) {
+					return
+				}
+
+				conn := resource.(*testPoolConn)
+
+				if !assert.Equal(t, int32(0), atomic.LoadInt32(&conn.closed)) {
+					return
+				}
+
+				if j%50 == 0 {
+					conn.Close()
+					atomic.AddInt64(&closed, 1)
+
+					pool.Put(nil)
+
+					continue
+				}
+
+				pool.Put(resource)
+			}
+		}(i)
+	}
+
+	// resize meanwhile
+	for _, size := range []int{8, 2, 6, 4} {
+		assert.Nil(t, pool.SetCapacity(size))
+	}
+
+	wg.Wait()
+
+	stats := pool.Stats()
+
+	assert.Equal(t, int64(4), stats.Capacity)
+	assert.Equal(t, int64(4), stats.Available)
+	assert.Equal(t, int64(0), stats.InUse)
+	assert.True(t, stats.Active <= 4)
+
+	assert.Nil(t, pool.Close(ctx))
+	assert.Equal(t, int64(0), pool.Stats().Active)
+}
+
+// benchVitessResource adapts io.Closer to vitess_pool, as Pool did when it was built on vitess_pool
+type benchVitessResource struct {
+	io.Closer
+	used time.Time
+}
+
+func (r benchVitessResource) Close() {
+	r.Closer.Close()
+}
+
+func BenchmarkPool(b *testing.B) {
+	pool := NewPool(func() (io.Closer, error) {
+		return &testPoolConn{}, nil
+	}, WithPoolSize(16), WithPoolLimit(16))
+
+	defer pool.Close(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+
+	defer cancel()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			resource, err := pool.Get(ctx)
+
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			pool.Put(resource)
+		}
+	})
+}
+
+// BenchmarkVitessPool the vitess_pool which Pool was built on before, for comparison
+func BenchmarkVitessPool(b *testing.B) {
+	pool := vitess_pool.NewResourcePool(func() (vitess_pool.Resource, error) {
+		return benchVitessResource{Closer: &testPoolConn{}, used: time.Now()}, nil
+	}, 16, 16, time.Minute, 0)
+
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+
+	defer cancel()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			resource, err := pool.Get(ctx)
+
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			pool.Put(benchVitessResource{Closer: resource.(benchVitessResource).Closer, used: time.Now()})
+		}
+	})
+}
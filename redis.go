@@ -2,189 +2,2042 @@ package yiigo
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
 	"github.com/pelletier/go-toml"
-	"github.com/shenghui0779/vitess_pool"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
 )
 
-type redisConfig struct {
-	Address            string `toml:"address"`
-	Password           string `toml:"password"`
-	Database           int    `toml:"database"`
-	ConnTimeout        int    `toml:"conn_timeout"`
-	ReadTimeout        int    `toml:"read_timeout"`
-	WriteTimeout       int    `toml:"write_timeout"`
-	PoolSize           int    `toml:"pool_size"`
-	PoolLimit          int    `toml:"pool_limit"`
-	IdleTimeout        int    `toml:"idle_timeout"`
-	WaitTimeout        int    `toml:"wait_timeout"`
-	PrefillParallelism int    `toml:"prefill_parallelism"`
+// RedisPoolConfig the config of redis pool, it's the [redis.name] of yiigo.toml, or the Redis of Config.
+type RedisPoolConfig struct {
+	Network            string   `toml:"network"`
+	Address            string   `toml:"address"`
+	Username           string   `toml:"username"`
+	Password           string   `toml:"password"`
+	ClientName         string   `toml:"client_name"`
+	Database           int      `toml:"database"`
+	ConnTimeout        Duration `toml:"conn_timeout"`
+	ReadTimeout        Duration `toml:"read_timeout"`
+	WriteTimeout       Duration `toml:"write_timeout"`
+	KeepAlive          Duration `toml:"keep_alive"`
+	TLS                bool     `toml:"tls"`
+	TLSSkipVerify      bool     `toml:"tls_skip_verify"`
+	SentinelMaster     string   `toml:"sentinel_master"`
+	SentinelAddrs      []string `toml:"sentinel_addrs"`
+	FailoverAddrs      []string `toml:"failover_addrs"`
+	Replicas           []string `toml:"replicas"`
+	LazyConnect        bool     `toml:"lazy_connect"`
+	KeyPrefix          string   `toml:"key_prefix"`
+	PoolSize           int      `toml:"pool_size"`
+	PoolLimit          int      `toml:"pool_limit"`
+	IdleTimeout        Duration `toml:"idle_timeout"`
+	IdleCheckInterval  Duration `toml:"idle_check_interval"`
+	MinIdle            int      `toml:"min_idle"`
+	WaitTimeout        Duration `toml:"wait_timeout"`
+	PrefillParallelism int      `toml:"prefill_parallelism"`
+	PrefillCount       int      `toml:"prefill_count"`
+	PrefillAsync       bool     `toml:"prefill_async"`
+}
+
+// options returns the redis options from config.
+func (c *RedisPoolConfig) options() []RedisOption {
+	options := []RedisOption{
+		WithRedisUsername(c.Username),
+		WithRedisPassword(c.Password),
+		WithRedisClientName(c.ClientName),
+		WithRedisDatabase(c.Database),
+		WithRedisConnTimeout(c.ConnTimeout.Duration()),
+		WithRedisReadTimeout(c.ReadTimeout.Duration()),
+		WithRedisWriteTimeout(c.WriteTimeout.Duration()),
+	}
+
+	if c.Network != "" {
+		options = append(options, WithRedisNetwork(c.Network))
+	}
+
+	if c.KeepAlive != 0 {
+		options = append(options, WithRedisKeepAlive(c.KeepAlive.Duration()))
+	}
+
+	if c.TLSSkipVerify {
+		options = append(options, WithRedisTLSSkipVerify())
+	} else if c.TLS {
+		options = append(options, WithRedisTLS(nil))
+	}
+
+	if c.SentinelMaster != "" {
+		options = append(options, WithRedisSentinel(c.SentinelMaster, c.SentinelAddrs))
+	}
+
+	if len(c.FailoverAddrs) != 0 {
+		options = append(options, WithRedisFailoverAddrs(c.FailoverAddrs))
+	}
+
+	if len(c.Replicas) != 0 {
+		options = append(options, WithRedisReplicas(c.Replicas...))
+	}
+
+	if c.LazyConnect {
+		options = append(options, WithRedisLazyConnect())
+	}
+
+	if c.KeyPrefix != "" {
+		options = append(options, WithRedisKeyPrefix(c.KeyPrefix))
+	}
+
+	poolOptions := []PoolOption{
+		WithPoolIdleTimeout(c.IdleTimeout.Duration()),
+		WithPoolWaitTimeout(c.WaitTimeout.Duration()),
+		WithPoolPrefill(c.PrefillParallelism),
+	}
+
+	if c.PoolSize != 0 {
+		poolOptions = append(poolOptions, WithPoolSize(c.PoolSize))
+	}
+
+	if c.PoolLimit != 0 {
+		poolOptions = append(poolOptions, WithPoolLimit(c.PoolLimit))
+	}
+
+	if c.IdleCheckInterval != 0 {
+		poolOptions = append(poolOptions, WithPoolIdleCheckInterval(c.IdleCheckInterval.Duration()), WithPoolMinIdle(c.MinIdle))
+	}
+
+	if c.PrefillCount != 0 {
+		poolOptions = append(poolOptions, WithPoolPrefillCount(c.PrefillCount))
+	}
+
+	if c.PrefillAsync {
+		poolOptions = append(poolOptions, WithPoolPrefillAsync())
+	}
+
+	return append(options, WithRedisPool(poolOptions...))
+}
+
+// redisSetting redis setting
+type redisSetting struct {
+	network         string
+	username        string
+	clientName      string
+	password        string
+	database        int
+	connTimeout     time.Duration
+	readTimeout     time.Duration
+	writeTimeout    time.Duration
+	keepAlive       time.Duration
+	useTLS          bool
+	tlsConfig       *tls.Config
+	tlsSkipVerify   bool
+	sentinel        *redisSentinel
+	dialFunc        func(ctx context.Context) (redis.Conn, error)
+	backend         RedisPool
+	txnRetries      int
+	healthCheck     time.Duration
+	testOnBorrow    time.Duration
+	dialRetry       *redisDialRetry
+	lazyConnect     bool
+	keyPrefix       string
+	maxConnLifetime time.Duration
+	slowLog         time.Duration
+	leakThreshold   time.Duration
+	hooks           []RedisHook
+	clientCache     int
+	failoverAddrs   []string
+	replicas        []string
+	pool            *poolSetting
+}
+
+// redisSentinel redis sentinel setting
+type redisSentinel struct {
+	masterName string
+	addrs      []string
+}
+
+// redisDialRetry redis dial retry setting
+type redisDialRetry struct {
+	attempts int
+	backoff  time.Duration
+}
+
+// redisDialMaxBackoff the max backoff between the dial retries
+var redisDialMaxBackoff = 10 * time.Second
+
+// RedisOption configures how we set up the redis pool
+type RedisOption interface {
+	apply(*redisSetting)
+}
+
+// funcRedisOption implements redis option
+type funcRedisOption struct {
+	f func(*redisSetting)
+}
+
+func (fo *funcRedisOption) apply(s *redisSetting) {
+	fo.f(s)
+}
+
+func newFuncRedisOption(f func(*redisSetting)) *funcRedisOption {
+	return &funcRedisOption{f: f}
+}
+
+// WithRedisNetwork specifies the network to dial, eg: tcp, unix.
+// An address like "unix:///var/run/redis/redis.sock" also implies the unix network.
+func WithRedisNetwork(network string) RedisOption {
+	return newFuncRedisOption(func(s *redisSetting) {
+		s.network = network
+	})
+}
+
+// WithRedisUsername specifies the username for redis 6 ACL AUTH.
+func WithRedisUsername(username string) RedisOption {
+	return newFuncRedisOption(func(s *redisSetting) {
+		s.username = username
+	})
+}
+
+// WithRedisClientName specifies the client name set by CLIENT SETNAME for every connection created by the pool.
+// The name of the registered pool is suffixed, eg: myapp.default
+func WithRedisClientName(name string) RedisOption {
+	return newFuncRedisOption(func(s *redisSetting) {
+		s.clientName = name
+	})
+}
+
+// WithRedisPassword specifies the password for redis AUTH.
+func WithRedisPassword(password string) RedisOption {
+	return newFuncRedisOption(func(s *redisSetting) {
+		s.password = password
+	})
+}
+
+// WithRedisDatabase specifies the database to be selected when dialing a connection.
+func WithRedisDatabase(db int) RedisOption {
+	return newFuncRedisOption(func(s *redisSetting) {
+		s.database = db
+	})
+}
+
+// WithRedisConnTimeout specifies the timeout for connecting to the redis server.
+func WithRedisConnTimeout(d time.Duration) RedisOption {
+	return newFuncRedisOption(func(s *redisSetting) {
+		s.connTimeout = d
+	})
+}
+
+// WithRedisReadTimeout specifies the timeout for reading a single command reply.
+func WithRedisReadTimeout(d time.Duration) RedisOption {
+	return newFuncRedisOption(func(s *redisSetting) {
+		s.readTimeout = d
+	})
+}
+
+// WithRedisWriteTimeout specifies the timeout for writing a single command.
+func WithRedisWriteTimeout(d time.Duration) RedisOption {
+	return newFuncRedisOption(func(s *redisSetting) {
+		s.writeTimeout = d
+	})
+}
+
+// WithRedisKeepAlive specifies the TCP keep-alive period, the redigo default (5min) is used when unset,
+// and a negative value disables keep-alive.
+// Note: the keep-alive detects the dropped idle connections (eg: by NAT) before they are borrowed,
+// while the read timeout only fires on a borrowed connection which waits for the reply.
+// So the period should be shorter than the idle timeout of NAT to avoid the read timeout on the first command.
+func WithRedisKeepAlive(d time.Duration) RedisOption {
+	return newFuncRedisOption(func(s *redisSetting) {
+		s.keepAlive = d
+	})
+}
+
+// WithRedisTLS specifies to connect to the redis server over TLS with the given config.
+// A nil config means the default TLS config is used.
+func WithRedisTLS(cfg *tls.Config) RedisOption {
+	return newFuncRedisOption(func(s *redisSetting) {
+		s.useTLS = true
+		s.tlsConfig = cfg
+	})
+}
+
+// WithRedisTLSSkipVerify specifies to connect to the redis server over TLS and disable the server name verification.
+func WithRedisTLSSkipVerify() RedisOption {
+	return newFuncRedisOption(func(s *redisSetting) {
+		s.useTLS = true
+		s.tlsSkipVerify = true
+	})
+}
+
+// WithRedisSentinel specifies to ask the sentinels for the current master address before dialing.
+// The address of the pool is ignored when sentinel is specified.
+func WithRedisSentinel(masterName string, sentinelAddrs []string) RedisOption {
+	return newFuncRedisOption(func(s *redisSetting) {
+		s.sentinel = &redisSentinel{
+			masterName: masterName,
+			addrs:      sentinelAddrs,
+		}
+	})
+}
+
+// WithRedisDialFunc specifies the function to create redis connections, eg: dial through a SSH tunnel or SOCKS proxy.
+// When specified, the address, network, TLS and sentinel settings are ignored and the ctx is bounded by the ctx of Get and the conn timeout.
+func WithRedisDialFunc(fn func(ctx context.Context) (redis.Conn, error)) RedisOption {
+	return newFuncRedisOption(func(s *redisSetting) {
+		s.dialFunc = fn
+	})
+}
+
+// WithRedisTxnRetries specifies the max retries of Txn when the watched keys are changed, default is 3.
+func WithRedisTxnRetries(n int) RedisOption {
+	return newFuncRedisOption(func(s *redisSetting) {
+		s.txnRetries = n
+	})
+}
+
+// WithRedisHealthCheck specifies the interval to PING the idle connections in background, the broken ones are replaced.
+func WithRedisHealthCheck(interval time.Duration) RedisOption {
+	return newFuncRedisOption(func(s *redisSetting) {
+		s.healthCheck = interval
+	})
+}
+
+// WithRedisTestOnBorrow specifies to PING the connections idle longer than the threshold before handing them out by Get.
+func WithRedisTestOnBorrow(idleThreshold time.Duration) RedisOption {
+	return newFuncRedisOption(func(s *redisSetting) {
+		s.testOnBorrow = idleThreshold
+	})
+}
+
+// WithRedisDialRetry specifies to retry dialing with exponential backoff plus jitter, attempts includes the first dial.
+// The backoff must be positive, it is doubled after each retry and capped at 10s.
+func WithRedisDialRetry(attempts int, backoff time.Duration) RedisOption {
+	return newFuncRedisOption(func(s *redisSetting) {
+		s.dialRetry = &redisDialRetry{
+			attempts: attempts,
+			backoff:  backoff,
+		}
+	})
+}
+
+// WithRedisLazyConnect specifies to skip the PING verification on register, the pool dials on the first Get.
+// Get returns ErrRedisUnavailable when redis is down, so that callers can degrade gracefully.
+func WithRedisLazyConnect() RedisOption {
+	return newFuncRedisOption(func(s *redisSetting) {
+		s.lazyConnect = true
+	})
+}
+
+// WithRedisKeyPrefix specifies the prefix prepended to the key arguments by the pool helpers (Do, Cache*, HSetStruct, HGetAllScan, RedisScript, RedisMutex, RedisLimiter).
+// Use RedisNoPrefix to opt out per call, eg: SCAN whose patterns are managed by the caller.
+func WithRedisKeyPrefix(prefix string) RedisOption {
+	return newFuncRedisOption(func(s *redisSetting) {
+		s.keyPrefix = prefix
+	})
+}
+
+// WithRedisMaxConnLifetime specifies the max lifetime of connections, the expired ones are closed and redialed by Get.
+func WithRedisMaxConnLifetime(d time.Duration) RedisOption {
+	return newFuncRedisOption(func(s *redisSetting) {
+		s.maxConnLifetime = d
+	})
+}
+
+// WithRedisSlowLog specifies to log the commands (Do, DoContext and Pipeline) slower than the threshold at Warn level.
+// Only the command name and the key (first argument) are logged, zero disables it.
+func WithRedisSlowLog(threshold time.Duration) RedisOption {
+	return newFuncRedisOption(func(s *redisSetting) {
+		s.slowLog = threshold
+	})
+}
+
+// WithRedisLeakDetection specifies to log a Warn with the stack of Get when a connection is not returned (Put) within the threshold.
+// The stack is recorded only when enabled, and the warning fires at most once per checkout.
+func WithRedisLeakDetection(threshold time.Duration) RedisOption {
+	return newFuncRedisOption(func(s *redisSetting) {
+		s.leakThreshold = threshold
+	})
+}
+
+// WithRedisHook specifies the hook invoked around Do, DoContext and Pipeline, multiple hooks run in order.
+func WithRedisHook(h RedisHook) RedisOption {
+	return newFuncRedisOption(func(s *redisSetting) {
+		s.hooks = append(s.hooks, h)
+	})
+}
+
+// WithRedisClientCache enables the server-assisted client-side caching (redis 6+) with a local LRU of maxEntries keys.
+// GETs sent by Do are served from the local cache, the entries are invalidated by the messages of CLIENT TRACKING,
+// which are redirected to a dedicated connection of the pool (CLIENT TRACKING ON REDIRECT) instead of HELLO 3,
+// since redigo speaks RESP2 only. The cache is flushed whenever the dedicated connection or a tracked connection is lost,
+// for the invalidation messages may be missed then.
+func WithRedisClientCache(maxEntries int) RedisOption {
+	return newFuncRedisOption(func(s *redisSetting) {
+		s.clientCache = maxEntries
+	})
+}
+
+// WithRedisFailoverAddrs specifies the addresses to try in order when failed to dial the address, eg: a warm standby.
+// The address that worked last is dialed first by the subsequent dials.
+func WithRedisFailoverAddrs(addrs []string) RedisOption {
+	return newFuncRedisOption(func(s *redisSetting) {
+		s.failoverAddrs = addrs
+	})
+}
+
+// WithRedisReplicas specifies the read replicas, a pool is created per replica and served by ReadOnly.
+func WithRedisReplicas(addrs ...string) RedisOption {
+	return newFuncRedisOption(func(s *redisSetting) {
+		s.replicas = addrs
+	})
+}
+
+// WithRedisPool specifies the pool options for redis.
+func WithRedisPool(options ...PoolOption) RedisOption {
+	return newFuncRedisOption(func(s *redisSetting) {
+		for _, option := range options {
+			option.apply(s.pool)
+		}
+	})
 }
 
 // RedisConn redis connection resource
 type RedisConn struct {
 	redis.Conn
+	createdAt time.Time
+	lastUsed  time.Time
+	hooks     []RedisHook
+	// tracking the generation of client cache which CLIENT TRACKING redirects to
+	tracking int64
+	// pool the pool which the connection is borrowed from, it must be returned there
+	pool *Pool
+	// lease the checkout tracked by the leak detection
+	lease *redisLease
+	// borrowed the checkout time, tracked for the pool hooks
+	borrowed time.Time
+}
+
+// newConn wraps the dialed connection as a pool resource.
+func (r *RedisPoolResource) newConn(conn redis.Conn) RedisConn {
+	if r.setting.slowLog > 0 {
+		conn = &redisSlowLogConn{
+			Conn:      conn,
+			name:      r.name,
+			threshold: r.setting.slowLog,
+		}
+	}
+
+	now := time.Now()
+
+	return RedisConn{
+		Conn:      conn,
+		createdAt: now,
+		lastUsed:  now,
+		hooks:     r.setting.hooks,
+	}
+}
+
+// Close close connection resorce
+func (r RedisConn) Close() {
+	r.Conn.Close()
+}
+
+// CloseE closes the connection as Close, and returns the error of closing.
+func (r RedisConn) CloseE() error {
+	return r.Conn.Close()
+}
+
+// redisResource adapts RedisConn to the io.Closer resource of Pool.
+type redisResource struct {
+	RedisConn
+}
+
+func (r redisResource) Close() error {
+	return r.CloseE()
+}
+
+// Do sends a command to the server and returns the received reply, the hooks are invoked with a background context.
+func (r RedisConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	if len(r.hooks) == 0 {
+		return r.Conn.Do(cmd, args...)
+	}
+
+	return r.DoContext(context.Background(), cmd, args...)
+}
+
+// DoContext sends a command to the server and returns the received reply, respecting the ctx cancellation and deadline.
+// When ctx is done before the command completes, the connection is closed to abort the in-flight command
+// (discarded by Put, so that a late reply never gets read by the next borrower) and ctx.Err() is returned.
+func (r RedisConn) DoContext(ctx context.Context, cmd string, args ...interface{}) (reply interface{}, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(r.hooks) != 0 {
+		ctx = redisHooks(r.hooks).before(ctx, cmd, args)
+
+		defer redisHooks(r.hooks).after(ctx, cmd, time.Now(), &err)
+	}
+
+	// close the connection to unblock the read when ctx is cancelled
+	var (
+		done    chan struct{}
+		aborted chan bool
+	)
+
+	if ctx.Done() != nil {
+		done = make(chan struct{})
+		aborted = make(chan bool, 1)
+
+		go func() {
+			select {
+			case <-ctx.Done():
+				r.Conn.Close()
+
+				aborted <- true
+			case <-done:
+				aborted <- false
+			}
+		}()
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		reply, err = redis.DoWithTimeout(r.Conn, time.Until(deadline), cmd, args...)
+	} else {
+		reply, err = r.Conn.Do(cmd, args...)
+	}
+
+	if done != nil {
+		close(done)
+
+		// the reply may be completed just before the abort, it's discarded since the connection is closed
+		if <-aborted {
+			return nil, ctx.Err()
+		}
+	}
+
+	if err != nil && ctx.Err() != nil {
+		// the connection is poisoned by an unfinished reply, abandon it
+		r.Conn.Close()
+
+		return nil, ctx.Err()
+	}
+
+	return reply, err
+}
+
+// DoWithTimeout sends a command with the read timeout overriding the connection default (WithRedisReadTimeout),
+// either longer for the slow or blocking commands, or shorter for the latency-critical ones. 0 means no timeout.
+// For the blocking commands (eg: BLPOP, XREAD BLOCK), the timeout must exceed the block time of the command,
+// otherwise the read times out before the server replies. A timed-out connection is broken and discarded by Put.
+func (r RedisConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (reply interface{}, err error) {
+	if len(r.hooks) != 0 {
+		ctx := redisHooks(r.hooks).before(context.Background(), cmd, args)
+
+		defer redisHooks(r.hooks).after(ctx, cmd, time.Now(), &err)
+	}
+
+	return redis.DoWithTimeout(r.Conn, timeout, cmd, args...)
+}
+
+// ErrRedisNil returned by the typed reply helpers when the reply is nil, eg: the key is missing.
+var ErrRedisNil = errors.New("yiigo: redis nil reply")
+
+func redisNilError(err error) error {
+	if err == redis.ErrNil {
+		return ErrRedisNil
+	}
+
+	return err
+}
+
+// GetString sends a command and converts the reply to string.
+func (r RedisConn) GetString(cmd string, args ...interface{}) (string, error) {
+	v, err := redis.String(r.Do(cmd, args...))
+
+	return v, redisNilError(err)
+}
+
+// GetInt64 sends a command and converts the reply to int64.
+func (r RedisConn) GetInt64(cmd string, args ...interface{}) (int64, error) {
+	v, err := redis.Int64(r.Do(cmd, args...))
+
+	return v, redisNilError(err)
+}
+
+// GetBool sends a command and converts the reply to bool.
+func (r RedisConn) GetBool(cmd string, args ...interface{}) (bool, error) {
+	v, err := redis.Bool(r.Do(cmd, args...))
+
+	return v, redisNilError(err)
+}
+
+// GetFloat64 sends a command and converts the reply to float64.
+func (r RedisConn) GetFloat64(cmd string, args ...interface{}) (float64, error) {
+	v, err := redis.Float64(r.Do(cmd, args...))
+
+	return v, redisNilError(err)
+}
+
+// GetStrings sends a command and converts the reply to []string.
+func (r RedisConn) GetStrings(cmd string, args ...interface{}) ([]string, error) {
+	v, err := redis.Strings(r.Do(cmd, args...))
+
+	return v, redisNilError(err)
+}
+
+// GetStringMap sends a command and converts the reply to map[string]string, eg: HGETALL.
+func (r RedisConn) GetStringMap(cmd string, args ...interface{}) (map[string]string, error) {
+	v, err := redis.StringMap(r.Do(cmd, args...))
+
+	return v, redisNilError(err)
+}
+
+// redisSlowLogConn logs the slow commands
+type redisSlowLogConn struct {
+	redis.Conn
+	name      string
+	threshold time.Duration
+}
+
+func (c *redisSlowLogConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	defer c.log(time.Now(), cmd, args)
+
+	return c.Conn.Do(cmd, args...)
+}
+
+func (c *redisSlowLogConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	defer c.log(time.Now(), cmd, args)
+
+	return redis.DoWithTimeout(c.Conn, timeout, cmd, args...)
+}
+
+func (c *redisSlowLogConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return redis.ReceiveWithTimeout(c.Conn, timeout)
+}
+
+func (c *redisSlowLogConn) log(start time.Time, cmd string, args []interface{}) {
+	d := time.Since(start)
+
+	if d <= c.threshold {
+		return
+	}
+
+	// never log the values
+	key := ""
+
+	if len(args) != 0 {
+		key = redisKey(args[0])
+	}
+
+	logger().Warn("yiigo: redis slow command", zap.String("name", c.name), zap.String("cmd", cmd), zap.String("key", key), zap.Duration("duration", d))
+}
+
+// redisRole returns the role of the redis instance: master, slave or sentinel.
+func redisRole(conn redis.Conn) (string, error) {
+	reply, err := redis.Values(conn.Do("ROLE"))
+
+	if err != nil {
+		return "", err
+	}
+
+	if len(reply) == 0 {
+		return "", errors.New("yiigo: empty redis role reply")
+	}
+
+	return redis.String(reply[0], nil)
+}
+
+// newRedisSetting returns a redis setting with defaults.
+func newRedisSetting(options ...RedisOption) *redisSetting {
+	setting := &redisSetting{
+		network:      "tcp",
+		connTimeout:  10 * time.Second,
+		readTimeout:  10 * time.Second,
+		writeTimeout: 10 * time.Second,
+		txnRetries:   3,
+		pool: &poolSetting{
+			size:        10,
+			limit:       20,
+			idleTimeout: 60 * time.Second,
+			waitTimeout: 10 * time.Second,
+		},
+	}
+
+	for _, option := range options {
+		option.apply(setting)
+	}
+
+	return setting
+}
+
+// RedisPoolResource redis pool resource
+type RedisPoolResource struct {
+	// int64 first for the 64-bit alignment of atomic operations
+	dialErrors  int64
+	reconnects  int64
+	expired     int64
+	exhaustedAt int64
+	downUntil   int64
+	closed      int32
+	addrIndex   int32
+	replicaNext uint32
+
+	name    string
+	address string
+	setting *redisSetting
+	// pool holds *Pool, swapped by init when the pool is closed
+	pool     atomic.Value
+	cache    *redisClientCache
+	replicas []*RedisPoolResource
+	flight   singleflight.Group
+	mutex    sync.Mutex
+}
+
+func newRedisPoolResource(name, address string, setting *redisSetting) *RedisPoolResource {
+	poolResource := &RedisPoolResource{
+		name:    name,
+		address: address,
+		setting: setting,
+	}
+
+	poolResource.init()
+
+	if setting.clientCache > 0 {
+		poolResource.cache = newRedisClientCache(setting.clientCache)
+
+		go poolResource.cache.run(poolResource)
+	}
+
+	if setting.healthCheck > 0 {
+		go poolResource.healthCheck()
+	}
+
+	for _, addr := range setting.replicas {
+		poolResource.replicas = append(poolResource.replicas, newRedisReplicaPool(name, addr, setting))
+	}
+
+	return poolResource
+}
+
+// dial creates a new connection, ctx bounds the dialing together with the conn timeout.
+func (r *RedisPoolResource) dial(ctx context.Context) (redis.Conn, error) {
+	if r.setting.backend != nil {
+		return r.dialBackend()
+	}
+
+	if r.setting.dialFunc != nil {
+		if r.setting.connTimeout != 0 {
+			c, cancel := context.WithTimeout(ctx, r.setting.connTimeout)
+
+			defer cancel()
+
+			ctx = c
+		}
+
+		return r.setting.dialFunc(ctx)
+	}
+
+	dialOptions := []redis.DialOption{
+		redis.DialUsername(r.setting.username),
+		redis.DialPassword(r.setting.password),
+		redis.DialDatabase(r.setting.database),
+		redis.DialClientName(r.setting.clientName),
+		redis.DialConnectTimeout(r.setting.connTimeout),
+		redis.DialReadTimeout(r.setting.readTimeout),
+		redis.DialWriteTimeout(r.setting.writeTimeout),
+	}
+
+	if r.setting.keepAlive != 0 {
+		dialOptions = append(dialOptions, redis.DialKeepAlive(r.setting.keepAlive))
+	}
+
+	if r.setting.useTLS {
+		tlsCfg := r.setting.tlsConfig
+
+		// redigo only honors skip verify without a tls config
+		if tlsCfg != nil && r.setting.tlsSkipVerify {
+			tlsCfg = tlsCfg.Clone()
+			tlsCfg.InsecureSkipVerify = true
+		}
+
+		dialOptions = append(dialOptions,
+			redis.DialUseTLS(true),
+			redis.DialTLSConfig(tlsCfg),
+			redis.DialTLSSkipVerify(r.setting.tlsSkipVerify),
+		)
+	}
+
+	if r.setting.sentinel == nil {
+		return r.dialFailover(ctx, dialOptions)
+	}
+
+	addr, err := r.sentinelMaster(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := redis.DialContext(ctx, "tcp", addr, dialOptions...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// make sure we don't write to a demoted replica after failover
+	{
+		role, err := redisRole(conn)
+
+		if err != nil {
+			conn.Close()
+
+			return nil, err
+		}
+
+		if role != "master" {
+			conn.Close()
+
+			return nil, fmt.Errorf("yiigo: redis %s is not master (role: %s)", addr, role)
+		}
+	}
+
+	return conn, nil
+}
+
+// dialRetry dials with retries, it returns ctx.Err() immediately when ctx is done during backoff.
+func (r *RedisPoolResource) dialRetry(ctx context.Context) (redis.Conn, error) {
+	conn, err := r.dial(ctx)
+
+	// the dial error is caused by ctx
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	if err == nil || r.setting.dialRetry == nil {
+		return conn, err
+	}
+
+	backoff := r.setting.dialRetry.backoff
+
+	for i := 1; i < r.setting.dialRetry.attempts; i++ {
+		logger().Warn("yiigo: redis dial retry", zap.String("name", r.name), zap.String("address", r.address), zap.Int("attempt", i+1), zap.Error(err))
+
+		// [backoff/2, backoff]
+		timer := time.NewTimer(backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1)))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		if conn, err = r.dial(ctx); err == nil {
+			return conn, nil
+		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		if backoff *= 2; backoff > redisDialMaxBackoff {
+			backoff = redisDialMaxBackoff
+		}
+	}
+
+	return nil, err
+}
+
+// dialFailover dials the address and then the failover addresses in order, starting from the last one that worked.
+func (r *RedisPoolResource) dialFailover(ctx context.Context, dialOptions []redis.DialOption) (redis.Conn, error) {
+	addrs := append([]string{r.address}, r.setting.failoverAddrs...)
+
+	start := int(atomic.LoadInt32(&r.addrIndex))
+
+	var err error
+
+	for i := 0; i < len(addrs); i++ {
+		index := (start + i) % len(addrs)
+
+		var conn redis.Conn
+
+		network, address := redisNetworkAddr(r.setting.network, addrs[index])
+
+		if conn, err = redis.DialContext(ctx, network, address, dialOptions...); err != nil {
+			continue
+		}
+
+		if index != start && atomic.CompareAndSwapInt32(&r.addrIndex, int32(start), int32(index)) {
+			logger().Warn("yiigo: redis failover", zap.String("name", r.name), zap.String("from", addrs[start]), zap.String("to", addrs[index]))
+		}
+
+		return conn, nil
+	}
+
+	return nil, err
+}
+
+// redisNetworkAddr returns the network and address to dial, the "unix://" address scheme takes precedence over the network.
+func redisNetworkAddr(network, address string) (string, string) {
+	if strings.HasPrefix(address, "unix://") {
+		return "unix", strings.TrimPrefix(address, "unix://")
+	}
+
+	return network, address
+}
+
+// sentinelMaster asks the sentinels for the current master address.
+func (r *RedisPoolResource) sentinelMaster(ctx context.Context) (string, error) {
+	var err error
+
+	for _, addr := range r.setting.sentinel.addrs {
+		var conn redis.Conn
+
+		conn, err = redis.DialContext(ctx, "tcp", addr,
+			redis.DialConnectTimeout(r.setting.connTimeout),
+			redis.DialReadTimeout(r.setting.readTimeout),
+			redis.DialWriteTimeout(r.setting.writeTimeout),
+		)
+
+		if err != nil {
+			continue
+		}
+
+		var master []string
+
+		master, err = redis.Strings(conn.Do("SENTINEL", "get-master-addr-by-name", r.setting.sentinel.masterName))
+
+		conn.Close()
+
+		if err != nil {
+			continue
+		}
+
+		if len(master) != 2 {
+			err = fmt.Errorf("yiigo: invalid master address from sentinel %s", addr)
+
+			continue
+		}
+
+		return net.JoinHostPort(master[0], master[1]), nil
+	}
+
+	if err == nil {
+		err = errors.New("yiigo: no redis sentinel available")
+	}
+
+	return "", errors.Wrapf(err, "yiigo: redis sentinel get master %s error", r.setting.sentinel.masterName)
+}
+
+// resourcePool returns the current pool without locking.
+func (r *RedisPoolResource) resourcePool() *Pool {
+	pool, _ := r.pool.Load().(*Pool)
+
+	return pool
+}
+
+// init creates the pool if it is missing or closed, and returns the current pool.
+// The new pool is fully constructed before published, so the readers never observe a half-initialized pool.
+func (r *RedisPoolResource) init() *Pool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if pool := r.resourcePool(); atomic.LoadInt32(&r.closed) == 1 || (pool != nil && !pool.IsClosed()) {
+		return pool
+	}
+
+	// dialed by Get with its ctx, bounded by the wait timeout
+	df := func(ctx context.Context) (io.Closer, error) {
+		conn, err := r.dialRetry(ctx)
+
+		if err != nil {
+			atomic.AddInt64(&r.dialErrors, 1)
+
+			return nil, err
+		}
+
+		return redisResource{r.newConn(conn)}, nil
+	}
+
+	pool := newPool(r.name, df, r.setting.pool, false)
+
+	r.pool.Store(pool)
+
+	return pool
+}
+
+// ping verifies the pool by a PING.
+func (r *RedisPoolResource) ping() error {
+	conn, err := r.Get()
+
+	if err != nil {
+		return redisAuthError(err)
+	}
+
+	_, err = conn.Do("PING")
+
+	r.Put(conn, err)
+
+	return redisAuthError(err)
+}
+
+// redisAuthError makes the AUTH errors obvious for misconfigured username or password.
+func redisAuthError(err error) error {
+	var e redis.Error
+
+	if !errors.As(err, &e) {
+		return err
+	}
+
+	switch {
+	case strings.HasPrefix(string(e), "WRONGPASS"):
+		return errors.Wrap(err, "yiigo: redis auth failed, wrong username or password")
+	case strings.HasPrefix(string(e), "NOAUTH"):
+		return errors.Wrap(err, "yiigo: redis auth required, password is not configured")
+	}
+
+	return err
+}
+
+// healthCheck PINGs the idle connections periodically until the pool is closed.
+func (r *RedisPoolResource) healthCheck() {
+	ticker := time.NewTicker(r.setting.healthCheck)
+
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if atomic.LoadInt32(&r.closed) == 1 {
+			return
+		}
+
+		pool := r.resourcePool()
+
+		if pool.IsClosed() {
+			continue
+		}
+
+		// every idle connection is borrowed at most once per round
+		for i := pool.Stats().Available; i > 0; i-- {
+			if !r.checkIdle(pool) {
+				break
+			}
+		}
+	}
+}
+
+// checkIdle borrows an idle connection without waiting and PINGs it, returns false when no connection is idle.
+func (r *RedisPoolResource) checkIdle(pool *Pool) bool {
+	// never wait, or the real callers would be starved
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+
+	defer cancel()
+
+	resource, err := pool.acquire(ctx)
+
+	if err != nil {
+		return false
+	}
+
+	rc := resource.(redisResource).RedisConn
+
+	if _, err := rc.Conn.Do("PING"); err != nil {
+		rc.Close()
+
+		// a new connection is created in its place
+		pool.release(nil)
+
+		return true
+	}
+
+	pool.release(redisResource{rc})
+
+	return true
+}
+
+// Get get a connection resource from the pool.
+// The wait timeout of the pool also bounds the dial retries when filling an empty slot or reconnecting a broken connection.
+// The hooks of WithPoolHooks are called with the registered name, the waiting includes the reconnecting.
+func (r *RedisPoolResource) Get() (RedisConn, error) {
+	return r.GetContext(context.Background())
+}
+
+// GetContext is Get with ctx, the waiting and dialing stop when either ctx is done or the wait timeout expires.
+func (r *RedisPoolResource) GetContext(ctx context.Context) (RedisConn, error) {
+	if len(r.setting.pool.hooks) == 0 {
+		return r.borrow(ctx)
+	}
+
+	start := time.Now()
+
+	rc, err := r.borrow(ctx)
+
+	if err == nil {
+		rc.borrowed = time.Now()
+	}
+
+	r.resourcePool().onGet(r.name, time.Since(start), err)
+
+	return rc, err
+}
+
+// borrow is GetContext without the hooks.
+func (r *RedisPoolResource) borrow(ctx context.Context) (RedisConn, error) {
+	if atomic.LoadInt32(&r.closed) == 1 {
+		return RedisConn{}, ErrRedisClosed
+	}
+
+	if err := ctx.Err(); err != nil {
+		return RedisConn{}, err
+	}
+
+	parent := ctx
+
+	if r.setting.pool.waitTimeout != 0 {
+		c, cancel := context.WithTimeout(ctx, r.setting.pool.waitTimeout)
+
+		defer cancel()
+
+		ctx = c
+	}
+
+	pool, resource, err := r.get(ctx)
+
+	if err != nil {
+		// cancelled by the caller, neither exhausted nor unavailable
+		if parent.Err() != nil {
+			return RedisConn{}, parent.Err()
+		}
+
+		if e, ok := err.(*PoolExhaustedError); ok {
+			return RedisConn{}, r.exhausted(e)
+		}
+
+		if err == ErrPoolClosed || err == ErrRedisClosed {
+			return RedisConn{}, ErrRedisClosed
+		}
+
+		// the wait timeout expires during the dial retries
+		if err == ctx.Err() {
+			return RedisConn{}, err
+		}
+
+		r.markDown()
+
+		// failed to dial by the pool factory
+		return RedisConn{}, &redisUnavailableError{err: err}
+	}
+
+	rc := resource.(redisResource).RedisConn
+	rc.pool = pool
+
+	lifetime := r.maxConnLifetime()
+	expired := lifetime > 0 && time.Since(rc.createdAt) > lifetime
+
+	// if rc is error or expired, close and reconnect
+	if expired || rc.Err() != nil || !r.testOnBorrow(rc) {
+		if expired {
+			atomic.AddInt64(&r.expired, 1)
+		} else {
+			atomic.AddInt64(&r.reconnects, 1)
+		}
+
+		conn, err := r.dialRetry(ctx)
+
+		if err != nil {
+			atomic.AddInt64(&r.dialErrors, 1)
+
+			// never returns the broken or expired rc, its slot is left empty for the next Get
+			rc.Close()
+
+			pool.release(nil)
+
+			if err == ctx.Err() {
+				return RedisConn{}, err
+			}
+
+			r.markDown()
+
+			return RedisConn{}, &redisUnavailableError{err: err}
+		}
+
+		rc.Close()
+
+		rc = r.newConn(conn)
+		rc.pool = pool
+	}
+
+	if r.cache != nil {
+		r.cache.track(&rc)
+	}
+
+	if r.setting.leakThreshold > 0 {
+		rc.lease = r.newLease()
+	}
+
+	return rc, nil
+}
+
+// maxConnLifetime returns the shorter one of WithRedisMaxConnLifetime and WithPoolMaxLifetime, 0 means no limit.
+func (r *RedisPoolResource) maxConnLifetime() time.Duration {
+	lifetime := r.setting.maxConnLifetime
+
+	if d := r.setting.pool.maxLifetime; d > 0 && (lifetime <= 0 || d < lifetime) {
+		lifetime = d
+	}
+
+	return lifetime
+}
+
+// get borrows a resource from the current pool, the pool is recreated when it is closed (not by Close).
+// The fast path of a healthy pool takes no lock.
+func (r *RedisPoolResource) get(ctx context.Context) (*Pool, io.Closer, error) {
+	pool := r.resourcePool()
+
+	for {
+		if pool.IsClosed() {
+			if pool = r.init(); atomic.LoadInt32(&r.closed) == 1 {
+				return pool, nil, ErrRedisClosed
+			}
+		}
+
+		resource, err := pool.acquire(ctx)
+
+		// closed while waiting, retry with the new pool
+		if err == ErrPoolClosed && atomic.LoadInt32(&r.closed) == 0 {
+			continue
+		}
+
+		return pool, resource, err
+	}
+}
+
+// redisExhaustedWarnInterval the minimum interval between the pool exhausted warnings of a pool
+var redisExhaustedWarnInterval = 10 * time.Second
+
+// exhausted logs a rate-limited warning with the diagnostics of pool exhaustion.
+func (r *RedisPoolResource) exhausted(e *PoolExhaustedError) error {
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&r.exhaustedAt)
+
+	if now-last >= int64(redisExhaustedWarnInterval) && atomic.CompareAndSwapInt64(&r.exhaustedAt, last, now) {
+		logger().Warn("yiigo: redis pool exhausted",
+			zap.String("name", e.Name),
+			zap.Int("size", e.Size),
+			zap.Int("limit", e.Limit),
+			zap.Int64("in_use", e.InUse),
+			zap.Int64("waiters", e.Waiters),
+			zap.Duration("waited", e.Waited),
+		)
+	}
+
+	return e
+}
+
+type redisNoPrefixKey struct{}
+
+// RedisNoPrefix returns a context which disables the key prefix of the pool helpers.
+func RedisNoPrefix(ctx context.Context) context.Context {
+	return context.WithValue(ctx, redisNoPrefixKey{}, true)
+}
+
+// Prefix returns the key prefix of the pool.
+func (r *RedisPoolResource) Prefix() string {
+	return r.setting.keyPrefix
+}
+
+// prefixKeys prepends the key prefix to the first n args, unless disabled by RedisNoPrefix.
+func (r *RedisPoolResource) prefixKeys(ctx context.Context, n int, args []interface{}) []interface{} {
+	return redisPrefixKeys(ctx, r, n, args)
+}
+
+// Do borrows a connection, sends the command and returns the connection to the pool.
+// The connection is discarded when the command failed with a network error.
+// The first argument is treated as the key and prefixed by WithRedisKeyPrefix.
+func (r *RedisPoolResource) Do(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
+	return r.do(ctx, cmd, r.prefixKeys(ctx, 1, args)...)
+}
+
+func (r *RedisPoolResource) do(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
+	if r.cache != nil && len(args) == 1 && strings.EqualFold(cmd, "GET") {
+		return r.cachedGet(ctx, redisKey(args[0]))
+	}
+
+	conn, err := r.GetContext(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := conn.DoContext(ctx, cmd, args...)
+
+	r.Put(conn, err)
+
+	return reply, err
+}
+
+// RedisDo sends the command with the default redis pool.
+func RedisDo(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
+	return Redis().Do(ctx, cmd, args...)
+}
+
+// testOnBorrow PINGs the connection idle longer than the threshold, returns false when the PING fails.
+func (r *RedisPoolResource) testOnBorrow(rc RedisConn) bool {
+	if r.setting.testOnBorrow <= 0 || time.Since(rc.lastUsed) < r.setting.testOnBorrow {
+		return true
+	}
+
+	_, err := rc.Conn.Do("PING")
+
+	return err == nil
+}
+
+// Put returns a connection resource to the pool, the error of the last command can be passed optionally.
+// The broken connection is closed and its slot is left empty, a new one is dialed by the next Get.
+func (r *RedisPoolResource) Put(rc RedisConn, err ...error) {
+	pool := rc.pool
+
+	if pool == nil {
+		pool = r.resourcePool()
+	}
+
+	// the pool is not referenced by the idle connection
+	rc.pool = nil
+
+	if rc.lease != nil {
+		rc.lease.release()
+		rc.lease = nil
+	}
+
+	broken := rc.Err() != nil || (len(err) != 0 && isRedisConnError(err[0]))
+
+	if len(r.setting.pool.hooks) != 0 {
+		pool.onPut(r.name, time.Since(rc.borrowed), broken)
+
+		rc.borrowed = time.Time{}
+	}
+
+	if broken {
+		rc.Close()
+
+		pool.release(nil)
+
+		return
+	}
+
+	rc.lastUsed = time.Now()
+
+	pool.release(redisResource{rc})
 }
 
-// Close close connection resorce
-func (r RedisConn) Close() {
-	r.Conn.Close()
+// isRedisConnError reports whether the error breaks the connection, eg: I/O error, not a redis error reply.
+func isRedisConnError(err error) bool {
+	if err == nil || err == redis.ErrNil {
+		return false
+	}
+
+	_, ok := err.(redis.Error)
+
+	return !ok
 }
 
-// RedisPoolResource redis pool resource
-type RedisPoolResource struct {
-	config *redisConfig
-	pool   *vitess_pool.ResourcePool
-	mutex  sync.Mutex
+// ErrRedisUnavailable returned by Get when failed to dial redis, use errors.Is to check it.
+var ErrRedisUnavailable = errors.New("yiigo: redis unavailable")
+
+// redisUnavailableError wraps the dial error as ErrRedisUnavailable
+type redisUnavailableError struct {
+	err error
 }
 
-func (r *RedisPoolResource) dial() (redis.Conn, error) {
-	dialOptions := []redis.DialOption{
-		redis.DialPassword(r.config.Password),
-		redis.DialDatabase(r.config.Database),
-		redis.DialConnectTimeout(time.Duration(r.config.ConnTimeout) * time.Second),
-		redis.DialReadTimeout(time.Duration(r.config.ReadTimeout) * time.Second),
-		redis.DialWriteTimeout(time.Duration(r.config.WriteTimeout) * time.Second),
-	}
+func (e *redisUnavailableError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrRedisUnavailable.Error(), e.err.Error())
+}
+
+func (e *redisUnavailableError) Is(target error) bool {
+	return target == ErrRedisUnavailable
+}
+
+func (e *redisUnavailableError) Unwrap() error {
+	return e.err
+}
+
+// ErrRedisClosed returned by Get when the pool is closed.
+var ErrRedisClosed = errors.New("yiigo: redis pool is closed")
+
+// redisCloseTimeout the max time Close waits for the connections in use to be returned
+var redisCloseTimeout = 10 * time.Second
 
-	conn, err := redis.Dial("tcp", r.config.Address, dialOptions...)
+// Close closes the pool, it waits at most 10s for the connections in use to be returned (Put).
+// The connections not returned in time are abandoned with a warning, they are closed when returned later.
+// The pool can't be used any more after closed.
+func (r *RedisPoolResource) Close() {
+	ctx, cancel := context.WithTimeout(context.Background(), redisCloseTimeout)
 
-	return conn, err
+	defer cancel()
+
+	if err := r.CloseContext(ctx); err != nil {
+		logger().Warn("yiigo: redis close error", zap.String("name", r.name), zap.String("address", r.address), zap.Error(err))
+	}
 }
 
-func (r *RedisPoolResource) init() {
+// CloseContext closes the pool as Close, ctx bounds the waiting for the connections in use to be returned.
+// When ctx is done first, an error with the number of the abandoned connections is returned.
+func (r *RedisPoolResource) CloseContext(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&r.closed, 0, 1) {
+		return nil
+	}
+
+	if r.cache != nil {
+		r.cache.close()
+	}
+
+	for _, replica := range r.replicas {
+		if err := replica.CloseContext(ctx); err != nil {
+			logger().Warn("yiigo: redis close error", zap.String("name", replica.name), zap.String("address", replica.address), zap.Error(err))
+		}
+	}
+
+	// no more pool is created by init since closed
 	r.mutex.Lock()
-	defer r.mutex.Unlock()
+	pool := r.resourcePool()
+	r.mutex.Unlock()
 
-	if r.pool != nil && !r.pool.IsClosed() {
-		return
+	return pool.Close(ctx)
+}
+
+// ErrRedisTxnConflict returned by Txn when the watched keys are still changed after all retries.
+var ErrRedisTxnConflict = errors.New("yiigo: redis transaction aborted, watched keys changed")
+
+// Txn runs fn between MULTI and EXEC after watching the keys, and returns the EXEC replies.
+// The commands queued by fn are discarded on error or panic, and the transaction is retried when the watched keys are changed.
+// The watched keys are prefixed by WithRedisKeyPrefix, the retries stop when ctx is done.
+func (r *RedisPoolResource) Txn(ctx context.Context, watchKeys []string, fn func(conn *RedisConn) error) (interface{}, error) {
+	conn, err := r.GetContext(ctx)
+
+	if err != nil {
+		return nil, err
 	}
 
-	df := func() (vitess_pool.Resource, error) {
-		conn, err := r.dial()
+	defer r.Put(conn)
+
+	for i := 0; i <= r.setting.txnRetries; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		reply, err := r.txn(ctx, &conn, watchKeys, fn)
 
 		if err != nil {
 			return nil, err
 		}
 
-		return RedisConn{conn}, nil
+		// nil reply means the watched keys are changed
+		if reply != nil {
+			return reply, nil
+		}
 	}
 
-	r.pool = vitess_pool.NewResourcePool(df, r.config.PoolSize, r.config.PoolLimit, time.Duration(r.config.IdleTimeout)*time.Second, r.config.PrefillParallelism)
+	return nil, ErrRedisTxnConflict
 }
 
-// Get get a connection resource from the pool.
-func (r *RedisPoolResource) Get() (RedisConn, error) {
-	if r.pool.IsClosed() {
-		r.init()
+func (r *RedisPoolResource) txn(ctx context.Context, conn *RedisConn, watchKeys []string, fn func(conn *RedisConn) error) (reply interface{}, err error) {
+	if len(watchKeys) != 0 {
+		args := make([]interface{}, 0, len(watchKeys))
+
+		for _, k := range watchKeys {
+			args = append(args, k)
+		}
+
+		if _, err = conn.DoContext(ctx, "WATCH", r.prefixKeys(ctx, len(args), args)...); err != nil {
+			return nil, err
+		}
 	}
 
-	ctx := context.TODO()
+	if _, err = conn.DoContext(ctx, "MULTI"); err != nil {
+		conn.Do("UNWATCH")
 
-	if r.config.WaitTimeout != 0 {
-		c, cancel := context.WithTimeout(ctx, time.Duration(r.config.WaitTimeout)*time.Second)
+		return nil, err
+	}
 
-		defer cancel()
+	committed := false
 
-		ctx = c
+	defer func() {
+		if !committed {
+			// DISCARD also unwatches the keys
+			conn.Do("DISCARD")
+		}
+	}()
+
+	if err = fn(conn); err != nil {
+		return nil, err
+	}
+
+	committed = true
+
+	return conn.DoContext(ctx, "EXEC")
+}
+
+// RedisPoolStats redis pool statistics
+type RedisPoolStats struct {
+	Capacity   int64
+	Available  int64
+	Active     int64
+	InUse      int64
+	Waiters    int64
+	WaitCount  int64
+	WaitTime   time.Duration
+	DialErrors int64
+	Reconnects int64
+	Expired    int64
+	Prefilled  int64
+	IdleClosed int64
+}
+
+// SetCapacity resizes the pool at runtime, the size is clamped to the pool limit.
+// Shrinking closes the idle connections and waits for the checked out ones to be returned without interrupting them.
+// Note: ctx only bounds the waiting of the caller, the resize is not cancelled when ctx.Err() is returned,
+// it keeps going in background and the new capacity takes effect after the checked out connections are returned.
+func (r *RedisPoolResource) SetCapacity(ctx context.Context, size int) error {
+	if size <= 0 {
+		return fmt.Errorf("yiigo: invalid redis pool capacity %d", size)
 	}
 
-	resource, err := r.pool.Get(ctx)
+	if atomic.LoadInt32(&r.closed) == 1 {
+		return ErrRedisClosed
+	}
+
+	if size > r.setting.pool.limit {
+		size = r.setting.pool.limit
+	}
+
+	pool := r.resourcePool()
+
+	errc := make(chan error, 1)
+
+	go func() {
+		errc <- pool.SetCapacity(size)
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats returns the pool statistics.
+func (r *RedisPoolResource) Stats() RedisPoolStats {
+	stats := r.resourcePool().Stats()
+
+	return RedisPoolStats{
+		Capacity:   stats.Capacity,
+		Available:  stats.Available,
+		Active:     stats.Active,
+		InUse:      stats.InUse,
+		Waiters:    stats.Waiters,
+		WaitCount:  stats.WaitCount,
+		WaitTime:   stats.WaitTime,
+		DialErrors: atomic.LoadInt64(&r.dialErrors),
+		Reconnects: atomic.LoadInt64(&r.reconnects),
+		Expired:    atomic.LoadInt64(&r.expired),
+		Prefilled:  stats.Prefilled,
+		IdleClosed: stats.IdleClosed,
+	}
+}
+
+// RedisPipeline queues commands to be sent to the server in one round trip.
+type RedisPipeline struct {
+	conn  RedisConn
+	count int
+}
+
+// Send queues a command, the reply is returned by Pipeline in order.
+func (p *RedisPipeline) Send(cmd string, args ...interface{}) error {
+	if err := p.conn.Send(cmd, args...); err != nil {
+		return err
+	}
+
+	p.count++
+
+	return nil
+}
+
+// Pipeline checks out a connection, queues the commands by fn, flushes them at once and returns the replies in order.
+// The error of a single command is placed in its reply slot, the returned error is only for the connection failures.
+func (r *RedisPoolResource) Pipeline(ctx context.Context, fn func(p *RedisPipeline) error) (replies []interface{}, err error) {
+	conn, err := r.GetContext(ctx)
 
 	if err != nil {
-		return RedisConn{}, err
+		return nil, err
 	}
 
-	rc := resource.(RedisConn)
+	done := false
 
-	// if rc is error, close and reconnect
-	if rc.Err() != nil {
-		conn, err := r.dial()
+	defer func() {
+		// the connection may have unflushed commands or unread replies, abandon it
+		if !done {
+			conn.Close()
+		}
 
-		if err != nil {
-			r.pool.Put(rc)
+		r.Put(conn)
+	}()
+
+	p := &RedisPipeline{conn: conn}
+
+	if err := fn(p); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+
+	if len(r.setting.hooks) != 0 {
+		ctx = redisHooks(r.setting.hooks).before(ctx, "PIPELINE", nil)
+
+		defer redisHooks(r.setting.hooks).after(ctx, "PIPELINE", start, &err)
+	}
+
+	if err := conn.Flush(); err != nil {
+		return nil, err
+	}
+
+	deadline, hasDeadline := ctx.Deadline()
+
+	replies = make([]interface{}, 0, p.count)
+
+	var connErr error
 
-			return rc, err
+	for i := 0; i < p.count; i++ {
+		var (
+			reply interface{}
+			err   error
+		)
+
+		if hasDeadline {
+			reply, err = redis.ReceiveWithTimeout(conn.Conn, time.Until(deadline))
+		} else {
+			reply, err = conn.Receive()
 		}
 
-		rc.Close()
+		if err != nil {
+			if _, ok := err.(redis.Error); !ok && connErr == nil {
+				connErr = err
+
+				if ctx.Err() != nil {
+					connErr = ctx.Err()
+				}
+			}
 
-		return RedisConn{conn}, nil
+			reply = err
+		}
+
+		replies = append(replies, reply)
 	}
 
-	return rc, nil
-}
+	done = connErr == nil
 
-// Put returns a connection resource to the pool.
-func (r *RedisPoolResource) Put(rc RedisConn) {
-	r.pool.Put(rc)
+	if d := time.Since(start); r.setting.slowLog > 0 && d > r.setting.slowLog {
+		logger().Warn("yiigo: redis slow pipeline", zap.String("name", r.name), zap.Int("commands", p.count), zap.Duration("duration", d))
+	}
+
+	return replies, connErr
 }
 
+// the default pool is kept in redisMap too, so that ReloadRedis swaps it atomically
 var (
-	defaultRedis *RedisPoolResource
-	redisMap     sync.Map
+	redisMap    sync.Map
+	redisClosed sync.Map
+	// redisMutex serializes the mutations of registry (register, reload, close and deregister)
+	redisMutex sync.Mutex
 )
 
-func initRedis() {
-	tree, ok := env.get("redis").(*toml.Tree)
+// InitRedisE registers the redis pools configured in yiigo.toml, the first error is returned instead of panic,
+// eg: to retry when the redis is not up yet.
+func InitRedisE() error {
+	cfgs, err := envRedisConfigs()
 
-	if !ok {
-		return
+	if err != nil {
+		return err
 	}
 
-	keys := tree.Keys()
+	return initRedisConfigs(cfgs)
+}
 
-	if len(keys) == 0 {
-		return
-	}
+// envRedisConfigs returns the redis configs of yiigo.toml.
+func envRedisConfigs() (map[string]RedisPoolConfig, error) {
+	cfgs := make(map[string]RedisPoolConfig)
 
-	for _, v := range keys {
-		node, ok := tree.Get(v).(*toml.Tree)
+	err := envSection("redis", func(name string, node *toml.Tree) error {
+		cfg := RedisPoolConfig{}
 
-		if !ok {
-			continue
+		if err := unmarshalConfigNode(node, &cfg); err != nil {
+			return &initError{module: "redis", name: name, err: err}
 		}
 
-		cfg := new(redisConfig)
+		cfgs[name] = cfg
+
+		return nil
+	})
+
+	return cfgs, err
+}
+
+// initRedisConfigs registers the redis pools of cfgs, the pools are verified by PING unless lazy connect.
+func initRedisConfigs(cfgs map[string]RedisPoolConfig) error {
+	names := make([]string, 0, len(cfgs))
+
+	for k := range cfgs {
+		names = append(names, k)
+	}
+
+	sort.Strings(names)
+
+	for _, v := range names {
+		cfg := cfgs[v]
+
+		address, options := cfg.Address, cfg.options()
+
+		// the options of URL take precedence
+		if isRedisURL(address) {
+			addr, urlOptions, err := ParseRedisURL(address)
 
-		if err := node.Unmarshal(cfg); err != nil {
-			logger.Panic("yiigo: redis init error", zap.String("name", v), zap.Error(err))
+			if err != nil {
+				return &initError{module: "redis", name: v, err: err}
+			}
+
+			address, options = addr, append(options, urlOptions...)
+		}
+
+		if err := registerRedis(v, address, options...); err != nil {
+			return &initError{module: "redis", name: v, err: err}
 		}
+	}
+
+	return nil
+}
+
+// RegisterRedis registers a redis pool with the given name and address.
+// It panics when failed to verify the pool, unless an error handler is specified by SetErrorHandler.
+func RegisterRedis(name, address string, options ...RedisOption) {
+	if err := registerRedis(name, address, options...); err != nil && !handleError("redis", name, err) {
+		logger().Panic("yiigo: redis init error", zap.String("name", name), zap.Error(err))
+	}
+}
+
+func registerRedis(name, address string, options ...RedisOption) error {
+	setting := newNamedRedisSetting(name, options...)
+
+	if err := setting.validate(); err != nil {
+		return err
+	}
 
-		poolResource := &RedisPoolResource{config: cfg}
+	poolResource := newRedisPoolResource(name, address, setting)
 
-		poolResource.init()
+	if !poolResource.setting.lazyConnect {
+		if err := poolResource.ping(); err != nil {
+			poolResource.Close()
 
-		if v == AsDefault {
-			defaultRedis = poolResource
+			return err
 		}
+	}
+
+	storeRedis(name, poolResource)
+
+	return nil
+}
+
+// newNamedRedisSetting returns the setting of the named pool, the client name is suffixed by the pool name.
+func newNamedRedisSetting(name string, options ...RedisOption) *redisSetting {
+	setting := newRedisSetting(options...)
+
+	if setting.clientName != "" {
+		setting.clientName = fmt.Sprintf("%s.%s", setting.clientName, name)
+	}
+
+	return setting
+}
+
+// validate reports the invalid options of the setting.
+func (s *redisSetting) validate() error {
+	if s.dialRetry != nil && s.dialRetry.backoff <= 0 {
+		return fmt.Errorf("yiigo: invalid redis dial retry backoff %s", s.dialRetry.backoff)
+	}
+
+	return nil
+}
+
+// ReloadRedis replaces the registered redis pool with a new one, eg: the password is rotated or the host is migrated.
+// The new pool is verified by PING before swapped in, the old pool keeps serving the outstanding connections
+// and is closed after all of them are returned (at most 1 minute). The old pool is kept when an error is returned.
+// It fails when the pool is closed, deregistered or replaced during the verification, and the new pool is closed then.
+func ReloadRedis(name, address string, options ...RedisOption) error {
+	v, ok := redisMap.Load(name)
+
+	if !ok {
+		return redisUnknownError(name)
+	}
+
+	setting := newNamedRedisSetting(name, options...)
+
+	if err := setting.validate(); err != nil {
+		return errors.Wrapf(err, "yiigo: redis.%s reload error", name)
+	}
 
-		redisMap.Store(v, poolResource)
+	poolResource := newRedisPoolResource(name, address, setting)
 
-		logger.Info(fmt.Sprintf("yiigo: redis.%s is OK.", v))
+	if err := poolResource.ping(); err != nil {
+		poolResource.Close()
+
+		return errors.Wrapf(err, "yiigo: redis.%s reload error", name)
+	}
+
+	redisMutex.Lock()
+
+	// closed, deregistered or replaced during the verification
+	if current, ok := redisMap.Load(name); !ok || current != v {
+		redisMutex.Unlock()
+
+		poolResource.Close()
+
+		return fmt.Errorf("yiigo: redis.%s is changed during reload", name)
+	}
+
+	redisMap.Store(name, poolResource)
+
+	redisMutex.Unlock()
+
+	go v.(*RedisPoolResource).drain()
+
+	logger().Info(fmt.Sprintf("yiigo: redis.%s is reloaded.", name))
+
+	return nil
+}
+
+// redisDrainInterval the interval of checking whether the replaced pool is drained
+var redisDrainInterval = 100 * time.Millisecond
+
+// redisDrainTimeout the max time drain waits for the replaced pool to serve the outstanding connections and waiters
+var redisDrainTimeout = time.Minute
+
+// drain closes the pool after all the connections in use are returned, or the drain timeout expires.
+func (r *RedisPoolResource) drain() {
+	deadline := time.Now().Add(redisDrainTimeout)
+
+	for stats := r.resourcePool().Stats(); (stats.InUse > 0 || stats.Waiters > 0) && time.Now().Before(deadline); stats = r.resourcePool().Stats() {
+		time.Sleep(redisDrainInterval)
 	}
+
+	r.Close()
 }
 
 // Redis returns a redis pool.
+// It panics when the pool is not registered, unless an error handler is specified by SetErrorHandler (nil is returned then).
 func Redis(name ...string) *RedisPoolResource {
 	if len(name) == 0 {
-		if defaultRedis == nil {
-			logger.Panic(fmt.Sprintf("yiigo: unknown redis.%s (forgotten configure?)", AsDefault))
-		}
-
-		return defaultRedis
+		name = []string{AsDefault}
 	}
 
 	v, ok := redisMap.Load(name[0])
 
 	if !ok {
-		logger.Panic(fmt.Sprintf("yiigo: unknown redis.%s (forgotten configure?)", name[0]))
+		redisUnknown(name[0])
+
+		return nil
 	}
 
 	return v.(*RedisPoolResource)
 }
+
+func redisUnknown(name string) {
+	if err := redisUnknownError(name); !handleError("redis", name, err) {
+		logger().Panic(err.Error())
+	}
+}
+
+func redisUnknownError(name string) error {
+	if _, ok := redisClosed.Load(name); ok {
+		return fmt.Errorf("yiigo: redis.%s is closed", name)
+	}
+
+	return fmt.Errorf("yiigo: unknown redis.%s (forgotten configure?)", name)
+}
+
+// RedisPoolE returns a redis pool, an error is returned instead of panic when the pool is not registered.
+// The pool is a *RedisPoolResource, use Redis for the helpers (Cache, Lock, Txn, etc.).
+func RedisPoolE(name ...string) (RedisPool, error) {
+	if len(name) == 0 {
+		name = []string{AsDefault}
+	}
+
+	v, ok := redisMap.Load(name[0])
+
+	if !ok {
+		return nil, redisUnknownError(name[0])
+	}
+
+	return v.(*RedisPoolResource), nil
+}
+
+// RedisNames returns the names of the registered redis pools in order.
+func RedisNames() []string {
+	names := make([]string, 0)
+
+	redisMap.Range(func(key, value interface{}) bool {
+		names = append(names, key.(string))
+
+		return true
+	})
+
+	sort.Strings(names)
+
+	return names
+}
+
+// redisMaskedPassword replaces the password in RedisSettingInfo
+const redisMaskedPassword = "******"
+
+// RedisSettingInfo the sanitized setting of a redis pool, safe to be exposed by the admin endpoints.
+type RedisSettingInfo struct {
+	Name           string        `json:"name"`
+	Network        string        `json:"network"`
+	Address        string        `json:"address"`
+	Username       string        `json:"username,omitempty"`
+	Password       string        `json:"password,omitempty"` // masked
+	ClientName     string        `json:"client_name,omitempty"`
+	Database       int           `json:"database"`
+	SentinelMaster string        `json:"sentinel_master,omitempty"`
+	Replicas       []string      `json:"replicas,omitempty"`
+	KeyPrefix      string        `json:"key_prefix,omitempty"`
+	TLS            bool          `json:"tls"`
+	ConnTimeout    time.Duration `json:"conn_timeout"`
+	ReadTimeout    time.Duration `json:"read_timeout"`
+	WriteTimeout   time.Duration `json:"write_timeout"`
+	PoolSize       int           `json:"pool_size"`
+	PoolLimit      int           `json:"pool_limit"`
+	IdleTimeout    time.Duration `json:"idle_timeout"`
+	WaitTimeout    time.Duration `json:"wait_timeout"`
+}
+
+// RedisConfig returns the sanitized setting of the registered redis pool, the password is masked.
+func RedisConfig(name string) (RedisSettingInfo, bool) {
+	v, ok := redisMap.Load(name)
+
+	if !ok {
+		return RedisSettingInfo{}, false
+	}
+
+	r := v.(*RedisPoolResource)
+	s := r.setting
+
+	info := RedisSettingInfo{
+		Name:         name,
+		Network:      s.network,
+		Address:      r.address,
+		Username:     s.username,
+		ClientName:   s.clientName,
+		Database:     s.database,
+		Replicas:     append([]string{}, s.replicas...),
+		KeyPrefix:    s.keyPrefix,
+		TLS:          s.useTLS,
+		ConnTimeout:  s.connTimeout,
+		ReadTimeout:  s.readTimeout,
+		WriteTimeout: s.writeTimeout,
+		PoolSize:     s.pool.size,
+		PoolLimit:    s.pool.limit,
+		IdleTimeout:  s.pool.idleTimeout,
+		WaitTimeout:  s.pool.waitTimeout,
+	}
+
+	if s.password != "" {
+		info.Password = redisMaskedPassword
+	}
+
+	if s.sentinel != nil {
+		info.SentinelMaster = s.sentinel.masterName
+	}
+
+	return info, true
+}
+
+// CloseRedis closes the redis pools and removes them from registry, the default pool is closed when no name is specified.
+// The pools are closed concurrently, each waits at most 10s for its connections in use (see RedisPoolResource.Close).
+func CloseRedis(name ...string) {
+	if len(name) == 0 {
+		name = []string{AsDefault}
+	}
+
+	var wg sync.WaitGroup
+
+	for _, v := range name {
+		redisMutex.Lock()
+
+		poolResource, ok := redisMap.Load(v)
+
+		if !ok {
+			redisMutex.Unlock()
+
+			continue
+		}
+
+		redisMap.Delete(v)
+		redisClosed.Store(v, struct{}{})
+
+		redisMutex.Unlock()
+
+		wg.Add(1)
+
+		go func(name string, poolResource *RedisPoolResource) {
+			defer wg.Done()
+
+			poolResource.Close()
+
+			logger().Info(fmt.Sprintf("yiigo: redis.%s is closed.", name))
+		}(v, poolResource.(*RedisPoolResource))
+	}
+
+	wg.Wait()
+}
+
+// DeregisterRedis removes the redis pool from registry and closes it, eg: short-lived or tenant pools.
+// Unlike CloseRedis, the name is forgotten as never registered. The default pool is refused unless force is true.
+// It waits at most 10s for the connections in use, the abandoned ones are reported by a warning.
+func DeregisterRedis(name string, force ...bool) error {
+	if name == AsDefault && (len(force) == 0 || !force[0]) {
+		return errors.New("yiigo: refuse to deregister the default redis without force")
+	}
+
+	redisMutex.Lock()
+
+	v, ok := redisMap.Load(name)
+
+	if !ok {
+		redisMutex.Unlock()
+
+		return redisUnknownError(name)
+	}
+
+	redisMap.Delete(name)
+	redisClosed.Delete(name)
+
+	redisMutex.Unlock()
+
+	v.(*RedisPoolResource).Close()
+
+	logger().Info(fmt.Sprintf("yiigo: redis.%s is deregistered.", name))
+
+	return nil
+}
+
+// closeAllRedis closes all the registered redis pools.
+func closeAllRedis() {
+	CloseRedis(RedisNames()...)
+}
@@ -0,0 +1,228 @@
+package yiigo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"go.uber.org/zap"
+)
+
+// RedisPool the pool of redis connections, implemented by RedisPoolResource.
+// It can be implemented by other clients (eg: NewGoRedisPool with the build tag goredis) and registered by RegisterRedisPool.
+type RedisPool interface {
+	// Get gets a connection resource from the pool.
+	Get() (RedisConn, error)
+
+	// Put returns a connection resource to the pool, the error of the last command can be passed optionally.
+	Put(rc RedisConn, err ...error)
+
+	// SetCapacity resizes the pool at runtime.
+	SetCapacity(ctx context.Context, size int) error
+
+	// Stats returns the pool statistics.
+	Stats() RedisPoolStats
+}
+
+var _ RedisPool = (*RedisPoolResource)(nil)
+
+// errRedisBackendConnClosed returned by the connection which has been returned to the backend pool.
+var errRedisBackendConnClosed = errors.New("yiigo: redis connection is returned to the backend pool")
+
+// RegisterRedisPool registers a redis pool with the given name, so that the helpers (Cache, Lock, Txn, etc.) run on it.
+// The *RedisPoolResource is registered as is, eg: an alias of a registered pool.
+// The others are used as the backend of connections, which are neither pinged nor closed by yiigo,
+// and the options of address (failover, replicas, sentinel) are ignored.
+// It panics when failed to verify the pool, unless an error handler is specified by SetErrorHandler.
+func RegisterRedisPool(name string, pool RedisPool, options ...RedisOption) {
+	if err := registerRedisPool(name, pool, options...); err != nil && !handleError("redis", name, err) {
+		logger().Panic("yiigo: redis init error", zap.String("name", name), zap.Error(err))
+	}
+}
+
+func registerRedisPool(name string, pool RedisPool, options ...RedisOption) error {
+	if pool == nil {
+		return errors.New("yiigo: redis pool is nil")
+	}
+
+	if v, ok := pool.(*RedisPoolResource); ok {
+		storeRedis(name, v)
+
+		return nil
+	}
+
+	setting := newNamedRedisSetting(name, options...)
+
+	if err := setting.validate(); err != nil {
+		return err
+	}
+
+	setting.backend = pool
+	setting.sentinel = nil
+	setting.failoverAddrs = nil
+	setting.replicas = nil
+
+	poolResource := newRedisPoolResource(name, fmt.Sprintf("%T", pool), setting)
+
+	if !setting.lazyConnect {
+		if err := poolResource.ping(); err != nil {
+			poolResource.Close()
+
+			return err
+		}
+	}
+
+	storeRedis(name, poolResource)
+
+	return nil
+}
+
+// storeRedis stores the registered pool by name.
+func storeRedis(name string, poolResource *RedisPoolResource) {
+	redisMutex.Lock()
+
+	// the replaced one, eg: registered again by InitWithProfile
+	if v, ok := redisMap.Load(name); ok && v != poolResource {
+		go v.(*RedisPoolResource).drain()
+	}
+
+	redisMap.Store(name, poolResource)
+	redisClosed.Delete(name)
+
+	redisMutex.Unlock()
+
+	logger().Info(fmt.Sprintf("yiigo: redis.%s is OK.", name))
+}
+
+// redisPrefixer the pool with a key prefix, eg: *RedisPoolResource.
+type redisPrefixer interface {
+	Prefix() string
+}
+
+// redisContextGetter the pool which gets a connection with ctx, eg: *RedisPoolResource.
+type redisContextGetter interface {
+	GetContext(ctx context.Context) (RedisConn, error)
+}
+
+// redisPrefix returns the key prefix of the pool, unless disabled by RedisNoPrefix.
+func redisPrefix(ctx context.Context, pool RedisPool) string {
+	if noPrefix, _ := ctx.Value(redisNoPrefixKey{}).(bool); noPrefix {
+		return ""
+	}
+
+	if p, ok := pool.(redisPrefixer); ok {
+		return p.Prefix()
+	}
+
+	return ""
+}
+
+// redisPrefixKeys prepends the key prefix of the pool to the first n args.
+func redisPrefixKeys(ctx context.Context, pool RedisPool, n int, args []interface{}) []interface{} {
+	prefix := redisPrefix(ctx, pool)
+
+	if prefix == "" || n <= 0 || len(args) == 0 {
+		return args
+	}
+
+	if n > len(args) {
+		n = len(args)
+	}
+
+	prefixed := make([]interface{}, len(args))
+
+	copy(prefixed, args)
+
+	for i := 0; i < n; i++ {
+		prefixed[i] = prefix + redisKey(args[i])
+	}
+
+	return prefixed
+}
+
+// redisGet gets a connection from the pool, with ctx when supported.
+func redisGet(ctx context.Context, pool RedisPool) (RedisConn, error) {
+	if p, ok := pool.(redisContextGetter); ok {
+		return p.GetContext(ctx)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return RedisConn{}, err
+	}
+
+	return pool.Get()
+}
+
+// redisDo sends the command by a connection of the pool, the args are sent as is.
+func redisDo(ctx context.Context, pool RedisPool, cmd string, args ...interface{}) (interface{}, error) {
+	if r, ok := pool.(*RedisPoolResource); ok {
+		return r.do(ctx, cmd, args...)
+	}
+
+	conn, err := redisGet(ctx, pool)
+
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := conn.DoContext(ctx, cmd, args...)
+
+	pool.Put(conn, err)
+
+	return reply, err
+}
+
+// dialBackend gets a connection from the backend pool, which is returned there when closed.
+func (r *RedisPoolResource) dialBackend() (redis.Conn, error) {
+	rc, err := r.setting.backend.Get()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if rc.Conn == nil {
+		r.setting.backend.Put(rc)
+
+		return nil, errors.New("yiigo: invalid connection from the backend pool")
+	}
+
+	return &redisBackendConn{Conn: rc.Conn, rc: rc, pool: r.setting.backend}, nil
+}
+
+// redisBackendConn the connection borrowed from the backend pool
+type redisBackendConn struct {
+	redis.Conn
+	rc     RedisConn
+	pool   RedisPool
+	closed int32
+}
+
+// Close returns the connection to the backend pool, it can be called more than once.
+func (c *redisBackendConn) Close() error {
+	if !atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+		return nil
+	}
+
+	c.pool.Put(c.rc, c.Conn.Err())
+
+	return nil
+}
+
+func (c *redisBackendConn) Err() error {
+	if atomic.LoadInt32(&c.closed) == 1 {
+		return errRedisBackendConnClosed
+	}
+
+	return c.Conn.Err()
+}
+
+func (c *redisBackendConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	return redis.DoWithTimeout(c.Conn, timeout, cmd, args...)
+}
+
+func (c *redisBackendConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return redis.ReceiveWithTimeout(c.Conn, timeout)
+}
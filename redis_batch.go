@@ -0,0 +1,143 @@
+package yiigo
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+)
+
+// RedisChunkError reports the chunk which failed in MGetChunked or MSetChunked, the chunks before it have succeeded.
+type RedisChunkError struct {
+	// Chunk the index of the failed chunk
+	Chunk int
+	// Keys the keys of the failed chunk
+	Keys []string
+	Err  error
+}
+
+func (e *RedisChunkError) Error() string {
+	return fmt.Sprintf("yiigo: redis chunk %d (%d keys) error: %s", e.Chunk, len(e.Keys), e.Err.Error())
+}
+
+func (e *RedisChunkError) Unwrap() error {
+	return e.Err
+}
+
+// redisChunks splits the keys into chunks of size n, n <= 0 means one chunk.
+func redisChunks(keys []string, n int) [][]string {
+	if n <= 0 || n > len(keys) {
+		n = len(keys)
+	}
+
+	chunks := make([][]string, 0, (len(keys)+n-1)/n)
+
+	for i := 0; i < len(keys); i += n {
+		end := i + n
+
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		chunks = append(chunks, keys[i:end])
+	}
+
+	return chunks
+}
+
+// MGetChunked gets the keys with one MGET per chunk, the missing keys are absent from the result.
+// On failure, the values of the succeeded chunks are returned with a *RedisChunkError.
+func (r *RedisPoolResource) MGetChunked(ctx context.Context, keys []string, chunk int) (map[string][]byte, error) {
+	values := make(map[string][]byte, len(keys))
+
+	for i, c := range redisChunks(keys, chunk) {
+		args := redis.Args{}.AddFlat(c)
+
+		reply, err := redis.Values(r.do(ctx, "MGET", r.prefixKeys(ctx, len(args), args)...))
+
+		if err == nil && len(reply) != len(c) {
+			err = fmt.Errorf("yiigo: invalid redis MGET reply, expects %d values, got %d", len(c), len(reply))
+		}
+
+		if err != nil {
+			return values, &RedisChunkError{Chunk: i, Keys: c, Err: err}
+		}
+
+		for j, v := range reply {
+			if b, ok := v.([]byte); ok {
+				values[c[j]] = b
+			}
+		}
+	}
+
+	return values, nil
+}
+
+// MSetChunked sets the key-values with one MSET per chunk (in the order of keys).
+// MSET can't set expiry, so when ttl > 0, each chunk is sent as pipelined SET EX (PX, for sub-second precision) instead.
+// On failure, the chunks before the returned *RedisChunkError have been set, the keys of the failed chunk may be set partially.
+func (r *RedisPoolResource) MSetChunked(ctx context.Context, kv map[string][]byte, chunk int, ttl time.Duration) error {
+	keys := make([]string, 0, len(kv))
+
+	for k := range kv {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for i, c := range redisChunks(keys, chunk) {
+		var err error
+
+		if ttl > 0 {
+			err = r.setChunk(ctx, c, kv, ttl)
+		} else {
+			args := make(redis.Args, 0, 2*len(c))
+
+			for _, k := range c {
+				args = append(args, r.prefixKeys(ctx, 1, []interface{}{k})[0], kv[k])
+			}
+
+			_, err = r.do(ctx, "MSET", args...)
+		}
+
+		if err != nil {
+			return &RedisChunkError{Chunk: i, Keys: c, Err: err}
+		}
+	}
+
+	return nil
+}
+
+func (r *RedisPoolResource) setChunk(ctx context.Context, keys []string, kv map[string][]byte, ttl time.Duration) error {
+	expire := []interface{}{"EX", int64(ttl / time.Second)}
+
+	// sub-second precision
+	if ttl%time.Second != 0 {
+		expire = []interface{}{"PX", int64(ttl / time.Millisecond)}
+	}
+
+	replies, err := r.Pipeline(ctx, func(p *RedisPipeline) error {
+		for _, k := range keys {
+			if err := p.Send("SET", append(r.prefixKeys(ctx, 1, []interface{}{k, kv[k]}), expire...)...); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for i, v := range replies {
+		if err, ok := v.(error); ok {
+			return errors.Wrapf(err, "SET %s", keys[i])
+		}
+	}
+
+	return nil
+}
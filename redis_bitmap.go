@@ -0,0 +1,90 @@
+package yiigo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// redisMaxBitOffset the max offset of SETBIT (the string value is limited to 512MB)
+const redisMaxBitOffset = 1<<32 - 1
+
+// The units of BitCountRange (redis 7+)
+const (
+	BitRangeByte = "BYTE"
+	BitRangeBit  = "BIT"
+)
+
+func redisBitOffset(offset int64) error {
+	if offset < 0 || offset > redisMaxBitOffset {
+		return fmt.Errorf("yiigo: redis bit offset %d is out of range [0, %d]", offset, int64(redisMaxBitOffset))
+	}
+
+	return nil
+}
+
+// BitSet sets the bit at offset with SETBIT, returns the original bit.
+func (r *RedisPoolResource) BitSet(ctx context.Context, key string, offset int64, value bool) (bool, error) {
+	if err := redisBitOffset(offset); err != nil {
+		return false, err
+	}
+
+	bit := 0
+
+	if value {
+		bit = 1
+	}
+
+	return redis.Bool(r.Do(ctx, "SETBIT", key, offset, bit))
+}
+
+// BitGet returns the bit at offset with GETBIT, false for the missing key or the offset beyond the value.
+func (r *RedisPoolResource) BitGet(ctx context.Context, key string, offset int64) (bool, error) {
+	if err := redisBitOffset(offset); err != nil {
+		return false, err
+	}
+
+	return redis.Bool(r.Do(ctx, "GETBIT", key, offset))
+}
+
+// BitCount counts the set bits between the bytes start and end (inclusive, negative counts from the end).
+// Use 0 and -1 to count the whole value.
+func (r *RedisPoolResource) BitCount(ctx context.Context, key string, startByte, endByte int64) (int64, error) {
+	return redis.Int64(r.Do(ctx, "BITCOUNT", key, startByte, endByte))
+}
+
+// BitCountRange counts the set bits between start and end in unit of BitRangeByte or BitRangeBit (redis 7+).
+func (r *RedisPoolResource) BitCountRange(ctx context.Context, key string, start, end int64, unit string) (int64, error) {
+	unit = strings.ToUpper(unit)
+
+	if unit != BitRangeByte && unit != BitRangeBit {
+		return 0, fmt.Errorf("yiigo: invalid redis BITCOUNT unit %q", unit)
+	}
+
+	return redis.Int64(r.Do(ctx, "BITCOUNT", key, start, end, unit))
+}
+
+// BitOp performs the bitwise operation (AND, OR, XOR or NOT) between the keys and stores the result in dest,
+// returns the size of dest in bytes. NOT takes exactly one key.
+func (r *RedisPoolResource) BitOp(ctx context.Context, op, dest string, keys ...string) (int64, error) {
+	op = strings.ToUpper(op)
+
+	switch op {
+	case "AND", "OR", "XOR":
+		if len(keys) == 0 {
+			return 0, fmt.Errorf("yiigo: redis BITOP %s requires at least one key", op)
+		}
+	case "NOT":
+		if len(keys) != 1 {
+			return 0, fmt.Errorf("yiigo: redis BITOP NOT requires exactly one key, got %d", len(keys))
+		}
+	default:
+		return 0, fmt.Errorf("yiigo: invalid redis BITOP operation %q", op)
+	}
+
+	args := redis.Args{dest}.AddFlat(keys)
+
+	return redis.Int64(r.do(ctx, "BITOP", append(redis.Args{op}, r.prefixKeys(ctx, len(args), args)...)...))
+}
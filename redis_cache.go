@@ -0,0 +1,261 @@
+package yiigo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"go.uber.org/zap"
+)
+
+// ErrCacheNotFound returned by the loader of GetOrSet to report the value does not exist,
+// it is cached with the ttl of WithCacheNotFound and returned by GetOrSet on hits.
+var ErrCacheNotFound = errors.New("yiigo: cache not found")
+
+// cacheNotFound the cached value of not found, which is not a valid JSON
+var cacheNotFound = []byte("yiigo:not_found")
+
+// cacheSetting cache setting
+type cacheSetting struct {
+	notFoundTTL      time.Duration
+	lockTTL          time.Duration
+	lockPollInterval time.Duration
+	lockWait         time.Duration
+}
+
+// CacheOption configures how we set up the cache
+type CacheOption interface {
+	apply(*cacheSetting)
+}
+
+// funcCacheOption implements cache option
+type funcCacheOption struct {
+	f func(*cacheSetting)
+}
+
+func (fo *funcCacheOption) apply(s *cacheSetting) {
+	fo.f(s)
+}
+
+func newFuncCacheOption(f func(*cacheSetting)) *funcCacheOption {
+	return &funcCacheOption{f: f}
+}
+
+// WithCacheLock specifies to rebuild the cache with a lock across instances (SET NX PX with the ttl),
+// the instances failed to acquire the lock poll the cache instead of calling the loader.
+func WithCacheLock(ttl time.Duration) CacheOption {
+	return newFuncCacheOption(func(s *cacheSetting) {
+		s.lockTTL = ttl
+	})
+}
+
+// WithCacheLockPollInterval specifies the interval of polling the cache while waiting for the lock holder, default is 50ms.
+func WithCacheLockPollInterval(d time.Duration) CacheOption {
+	return newFuncCacheOption(func(s *cacheSetting) {
+		s.lockPollInterval = d
+	})
+}
+
+// WithCacheLockWait specifies the maximum time of polling the cache, after which the loader is called anyway.
+// Default is the ttl of lock.
+func WithCacheLockWait(d time.Duration) CacheOption {
+	return newFuncCacheOption(func(s *cacheSetting) {
+		s.lockWait = d
+	})
+}
+
+// WithCacheNotFound specifies to cache ErrCacheNotFound of the loader with the ttl (negative cache).
+func WithCacheNotFound(ttl time.Duration) CacheOption {
+	return newFuncCacheOption(func(s *cacheSetting) {
+		s.notFoundTTL = ttl
+	})
+}
+
+// CacheSet marshals v to JSON and sets it with the ttl, ttl == 0 means no expiry.
+func (r *RedisPoolResource) CacheSet(ctx context.Context, key string, v interface{}, ttl time.Duration) error {
+	b, err := json.Marshal(v)
+
+	if err != nil {
+		return err
+	}
+
+	return r.cacheSet(ctx, key, b, ttl)
+}
+
+func (r *RedisPoolResource) cacheSet(ctx context.Context, key string, b []byte, ttl time.Duration) error {
+	args := redis.Args{key, b}
+
+	switch {
+	case ttl <= 0:
+	case ttl%time.Second == 0:
+		args = append(args, "EX", int64(ttl/time.Second))
+	default:
+		// sub-second precision
+		args = append(args, "PX", int64(ttl/time.Millisecond))
+	}
+
+	_, err := r.Do(ctx, "SET", args...)
+
+	return err
+}
+
+// CacheGet unmarshals the cached JSON into dest, ErrRedisNil is returned on miss and ErrCacheNotFound on the negative cache.
+func (r *RedisPoolResource) CacheGet(ctx context.Context, key string, dest interface{}) error {
+	b, err := redis.Bytes(r.Do(ctx, "GET", key))
+
+	if err != nil {
+		return redisNilError(err)
+	}
+
+	if bytes.Equal(b, cacheNotFound) {
+		return ErrCacheNotFound
+	}
+
+	return json.Unmarshal(b, dest)
+}
+
+// CacheDel deletes the cached keys.
+func (r *RedisPoolResource) CacheDel(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	args := redis.Args{}.AddFlat(keys)
+
+	_, err := r.do(ctx, "DEL", r.prefixKeys(ctx, len(args), args)...)
+
+	return err
+}
+
+// GetOrSet unmarshals the cached JSON into dest, on miss the loader is called and the result is cached with the ttl.
+// The concurrent loaders of the same key are deduplicated in-process, they share the result of the first caller (with its ctx).
+// With WithCacheLock, the loaders are deduplicated across instances too.
+// The loader errors are not cached, except ErrCacheNotFound with WithCacheNotFound.
+func (r *RedisPoolResource) GetOrSet(ctx context.Context, key string, ttl time.Duration, dest interface{}, loader func(ctx context.Context) (interface{}, error), options ...CacheOption) error {
+	b, err := r.cacheLookup(ctx, key)
+
+	if err == redis.ErrNil {
+		setting := &cacheSetting{
+			lockPollInterval: 50 * time.Millisecond,
+		}
+
+		for _, option := range options {
+			option.apply(setting)
+		}
+
+		var v interface{}
+
+		v, err, _ = r.flight.Do(redisKey(r.prefixKeys(ctx, 1, []interface{}{key})[0]), func() (interface{}, error) {
+			if setting.lockTTL > 0 {
+				return r.cacheLockLoad(ctx, key, ttl, loader, setting)
+			}
+
+			return r.cacheLoad(ctx, key, ttl, loader, setting)
+		})
+
+		if err == nil {
+			b = v.([]byte)
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, dest)
+}
+
+// cacheLookup returns the cached JSON, redis.ErrNil is returned on miss or when the cache is unavailable.
+func (r *RedisPoolResource) cacheLookup(ctx context.Context, key string) ([]byte, error) {
+	b, err := redis.Bytes(r.Do(ctx, "GET", key))
+
+	if err != nil {
+		if err != redis.ErrNil {
+			// load anyway when cache is unavailable
+			logThrottled(ctx, zap.WarnLevel, "yiigo: redis cache get error", zap.String("name", r.name), zap.String("key", key), zap.Error(err))
+		}
+
+		return nil, redis.ErrNil
+	}
+
+	if bytes.Equal(b, cacheNotFound) {
+		return nil, ErrCacheNotFound
+	}
+
+	return b, nil
+}
+
+// cacheLoad calls the loader and caches the result.
+func (r *RedisPoolResource) cacheLoad(ctx context.Context, key string, ttl time.Duration, loader func(ctx context.Context) (interface{}, error), setting *cacheSetting) ([]byte, error) {
+	v, err := loader(ctx)
+
+	if err != nil {
+		if err == ErrCacheNotFound && setting.notFoundTTL > 0 {
+			if serr := r.cacheSet(ctx, key, cacheNotFound, setting.notFoundTTL); serr != nil {
+				logThrottled(ctx, zap.WarnLevel, "yiigo: redis cache set error", zap.String("name", r.name), zap.String("key", key), zap.Error(serr))
+			}
+		}
+
+		return nil, err
+	}
+
+	b, err := json.Marshal(v)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.cacheSet(ctx, key, b, ttl); err != nil {
+		logThrottled(ctx, zap.WarnLevel, "yiigo: redis cache set error", zap.String("name", r.name), zap.String("key", key), zap.Error(err))
+	}
+
+	return b, nil
+}
+
+// cacheLockLoad calls the loader only when the rebuild lock is acquired, otherwise polls the cache until the lock wait passes.
+// The loader is called anyway after the lock wait, the lock is released after loaded or failed.
+func (r *RedisPoolResource) cacheLockLoad(ctx context.Context, key string, ttl time.Duration, loader func(ctx context.Context) (interface{}, error), setting *cacheSetting) ([]byte, error) {
+	mutex := NewRedisMutex(r, key+":lock", WithMutexTTL(setting.lockTTL))
+
+	err := mutex.Lock(ctx)
+
+	switch err {
+	case nil:
+		defer func() {
+			if err := mutex.Unlock(context.Background()); err != nil && err != ErrMutexNotHeld {
+				logThrottled(ctx, zap.WarnLevel, "yiigo: redis cache unlock error", zap.String("name", r.name), zap.String("key", key), zap.Error(err))
+			}
+		}()
+	case ErrMutexNotAcquired:
+		wait := setting.lockWait
+
+		if wait <= 0 {
+			wait = setting.lockTTL
+		}
+
+		deadline := time.Now().Add(wait)
+
+		for time.Now().Before(deadline) {
+			timer := time.NewTimer(setting.lockPollInterval)
+
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+
+				return nil, ctx.Err()
+			case <-timer.C:
+			}
+
+			if b, err := r.cacheLookup(ctx, key); err != redis.ErrNil {
+				return b, err
+			}
+		}
+	default:
+		logThrottled(ctx, zap.WarnLevel, "yiigo: redis cache lock error", zap.String("name", r.name), zap.String("key", key), zap.Error(err))
+	}
+
+	return r.cacheLoad(ctx, key, ttl, loader, setting)
+}
@@ -0,0 +1,370 @@
+package yiigo
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"go.uber.org/zap"
+)
+
+const redisInvalidateChannel = "__redis__:invalidate"
+
+type redisCacheEntry struct {
+	key   string
+	value []byte
+}
+
+// redisClientCache the local LRU of the server-assisted client-side caching.
+// The invalidation messages are received by a dedicated connection which the pooled connections redirect to,
+// the generation is bumped each time it (re)connects, so the pooled connections know to redirect again.
+type redisClientCache struct {
+	maxEntries int
+	gen        int64 // 0 means the invalidation connection is not ready
+	lastGen    int64
+	clientID   int64
+	seq        int64
+	lru        *list.List
+	entries    map[string]*list.Element
+	pending    map[string]int64
+	conn       redis.Conn
+	done       chan struct{}
+	closed     bool
+	mutex      sync.Mutex
+}
+
+func newRedisClientCache(maxEntries int) *redisClientCache {
+	return &redisClientCache{
+		maxEntries: maxEntries,
+		lru:        list.New(),
+		entries:    make(map[string]*list.Element),
+		pending:    make(map[string]int64),
+		done:       make(chan struct{}),
+	}
+}
+
+func (c *redisClientCache) get(key string) ([]byte, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	e, ok := c.entries[key]
+
+	if !ok {
+		return nil, false
+	}
+
+	c.lru.MoveToFront(e)
+
+	return append([]byte{}, e.Value.(*redisCacheEntry).value...), true
+}
+
+// begin marks the key pending before GET is sent, an invalidation arrives before set drops the pending mark.
+func (c *redisClientCache) begin(key string) (gen, seq int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.gen == 0 {
+		return 0, 0
+	}
+
+	c.seq++
+	c.pending[key] = c.seq
+
+	return c.gen, c.seq
+}
+
+// set stores the value if the key is not invalidated since begin.
+func (c *redisClientCache) set(key string, gen, seq int64, value []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.pending[key] != seq {
+		return
+	}
+
+	delete(c.pending, key)
+
+	if value == nil || gen != c.gen {
+		return
+	}
+
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*redisCacheEntry).value = append([]byte{}, value...)
+		c.lru.MoveToFront(e)
+
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(&redisCacheEntry{
+		key:   key,
+		value: append([]byte{}, value...),
+	})
+
+	for c.lru.Len() > c.maxEntries {
+		e := c.lru.Back()
+
+		c.lru.Remove(e)
+		delete(c.entries, e.Value.(*redisCacheEntry).key)
+	}
+}
+
+// invalidate removes the keys of the invalidation message, nil means all the keys (eg: FLUSHALL).
+func (c *redisClientCache) invalidate(keys interface{}) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	values, ok := keys.([]interface{})
+
+	if !ok {
+		c.flush()
+
+		return
+	}
+
+	for _, v := range values {
+		key := redisKey(v)
+
+		if e, ok := c.entries[key]; ok {
+			c.lru.Remove(e)
+			delete(c.entries, key)
+		}
+
+		delete(c.pending, key)
+	}
+}
+
+// flush drops all the entries, must be called with the mutex held.
+func (c *redisClientCache) flush() {
+	c.lru.Init()
+	c.entries = make(map[string]*list.Element)
+	c.pending = make(map[string]int64)
+}
+
+// track redirects the invalidation messages of the connection to the current invalidation connection.
+func (c *redisClientCache) track(rc *RedisConn) {
+	c.mutex.Lock()
+	gen, clientID := c.gen, c.clientID
+	c.mutex.Unlock()
+
+	if gen == 0 || rc.tracking == gen {
+		return
+	}
+
+	if _, err := rc.Conn.Do("CLIENT", "TRACKING", "ON", "REDIRECT", clientID); err != nil {
+		logThrottled(context.Background(), zap.WarnLevel, "yiigo: redis client tracking error", zap.Error(err))
+
+		return
+	}
+
+	if _, ok := rc.Conn.(*redisTrackedConn); !ok {
+		rc.Conn = &redisTrackedConn{Conn: rc.Conn, cache: c}
+	}
+
+	rc.tracking = gen
+}
+
+// lost flushes the cache when a tracked connection is closed, eg: broken, expired or reaped.
+func (c *redisClientCache) lost() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.flush()
+}
+
+// redisTrackedConn the connection with CLIENT TRACKING on. The server stops tracking the keys read by it once closed,
+// so that their invalidation messages are never sent to the redirected connection, and the cache is flushed then.
+type redisTrackedConn struct {
+	redis.Conn
+	cache *redisClientCache
+}
+
+func (c *redisTrackedConn) Close() error {
+	c.cache.lost()
+
+	return c.Conn.Close()
+}
+
+func (c *redisTrackedConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	return redis.DoWithTimeout(c.Conn, timeout, cmd, args...)
+}
+
+func (c *redisTrackedConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return redis.ReceiveWithTimeout(c.Conn, timeout)
+}
+
+func (c *redisClientCache) connected(conn redis.Conn, clientID int64) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		return false
+	}
+
+	c.flush()
+
+	c.lastGen++
+	c.gen = c.lastGen
+	c.clientID = clientID
+	c.conn = conn
+
+	return true
+}
+
+// disconnected flushes the cache, the invalidation messages may be lost while reconnecting.
+func (c *redisClientCache) disconnected() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.flush()
+
+	c.gen = 0
+	c.conn = nil
+}
+
+func (c *redisClientCache) close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		return
+	}
+
+	c.closed = true
+
+	close(c.done)
+
+	if c.conn != nil {
+		c.conn.Close()
+	}
+}
+
+// run keeps the invalidation connection alive until the pool is closed.
+func (c *redisClientCache) run(r *RedisPoolResource) {
+	backoff := redisPubSubMinBackoff
+
+	for {
+		subscribed, err := c.serve(r)
+
+		select {
+		case <-c.done:
+			return
+		default:
+		}
+
+		logThrottled(context.Background(), zap.ErrorLevel, "yiigo: redis client cache invalidation error", zap.String("name", r.name), zap.Error(err))
+
+		if subscribed {
+			backoff = redisPubSubMinBackoff
+		}
+
+		select {
+		case <-c.done:
+			return
+		case <-time.After(backoff):
+		}
+
+		if backoff *= 2; backoff > redisPubSubMaxBackoff {
+			backoff = redisPubSubMaxBackoff
+		}
+	}
+}
+
+// serve subscribes the invalidation channel with a new connection and applies the messages until the connection fails.
+func (c *redisClientCache) serve(r *RedisPoolResource) (bool, error) {
+	conn, err := r.dial(context.Background())
+
+	if err != nil {
+		return false, err
+	}
+
+	defer conn.Close()
+
+	clientID, err := redis.Int64(conn.Do("CLIENT", "ID"))
+
+	if err != nil {
+		return false, err
+	}
+
+	if _, err = conn.Do("SUBSCRIBE", redisInvalidateChannel); err != nil {
+		return false, err
+	}
+
+	if !c.connected(conn, clientID) {
+		return false, nil
+	}
+
+	defer c.disconnected()
+
+	errc := make(chan error, 1)
+
+	go func() {
+		for {
+			values, err := redis.Values(redis.ReceiveWithTimeout(conn, 2*redisPubSubPingInterval))
+
+			if err != nil {
+				errc <- err
+
+				return
+			}
+
+			// [message, __redis__:invalidate, keys]
+			if len(values) == 3 && redisKey(values[0]) == "message" {
+				c.invalidate(values[2])
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(redisPubSubPingInterval)
+
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return true, nil
+		case err := <-errc:
+			return true, err
+		case <-ticker.C:
+			if err := conn.Send("PING"); err != nil {
+				return true, err
+			}
+
+			if err := conn.Flush(); err != nil {
+				return true, err
+			}
+		}
+	}
+}
+
+// cachedGet serves GET from the local cache, the reply of redis is cached when the connection is tracked.
+func (r *RedisPoolResource) cachedGet(ctx context.Context, key string) (interface{}, error) {
+	if v, ok := r.cache.get(key); ok {
+		return v, nil
+	}
+
+	conn, err := r.GetContext(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	gen, seq := r.cache.begin(key)
+
+	reply, err := conn.DoContext(ctx, "GET", key)
+
+	r.Put(conn, err)
+
+	if gen != 0 {
+		var value []byte
+
+		if b, ok := reply.([]byte); ok && err == nil && conn.tracking == gen {
+			value = b
+		}
+
+		r.cache.set(key, gen, seq, value)
+	}
+
+	return reply, err
+}
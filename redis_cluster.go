@@ -0,0 +1,445 @@
+package yiigo
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	redisClusterSlots        = 16384
+	redisClusterMaxRedirects = 5
+)
+
+// RedisClusterResource redis cluster resource, routes commands to nodes by the key hash slot.
+type RedisClusterResource struct {
+	refreshing int32
+
+	name    string
+	seeds   []string
+	setting *redisSetting
+	slots   [redisClusterSlots]string
+	nodes   map[string]*RedisPoolResource
+	mutex   sync.RWMutex
+}
+
+// Do sends a command to the node which serves the key, the key is located by redisClusterKey (eg: the first argument).
+// MOVED and ASK redirections are followed transparently.
+func (c *RedisClusterResource) Do(cmd string, args ...interface{}) (interface{}, error) {
+	return c.DoContext(context.Background(), cmd, args...)
+}
+
+// DoContext sends a command to the node which serves the key, respecting the ctx cancellation and deadline.
+// The key is located by the command, eg: the first key of EVAL, the first stream of XREAD, otherwise the first argument.
+// MOVED and ASK redirections are followed transparently, the slot map is reloaded in background on MOVED or connection errors.
+func (c *RedisClusterResource) DoContext(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
+	addr := ""
+
+	if key, ok := redisClusterKey(cmd, args); ok {
+		addr = c.slotAddr(RedisClusterSlot(key))
+	}
+
+	asking := false
+
+	for i := 0; i <= redisClusterMaxRedirects; i++ {
+		reply, err := c.doNode(ctx, addr, asking, cmd, args...)
+
+		redisErr, ok := err.(redis.Error)
+
+		if !ok {
+			// the node may be failed over
+			if isRedisConnError(err) && ctx.Err() == nil {
+				c.refreshAsync()
+			}
+
+			return reply, err
+		}
+
+		msg := string(redisErr)
+
+		switch {
+		case strings.HasPrefix(msg, "MOVED "):
+			slot, movedAddr, err := parseRedisRedirect(msg)
+
+			if err != nil {
+				return nil, err
+			}
+
+			c.setSlotAddr(slot, movedAddr)
+
+			// the other slots may be moved too, eg: resharding or failover
+			c.refreshAsync()
+
+			addr, asking = movedAddr, false
+		case strings.HasPrefix(msg, "ASK "):
+			_, askAddr, err := parseRedisRedirect(msg)
+
+			if err != nil {
+				return nil, err
+			}
+
+			addr, asking = askAddr, true
+		default:
+			return reply, err
+		}
+	}
+
+	return nil, errors.New("yiigo: too many redis cluster redirections")
+}
+
+// redisClusterKey returns the key which the command is routed by, false means the command has no key.
+func redisClusterKey(cmd string, args []interface{}) (string, bool) {
+	switch strings.ToUpper(cmd) {
+	case "EVAL", "EVALSHA", "EVAL_RO", "EVALSHA_RO", "FCALL", "FCALL_RO":
+		// script numkeys key [key ...] arg [arg ...]
+		if len(args) < 3 {
+			return "", false
+		}
+
+		if n, err := strconv.Atoi(redisKey(args[1])); err != nil || n <= 0 {
+			return "", false
+		}
+
+		return redisKey(args[2]), true
+	case "XREAD", "XREADGROUP":
+		// [GROUP group consumer] [COUNT count] [BLOCK ms] STREAMS key [key ...] id [id ...]
+		for i := 0; i < len(args)-1; i++ {
+			if strings.EqualFold(redisKey(args[i]), "STREAMS") {
+				return redisKey(args[i+1]), true
+			}
+		}
+
+		return "", false
+	case "OBJECT", "MEMORY", "XINFO", "XGROUP", "BITOP":
+		// subcommand key, eg: OBJECT ENCODING key, MEMORY USAGE key, BITOP AND destkey key
+		if len(args) < 2 {
+			return "", false
+		}
+
+		return redisKey(args[1]), true
+	}
+
+	if len(args) == 0 {
+		return "", false
+	}
+
+	return redisKey(args[0]), true
+}
+
+func (c *RedisClusterResource) doNode(ctx context.Context, addr string, asking bool, cmd string, args ...interface{}) (reply interface{}, err error) {
+	pool := c.node(addr)
+
+	conn, err := pool.GetContext(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		pool.Put(conn, err)
+	}()
+
+	if asking {
+		if _, err = conn.DoContext(ctx, "ASKING"); err != nil {
+			return nil, err
+		}
+	}
+
+	return conn.DoContext(ctx, cmd, args...)
+}
+
+// node returns the pool of the node, the first seed node is returned when addr is empty.
+func (c *RedisClusterResource) node(addr string) *RedisPoolResource {
+	if addr == "" {
+		addr = c.seeds[0]
+	}
+
+	c.mutex.RLock()
+	pool, ok := c.nodes[addr]
+	c.mutex.RUnlock()
+
+	if ok {
+		return pool
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if pool, ok = c.nodes[addr]; !ok {
+		pool = newRedisPoolResource(fmt.Sprintf("%s@%s", c.name, addr), addr, c.setting)
+
+		c.nodes[addr] = pool
+	}
+
+	return pool
+}
+
+func (c *RedisClusterResource) slotAddr(slot int) string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.slots[slot]
+}
+
+func (c *RedisClusterResource) setSlotAddr(slot int, addr string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.slots[slot] = addr
+}
+
+// refreshAsync reloads the slot map in background, at most one reload runs at a time.
+func (c *RedisClusterResource) refreshAsync() {
+	if !atomic.CompareAndSwapInt32(&c.refreshing, 0, 1) {
+		return
+	}
+
+	go func() {
+		defer atomic.StoreInt32(&c.refreshing, 0)
+
+		if err := c.refresh(); err != nil {
+			logThrottled(context.Background(), zap.WarnLevel, "yiigo: redis cluster refresh error", zap.String("name", c.name), zap.Error(err))
+		}
+	}()
+}
+
+// refresh reloads the slot map with CLUSTER SLOTS from the seed nodes, and then the known nodes.
+func (c *RedisClusterResource) refresh() error {
+	var err error
+
+	for _, seed := range c.refreshAddrs() {
+		var reply []interface{}
+
+		reply, err = redis.Values(c.doNode(context.Background(), seed, false, "CLUSTER", "SLOTS"))
+
+		if err != nil {
+			continue
+		}
+
+		var slots [redisClusterSlots]string
+
+		for _, v := range reply {
+			// [start, end, [host, port, id], replicas...]
+			var (
+				start, end int
+				master     []interface{}
+			)
+
+			values, err := redis.Values(v, nil)
+
+			if err != nil {
+				return errors.Wrap(err, "yiigo: parse redis cluster slots error")
+			}
+
+			if _, err = redis.Scan(values, &start, &end, &master); err != nil {
+				return errors.Wrap(err, "yiigo: parse redis cluster slots error")
+			}
+
+			var (
+				host string
+				port int
+			)
+
+			if _, err = redis.Scan(master, &host, &port); err != nil {
+				return errors.Wrap(err, "yiigo: parse redis cluster slots error")
+			}
+
+			// an empty host means the same host as the seed node
+			if host == "" {
+				host, _, _ = net.SplitHostPort(seed)
+			}
+
+			for i := start; i <= end && i < redisClusterSlots; i++ {
+				slots[i] = net.JoinHostPort(host, strconv.Itoa(port))
+			}
+		}
+
+		c.mutex.Lock()
+		c.slots = slots
+		c.mutex.Unlock()
+
+		return nil
+	}
+
+	return errors.Wrap(err, "yiigo: load redis cluster slots error")
+}
+
+// refreshAddrs returns the seed nodes followed by the other known nodes.
+func (c *RedisClusterResource) refreshAddrs() []string {
+	addrs := append([]string{}, c.seeds...)
+
+	known := make(map[string]bool, len(c.seeds))
+
+	for _, v := range c.seeds {
+		known[v] = true
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	for addr := range c.nodes {
+		if !known[addr] {
+			addrs = append(addrs, addr)
+		}
+	}
+
+	return addrs
+}
+
+// parseRedisRedirect parses the redirection error, eg: MOVED 3999 127.0.0.1:6381
+func parseRedisRedirect(msg string) (int, string, error) {
+	fields := strings.Fields(msg)
+
+	if len(fields) != 3 {
+		return 0, "", fmt.Errorf("yiigo: invalid redis redirection: %s", msg)
+	}
+
+	slot, err := strconv.Atoi(fields[1])
+
+	if err != nil {
+		return 0, "", fmt.Errorf("yiigo: invalid redis redirection: %s", msg)
+	}
+
+	return slot, fields[2], nil
+}
+
+// redisKey returns the string form of a key argument.
+func redisKey(arg interface{}) string {
+	switch v := arg.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// RedisClusterSlot returns the hash slot of the key, hash tags ({...}) are supported.
+func RedisClusterSlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start != -1 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+
+	return int(crc16([]byte(key)) % redisClusterSlots)
+}
+
+// crc16 implements the CRC16-CCITT (XMODEM) used by redis cluster.
+func crc16(b []byte) uint16 {
+	var crc uint16
+
+	for _, v := range b {
+		crc ^= uint16(v) << 8
+
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
+
+// Close closes all the node pools of the cluster.
+func (c *RedisClusterResource) Close() {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	for _, pool := range c.nodes {
+		pool.Close()
+	}
+}
+
+var (
+	defaultRedisCluster *RedisClusterResource
+	redisClusterMap     sync.Map
+)
+
+// RegisterRedisCluster registers a redis cluster with the given name and seed node addresses.
+func RegisterRedisCluster(name string, addrs []string, options ...RedisOption) {
+	if len(addrs) == 0 {
+		if err := errors.New("at least one address is required"); !handleError("redis_cluster", name, err) {
+			logger().Panic("yiigo: redis cluster init error", zap.String("name", name), zap.Error(err))
+		}
+
+		return
+	}
+
+	cluster := &RedisClusterResource{
+		name:    name,
+		seeds:   addrs,
+		setting: newRedisSetting(options...),
+		nodes:   make(map[string]*RedisPoolResource),
+	}
+
+	if err := cluster.refresh(); err != nil {
+		cluster.Close()
+
+		if !handleError("redis_cluster", name, err) {
+			logger().Panic("yiigo: redis cluster init error", zap.String("name", name), zap.Error(err))
+		}
+
+		return
+	}
+
+	if name == AsDefault {
+		defaultRedisCluster = cluster
+	}
+
+	redisClusterMap.Store(name, cluster)
+
+	logger().Info(fmt.Sprintf("yiigo: redis_cluster.%s is OK.", name))
+}
+
+// RedisCluster returns a redis cluster.
+// It panics when the cluster is not registered, unless an error handler is specified by SetErrorHandler (nil is returned then).
+func RedisCluster(name ...string) *RedisClusterResource {
+	if len(name) == 0 {
+		if defaultRedisCluster == nil {
+			redisClusterUnknown(AsDefault)
+		}
+
+		return defaultRedisCluster
+	}
+
+	v, ok := redisClusterMap.Load(name[0])
+
+	if !ok {
+		redisClusterUnknown(name[0])
+
+		return nil
+	}
+
+	return v.(*RedisClusterResource)
+}
+
+func redisClusterUnknown(name string) {
+	if err := fmt.Errorf("yiigo: unknown redis_cluster.%s (forgotten configure?)", name); !handleError("redis_cluster", name, err) {
+		logger().Panic(err.Error())
+	}
+}
+
+// closeAllRedisCluster closes all the registered redis clusters.
+func closeAllRedisCluster() {
+	redisClusterMap.Range(func(key, value interface{}) bool {
+		value.(*RedisClusterResource).Close()
+		redisClusterMap.Delete(key)
+
+		return true
+	})
+
+	defaultRedisCluster = nil
+}
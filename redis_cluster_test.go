@@ -0,0 +1,147 @@
+package yiigo
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisClusterSlot(t *testing.T) {
+	assert.Equal(t, uint16(0x31C3), crc16([]byte("123456789")))
+	assert.Equal(t, 12182, RedisClusterSlot("foo"))
+	assert.Equal(t, RedisClusterSlot("user1000"), RedisClusterSlot("{user1000}.following"))
+	assert.Equal(t, RedisClusterSlot("{}.following"), RedisClusterSlot("{}.following"))
+	assert.NotEqual(t, RedisClusterSlot("{}.following"), RedisClusterSlot(""))
+}
+
+func TestRedisClusterRedirect(t *testing.T) {
+	nodeB := newTestRedisServer(t, nil, func(args []string) interface{} {
+		switch strings.ToUpper(args[0]) {
+		case "GET":
+			return "bar"
+		}
+
+		return testStatus("OK")
+	})
+
+	defer nodeB.Close()
+
+	var (
+		nodeA *testRedisServer
+		moved int32
+	)
+
+	slotsNode := func(start, end int, server *testRedisServer) interface{} {
+		host, port, _ := net.SplitHostPort(server.Addr())
+		p, _ := strconv.Atoi(port)
+
+		return []interface{}{start, end, []interface{}{host, p, "id"}}
+	}
+
+	nodeA = newTestRedisServer(t, nil, func(args []string) interface{} {
+		switch strings.ToUpper(args[0]) {
+		case "CLUSTER":
+			if atomic.LoadInt32(&moved) == 0 {
+				return []interface{}{slotsNode(0, redisClusterSlots-1, nodeA)}
+			}
+
+			return []interface{}{slotsNode(0, 12181, nodeA), slotsNode(12182, 12182, nodeB), slotsNode(12183, redisClusterSlots-1, nodeA)}
+		case "GET":
+			if args[1] == "foo" {
+				atomic.StoreInt32(&moved, 1)
+
+				return errors.New("MOVED 12182 " + nodeB.Addr())
+			}
+
+			return errors.New("ASK 1 " + nodeB.Addr())
+		}
+
+		return testStatus("OK")
+	})
+
+	defer nodeA.Close()
+
+	RegisterRedisCluster("cluster", []string{nodeA.Addr()})
+
+	waitRefreshed := func(n int) {
+		for i := 0; i < 100; i++ {
+			cnt := 0
+
+			for _, cmd := range nodeA.Commands() {
+				if cmd == "CLUSTER SLOTS" {
+					cnt++
+				}
+			}
+
+			if cnt >= n && atomic.LoadInt32(&RedisCluster("cluster").refreshing) == 0 {
+				return
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		t.Fatal("slots not refreshed")
+	}
+
+	// MOVED, the slot map is reloaded
+	reply, err := RedisCluster("cluster").Do("GET", "foo")
+
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("bar"), reply)
+
+	waitRefreshed(2)
+
+	reply, err = RedisCluster("cluster").Do("GET", "foo")
+
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("bar"), reply)
+	assert.Equal(t, []string{"CLUSTER SLOTS", "GET foo", "CLUSTER SLOTS"}, nodeA.Commands())
+
+	// ASK
+	reply, err = RedisCluster("cluster").Do("GET", "baz")
+
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("bar"), reply)
+	assert.Equal(t, []string{"GET foo", "GET foo", "ASKING", "GET baz"}, nodeB.Commands())
+
+	// the slot map is reloaded on connection errors
+	nodeB.Close()
+
+	_, err = RedisCluster("cluster").Do("GET", "foo")
+
+	assert.NotNil(t, err)
+
+	waitRefreshed(3)
+}
+
+func TestRedisClusterKey(t *testing.T) {
+	cases := []struct {
+		cmd  string
+		args []interface{}
+		key  string
+		ok   bool
+	}{
+		{"GET", []interface{}{"foo"}, "foo", true},
+		{"PING", nil, "", false},
+		{"EVALSHA", []interface{}{"sha", 2, "k1", "k2", "arg"}, "k1", true},
+		{"eval", []interface{}{"return 1", "0"}, "", false},
+		{"XREADGROUP", []interface{}{"GROUP", "g", "c", "COUNT", 10, "streams", "s1", ">"}, "s1", true},
+		{"XREAD", []interface{}{"COUNT", 10}, "", false},
+		{"OBJECT", []interface{}{"ENCODING", "foo"}, "foo", true},
+		{"MEMORY", []interface{}{"USAGE", "foo"}, "foo", true},
+		{"XGROUP", []interface{}{"CREATE", "s1", "g", "$"}, "s1", true},
+	}
+
+	for _, c := range cases {
+		key, ok := redisClusterKey(c.cmd, c.args)
+
+		assert.Equal(t, c.ok, ok, c.cmd)
+		assert.Equal(t, c.key, key, c.cmd)
+	}
+}
@@ -0,0 +1,137 @@
+package yiigo
+
+import (
+	"context"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+)
+
+// GeoMember the member of GEO set
+type GeoMember struct {
+	Name      string
+	Longitude float64
+	Latitude  float64
+}
+
+// GeoLocation the position of GEO member
+type GeoLocation struct {
+	Longitude float64
+	Latitude  float64
+}
+
+// GeoResult the result of GeoSearch
+type GeoResult struct {
+	Name      string
+	Distance  float64
+	Longitude float64
+	Latitude  float64
+}
+
+// GeoAdd adds the members to the GEO set, returns the number of new members.
+func (r *RedisPoolResource) GeoAdd(ctx context.Context, key string, members ...GeoMember) (int64, error) {
+	if len(members) == 0 {
+		return 0, nil
+	}
+
+	args := redis.Args{key}
+
+	for _, m := range members {
+		args = append(args, m.Longitude, m.Latitude, m.Name)
+	}
+
+	return redis.Int64(r.Do(ctx, "GEOADD", args...))
+}
+
+// GeoPos returns the positions of the members in order, nil for the missing members.
+func (r *RedisPoolResource) GeoPos(ctx context.Context, key string, names ...string) ([]*GeoLocation, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	reply, err := redis.Values(r.Do(ctx, "GEOPOS", redis.Args{key}.AddFlat(names)...))
+
+	if err != nil {
+		return nil, err
+	}
+
+	locations := make([]*GeoLocation, 0, len(reply))
+
+	for _, v := range reply {
+		if v == nil {
+			locations = append(locations, nil)
+
+			continue
+		}
+
+		loc, err := parseGeoLocation(v)
+
+		if err != nil {
+			return nil, err
+		}
+
+		locations = append(locations, loc)
+	}
+
+	return locations, nil
+}
+
+// GeoSearch returns the members within the radius of the position (redis 6.2+), nearest first with the distances and coordinates.
+// The unit is one of m, km, ft and mi, count <= 0 means no limit.
+func (r *RedisPoolResource) GeoSearch(ctx context.Context, key string, lon, lat float64, radius float64, unit string, count int) ([]GeoResult, error) {
+	args := redis.Args{key, "FROMLONLAT", lon, lat, "BYRADIUS", radius, unit, "ASC"}
+
+	if count > 0 {
+		args = append(args, "COUNT", count)
+	}
+
+	reply, err := redis.Values(r.Do(ctx, "GEOSEARCH", append(args, "WITHCOORD", "WITHDIST")...))
+
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]GeoResult, 0, len(reply))
+
+	for _, v := range reply {
+		// [name, distance, [longitude, latitude]]
+		values, err := redis.Values(v, nil)
+
+		if err != nil || len(values) != 3 {
+			return nil, errors.New("yiigo: invalid redis GEOSEARCH reply")
+		}
+
+		var result GeoResult
+
+		if result.Name, err = redis.String(values[0], nil); err != nil {
+			return nil, errors.Wrap(err, "yiigo: invalid redis GEOSEARCH reply")
+		}
+
+		if result.Distance, err = redis.Float64(values[1], nil); err != nil {
+			return nil, errors.Wrap(err, "yiigo: invalid redis GEOSEARCH reply")
+		}
+
+		loc, err := parseGeoLocation(values[2])
+
+		if err != nil {
+			return nil, err
+		}
+
+		result.Longitude, result.Latitude = loc.Longitude, loc.Latitude
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// parseGeoLocation parses [longitude, latitude]
+func parseGeoLocation(v interface{}) (*GeoLocation, error) {
+	coord, err := redis.Float64s(v, nil)
+
+	if err != nil || len(coord) != 2 {
+		return nil, errors.New("yiigo: invalid redis GEO coordinates")
+	}
+
+	return &GeoLocation{Longitude: coord[0], Latitude: coord[1]}, nil
+}
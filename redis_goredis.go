@@ -0,0 +1,303 @@
+//go:build goredis
+// +build goredis
+
+package yiigo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// errGoRedisConnClosed returned by the closed go-redis connection.
+var errGoRedisConnClosed = errors.New("yiigo: go-redis connection is closed")
+
+// goRedisConnBound the commands bound to a single connection, which can't run on the go-redis client.
+var goRedisConnBound = map[string]bool{
+	"MULTI":        true,
+	"EXEC":         true,
+	"DISCARD":      true,
+	"WATCH":        true,
+	"UNWATCH":      true,
+	"SELECT":       true,
+	"SUBSCRIBE":    true,
+	"PSUBSCRIBE":   true,
+	"SSUBSCRIBE":   true,
+	"UNSUBSCRIBE":  true,
+	"PUNSUBSCRIBE": true,
+	"MONITOR":      true,
+}
+
+// goRedisPool the redis pool backed by a go-redis client
+type goRedisPool struct {
+	client goredis.UniversalClient
+}
+
+// NewGoRedisPool returns a redis pool backed by the go-redis client (eg: cluster, ring), requires the build tag `goredis`.
+// It is registered by RegisterRedisPool, and the client is not closed by yiigo.
+// The commands bound to a connection (MULTI/EXEC, WATCH, SUBSCRIBE, etc.) are not supported, so are Txn and Subscribe, use the client directly.
+// The RESP3 maps are flattened into arrays, set Protocol 2 of the client options to get the replies as is.
+func NewGoRedisPool(client goredis.UniversalClient) RedisPool {
+	return &goRedisPool{client: client}
+}
+
+func (p *goRedisPool) Get() (RedisConn, error) {
+	return RedisConn{Conn: &goRedisConn{client: p.client}}, nil
+}
+
+// Put does nothing, the connections are managed by the go-redis client.
+func (p *goRedisPool) Put(rc RedisConn, err ...error) {}
+
+// SetCapacity is not supported, the pool size is specified by the options of the go-redis client.
+func (p *goRedisPool) SetCapacity(ctx context.Context, size int) error {
+	return errors.New("yiigo: SetCapacity is not supported by the go-redis pool, specify PoolSize of the client options")
+}
+
+// Stats returns the statistics of the go-redis client pool, the ones not reported by go-redis are left zero.
+func (p *goRedisPool) Stats() RedisPoolStats {
+	stats := p.client.PoolStats()
+
+	inUse := int64(stats.TotalConns) - int64(stats.IdleConns)
+
+	if inUse < 0 {
+		inUse = 0
+	}
+
+	return RedisPoolStats{
+		Available: int64(stats.IdleConns),
+		Active:    int64(stats.TotalConns),
+		InUse:     inUse,
+		Expired:   int64(stats.StaleConns),
+	}
+}
+
+// goRedisConn implements redis.Conn on the go-redis client, the commands sent are run in a go-redis pipeline when flushed.
+type goRedisConn struct {
+	client  goredis.UniversalClient
+	pending [][]interface{}
+	replies []*goredis.Cmd
+	closed  int32
+}
+
+func (c *goRedisConn) Close() error {
+	atomic.StoreInt32(&c.closed, 1)
+
+	c.pending, c.replies = nil, nil
+
+	return nil
+}
+
+func (c *goRedisConn) Err() error {
+	if atomic.LoadInt32(&c.closed) == 1 {
+		return errGoRedisConnClosed
+	}
+
+	return nil
+}
+
+func (c *goRedisConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	return c.do(context.Background(), cmd, args...)
+}
+
+func (c *goRedisConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	ctx := context.Background()
+
+	if timeout > 0 {
+		tctx, cancel := context.WithTimeout(ctx, timeout)
+
+		defer cancel()
+
+		ctx = tctx
+	}
+
+	return c.do(ctx, cmd, args...)
+}
+
+// do runs the command after the pending ones, the replies of all pending commands are returned when cmd is empty.
+func (c *goRedisConn) do(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
+	if err := c.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := c.flush(ctx); err != nil {
+		return nil, err
+	}
+
+	if cmd == "" {
+		replies := make([]interface{}, 0, len(c.replies))
+
+		for len(c.replies) != 0 {
+			reply, err := c.receive()
+
+			if err != nil {
+				if _, ok := err.(redis.Error); !ok {
+					return nil, err
+				}
+
+				reply = err
+			}
+
+			replies = append(replies, reply)
+		}
+
+		return replies, nil
+	}
+
+	// the replies not received are discarded, the same as redigo
+	c.replies = nil
+
+	if err := goRedisSupported(cmd); err != nil {
+		return nil, err
+	}
+
+	return goRedisReply(c.client.Do(ctx, goRedisArgs(cmd, args)...).Result())
+}
+
+func (c *goRedisConn) Send(cmd string, args ...interface{}) error {
+	if err := c.Err(); err != nil {
+		return err
+	}
+
+	if err := goRedisSupported(cmd); err != nil {
+		return err
+	}
+
+	c.pending = append(c.pending, goRedisArgs(cmd, args))
+
+	return nil
+}
+
+func (c *goRedisConn) Flush() error {
+	if err := c.Err(); err != nil {
+		return err
+	}
+
+	return c.flush(context.Background())
+}
+
+// flush runs the pending commands in a pipeline, the error of a command is returned by Receive.
+func (c *goRedisConn) flush(ctx context.Context) error {
+	if len(c.pending) == 0 {
+		return nil
+	}
+
+	pipe := c.client.Pipeline()
+
+	for _, args := range c.pending {
+		c.replies = append(c.replies, pipe.Do(ctx, args...))
+	}
+
+	c.pending = nil
+
+	if _, err := pipe.Exec(ctx); err != nil && !isGoRedisReplyError(err) {
+		c.replies = nil
+
+		return err
+	}
+
+	return nil
+}
+
+func (c *goRedisConn) Receive() (interface{}, error) {
+	if err := c.Err(); err != nil {
+		return nil, err
+	}
+
+	return c.receive()
+}
+
+func (c *goRedisConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return c.Receive()
+}
+
+func (c *goRedisConn) receive() (interface{}, error) {
+	if len(c.replies) == 0 {
+		return nil, errors.New("yiigo: no reply to receive, the commands are not sent or flushed")
+	}
+
+	cmd := c.replies[0]
+	c.replies = c.replies[1:]
+
+	return goRedisReply(cmd.Result())
+}
+
+func goRedisSupported(cmd string) error {
+	if goRedisConnBound[strings.ToUpper(cmd)] {
+		return fmt.Errorf("yiigo: %s is not supported by the go-redis pool, use the client directly", strings.ToUpper(cmd))
+	}
+
+	return nil
+}
+
+func goRedisArgs(cmd string, args []interface{}) []interface{} {
+	return append([]interface{}{cmd}, args...)
+}
+
+func isGoRedisReplyError(err error) bool {
+	var e goredis.Error
+
+	return errors.As(err, &e)
+}
+
+// goRedisReply converts the reply of go-redis to the one of redigo, so that the reply helpers (eg: redis.Int64) work.
+func goRedisReply(reply interface{}, err error) (interface{}, error) {
+	if err != nil {
+		if err == goredis.Nil {
+			return nil, nil
+		}
+
+		if isGoRedisReplyError(err) {
+			return nil, redis.Error(err.Error())
+		}
+
+		return nil, err
+	}
+
+	return goRedisValue(reply), nil
+}
+
+func goRedisValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return []byte(v)
+	case bool:
+		if v {
+			return int64(1)
+		}
+
+		return int64(0)
+	case float64:
+		return []byte(strconv.FormatFloat(v, 'f', -1, 64))
+	case error:
+		if v == goredis.Nil {
+			return nil
+		}
+
+		return redis.Error(v.Error())
+	case []interface{}:
+		values := make([]interface{}, 0, len(v))
+
+		for _, e := range v {
+			values = append(values, goRedisValue(e))
+		}
+
+		return values
+	case map[interface{}]interface{}:
+		values := make([]interface{}, 0, len(v)*2)
+
+		for k, e := range v {
+			values = append(values, goRedisValue(k), goRedisValue(e))
+		}
+
+		return values
+	}
+
+	return v
+}
@@ -0,0 +1,222 @@
+package yiigo
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// redisHashField the struct field mapped to a hash field
+type redisHashField struct {
+	name      string
+	index     int
+	omitEmpty bool
+}
+
+// redisHashFields returns the hash fields of struct by the `redis:"field"` tags, the field name is used without tag.
+func redisHashFields(t reflect.Type) []redisHashField {
+	fields := make([]redisHashField, 0, t.NumField())
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		// unexported
+		if f.PkgPath != "" {
+			continue
+		}
+
+		field := redisHashField{
+			name:  f.Name,
+			index: i,
+		}
+
+		if tag := f.Tag.Get("redis"); tag != "" {
+			if tag == "-" {
+				continue
+			}
+
+			opts := strings.Split(tag, ",")
+
+			if opts[0] != "" {
+				field.name = opts[0]
+			}
+
+			for _, v := range opts[1:] {
+				if v == "omitempty" {
+					field.omitEmpty = true
+				}
+			}
+		}
+
+		fields = append(fields, field)
+	}
+
+	return fields
+}
+
+// HSetStruct flattens the exported fields of a struct into HSET, the fields are named by the `redis:"field"` tags.
+// Supported field types: int, uint, float, bool, string, []byte and time.Time (stored as RFC3339Nano).
+func (r *RedisPoolResource) HSetStruct(ctx context.Context, key string, v interface{}) error {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("yiigo: HSetStruct expects a struct, got %T", v)
+	}
+
+	args := redis.Args{key}
+
+	for _, f := range redisHashFields(rv.Type()) {
+		fv := rv.Field(f.index)
+
+		if f.omitEmpty && fv.IsZero() {
+			continue
+		}
+
+		value, err := redisHashValue(fv)
+
+		if err != nil {
+			return errors.Wrapf(err, "yiigo: HSetStruct field %s", f.name)
+		}
+
+		args = append(args, f.name, value)
+	}
+
+	// nothing to set
+	if len(args) == 1 {
+		return nil
+	}
+
+	_, err := r.Do(ctx, "HSET", args...)
+
+	return err
+}
+
+// HGetAllScan scans the HGETALL reply into the struct pointed by dest, see HSetStruct for the field mapping.
+// The unknown hash fields are ignored and the missing fields are left at zero value, ErrRedisNil is returned when the key is missing.
+func (r *RedisPoolResource) HGetAllScan(ctx context.Context, key string, dest interface{}) error {
+	rv := reflect.ValueOf(dest)
+
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("yiigo: HGetAllScan expects a pointer to struct, got %T", dest)
+	}
+
+	m, err := redis.StringMap(r.Do(ctx, "HGETALL", key))
+
+	if err != nil {
+		return redisNilError(err)
+	}
+
+	if len(m) == 0 {
+		return ErrRedisNil
+	}
+
+	rv = rv.Elem()
+
+	for _, f := range redisHashFields(rv.Type()) {
+		s, ok := m[f.name]
+
+		if !ok {
+			continue
+		}
+
+		if err := setRedisHashValue(rv.Field(f.index), s); err != nil {
+			return errors.Wrapf(err, "yiigo: HGetAllScan field %s", f.name)
+		}
+	}
+
+	return nil
+}
+
+func redisHashValue(v reflect.Value) (interface{}, error) {
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).Format(time.RFC3339Nano), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Bytes(), nil
+		}
+	}
+
+	return nil, fmt.Errorf("unsupported type %s", v.Type())
+}
+
+func setRedisHashValue(v reflect.Value, s string) error {
+	if v.Type() == timeType {
+		t, err := time.Parse(time.RFC3339Nano, s)
+
+		if err != nil {
+			return err
+		}
+
+		v.Set(reflect.ValueOf(t))
+
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+
+		if err != nil {
+			return err
+		}
+
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+
+		if err != nil {
+			return err
+		}
+
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+
+		if err != nil {
+			return err
+		}
+
+		v.SetFloat(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+
+		if err != nil {
+			return err
+		}
+
+		v.SetBool(b)
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+
+		v.SetBytes([]byte(s))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package yiigo
+
+import (
+	"context"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// add the items and set the ttl when the key is created
+// KEYS[1] key, ARGV[1] ttl (ms, 0 means no ttl), ARGV[2:] items
+var hllAddScript = NewRedisScript(1, `local created = redis.call("EXISTS", KEYS[1]) == 0
+local changed = redis.call("PFADD", KEYS[1], unpack(ARGV, 2))
+
+if created and tonumber(ARGV[1]) > 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+
+return changed`)
+
+// merge the sources and set the ttl when the dest is created, the number of keys varies by call
+// KEYS[1] dest, KEYS[2:] sources, ARGV[1] ttl (ms, 0 means no ttl)
+const hllMergeScript = `local created = redis.call("EXISTS", KEYS[1]) == 0
+
+redis.call("PFMERGE", unpack(KEYS))
+
+if created and tonumber(ARGV[1]) > 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+
+return 1`
+
+// hllSetting hyperloglog setting
+type hllSetting struct {
+	ttl time.Duration
+}
+
+// HLLOption configures how we set up the hyperloglog counter
+type HLLOption interface {
+	apply(*hllSetting)
+}
+
+// funcHLLOption implements hyperloglog option
+type funcHLLOption struct {
+	f func(*hllSetting)
+}
+
+func (fo *funcHLLOption) apply(s *hllSetting) {
+	fo.f(s)
+}
+
+func newFuncHLLOption(f func(*hllSetting)) *funcHLLOption {
+	return &funcHLLOption{f: f}
+}
+
+// WithHLLTTL specifies the ttl of the keys, it's applied when a key is created by Add or Merge and not renewed later.
+func WithHLLTTL(ttl time.Duration) HLLOption {
+	return newFuncHLLOption(func(s *hllSetting) {
+		s.ttl = ttl
+	})
+}
+
+// RedisHLL hyperloglog counter (PFADD/PFCOUNT/PFMERGE), the keys are prefixed by WithRedisKeyPrefix.
+type RedisHLL struct {
+	pool    *RedisPoolResource
+	setting *hllSetting
+}
+
+// NewRedisHLL returns a new hyperloglog counter bound to the pool.
+func NewRedisHLL(pool *RedisPoolResource, options ...HLLOption) *RedisHLL {
+	setting := new(hllSetting)
+
+	for _, option := range options {
+		option.apply(setting)
+	}
+
+	return &RedisHLL{
+		pool:    pool,
+		setting: setting,
+	}
+}
+
+// Add adds the items to the counter, returns true if the estimated cardinality is changed.
+func (h *RedisHLL) Add(ctx context.Context, key string, items ...string) (bool, error) {
+	args := redis.Args{key, h.ttl()}.AddFlat(items)
+
+	return redis.Bool(hllAddScript.Do(ctx, h.pool, args...))
+}
+
+// Count returns the estimated cardinality of the union of the counters.
+func (h *RedisHLL) Count(ctx context.Context, keys ...string) (int64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	args := redis.Args{}.AddFlat(keys)
+
+	return redis.Int64(h.pool.do(ctx, "PFCOUNT", h.pool.prefixKeys(ctx, len(args), args)...))
+}
+
+// Merge merges the source counters into dest, dest is counted in the union if it exists.
+func (h *RedisHLL) Merge(ctx context.Context, dest string, sources ...string) error {
+	args := redis.Args{dest}.AddFlat(sources)
+
+	_, err := NewRedisScript(len(args), hllMergeScript).Do(ctx, h.pool, append(args, h.ttl())...)
+
+	return err
+}
+
+func (h *RedisHLL) ttl() int64 {
+	if h.setting.ttl <= 0 {
+		return 0
+	}
+
+	// at least 1ms, or it means no ttl
+	if ms := int64(h.setting.ttl / time.Millisecond); ms > 0 {
+		return ms
+	}
+
+	return 1
+}
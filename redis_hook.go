@@ -0,0 +1,34 @@
+package yiigo
+
+import (
+	"context"
+	"time"
+)
+
+// RedisHook instruments the redis commands, eg: tracing, metrics.
+// The commands of Pipeline are reported as a single "PIPELINE" command.
+type RedisHook interface {
+	// BeforeDo is invoked before the command is sent, the returned context is passed to AfterDo.
+	BeforeDo(ctx context.Context, cmd string, args []interface{}) context.Context
+
+	// AfterDo is invoked after the reply is received.
+	AfterDo(ctx context.Context, cmd string, err error, duration time.Duration)
+}
+
+type redisHooks []RedisHook
+
+func (hs redisHooks) before(ctx context.Context, cmd string, args []interface{}) context.Context {
+	for _, h := range hs {
+		ctx = h.BeforeDo(ctx, cmd, args)
+	}
+
+	return ctx
+}
+
+func (hs redisHooks) after(ctx context.Context, cmd string, start time.Time, err *error) {
+	d := time.Since(start)
+
+	for _, h := range hs {
+		h.AfterDo(ctx, cmd, *err, d)
+	}
+}
@@ -0,0 +1,89 @@
+package yiigo
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// redisLeakStackDepth the max frames recorded at Get
+const redisLeakStackDepth = 32
+
+// redisLease a checkout of connection, warns when it is not returned within the leak threshold.
+type redisLease struct {
+	pcs      []uintptr
+	released int32
+	timer    *time.Timer
+}
+
+// newLease records the caller of Get, the frames are resolved only when the warning fires.
+func (r *RedisPoolResource) newLease() *redisLease {
+	pcs := make([]uintptr, redisLeakStackDepth)
+
+	// skip runtime.Callers, newLease and borrow, the frames of Get are skipped by stack
+	n := runtime.Callers(3, pcs)
+
+	l := &redisLease{pcs: pcs[:n]}
+
+	start := time.Now()
+
+	l.timer = time.AfterFunc(r.setting.leakThreshold, func() {
+		if atomic.LoadInt32(&l.released) == 1 {
+			return
+		}
+
+		logger().Warn("yiigo: redis connection leaked",
+			zap.String("name", r.name),
+			zap.Duration("held", time.Since(start)),
+			zap.String("stack", l.stack()),
+		)
+	})
+
+	return l
+}
+
+func (l *redisLease) release() {
+	if atomic.CompareAndSwapInt32(&l.released, 0, 1) {
+		l.timer.Stop()
+	}
+}
+
+func (l *redisLease) stack() string {
+	var b strings.Builder
+
+	frames := runtime.CallersFrames(l.pcs)
+
+	skip := true
+
+	for {
+		f, more := frames.Next()
+
+		// Get calls GetContext
+		if skip && (strings.HasSuffix(f.Function, ".(*RedisPoolResource).Get") || strings.HasSuffix(f.Function, ".(*RedisPoolResource).GetContext")) {
+			if !more {
+				break
+			}
+
+			continue
+		}
+
+		skip = false
+
+		b.WriteString(f.Function)
+		b.WriteString("\n\t")
+		b.WriteString(f.File)
+		b.WriteString(":")
+		b.WriteString(strconv.Itoa(f.Line))
+		b.WriteString("\n")
+
+		if !more {
+			break
+		}
+	}
+
+	return b.String()
+}
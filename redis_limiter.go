@@ -0,0 +1,191 @@
+package yiigo
+
+import (
+	"context"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+)
+
+// GCRA (generic cell rate algorithm), a token bucket without refilling timer.
+// KEYS[1] key, ARGV[1] rate, ARGV[2] period (ms), ARGV[3] n
+// returns {allowed, remaining, retry_after (ms)}
+var limiterTokenBucketScript = NewRedisScript(1, `redis.replicate_commands()
+
+local rate = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+
+local t = redis.call("TIME")
+local now = t[1] * 1000 + math.floor(t[2] / 1000)
+
+local emission = period / rate
+local tat = tonumber(redis.call("GET", KEYS[1])) or now
+
+if tat < now then
+	tat = now
+end
+
+if n > rate then
+	return {0, math.floor((now - (tat - period)) / emission), -1}
+end
+
+local new_tat = tat + n * emission
+local diff = now - (new_tat - period)
+
+if diff < 0 then
+	return {0, math.floor((now - (tat - period)) / emission), math.ceil(-diff)}
+end
+
+redis.call("SET", KEYS[1], new_tat, "PX", math.ceil(new_tat - now))
+
+return {1, math.floor(diff / emission), 0}`)
+
+// sliding window log, every request is a member of the sorted set scored by time.
+// KEYS[1] key, ARGV[1] rate, ARGV[2] period (ms), ARGV[3] n, ARGV[4] unique token
+// returns {allowed, remaining, retry_after (ms)}
+var limiterSlidingWindowScript = NewRedisScript(1, `redis.replicate_commands()
+
+local rate = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+
+local t = redis.call("TIME")
+local now = t[1] * 1000 + math.floor(t[2] / 1000)
+
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - period)
+
+local count = redis.call("ZCARD", KEYS[1])
+
+if n > rate then
+	return {0, rate - count, -1}
+end
+
+if count + n > rate then
+	local oldest = redis.call("ZRANGE", KEYS[1], count + n - rate - 1, count + n - rate - 1, "WITHSCORES")
+
+	return {0, rate - count, math.max(tonumber(oldest[2]) + period - now, 1)}
+end
+
+for i = 1, n do
+	redis.call("ZADD", KEYS[1], now, ARGV[4] .. ":" .. i)
+end
+
+redis.call("PEXPIRE", KEYS[1], period)
+
+return {1, rate - count - n, 0}`)
+
+// limiterSetting limiter setting
+type limiterSetting struct {
+	slidingWindow bool
+}
+
+// LimiterOption configures how we set up the limiter
+type LimiterOption interface {
+	apply(*limiterSetting)
+}
+
+// funcLimiterOption implements limiter option
+type funcLimiterOption struct {
+	f func(*limiterSetting)
+}
+
+func (fo *funcLimiterOption) apply(s *limiterSetting) {
+	fo.f(s)
+}
+
+func newFuncLimiterOption(f func(*limiterSetting)) *funcLimiterOption {
+	return &funcLimiterOption{f: f}
+}
+
+// WithLimiterSlidingWindow specifies to use the sliding window log instead of token bucket, for strict limits.
+// It costs a sorted set member per request.
+func WithLimiterSlidingWindow() LimiterOption {
+	return newFuncLimiterOption(func(s *limiterSetting) {
+		s.slidingWindow = true
+	})
+}
+
+// RedisLimitResult the result of limiter
+type RedisLimitResult struct {
+	// Allowed reports whether the requests are allowed
+	Allowed bool
+	// Remaining the remaining quota
+	Remaining int
+	// RetryAfter the duration to wait before retrying when not allowed, -1 means never (n exceeds the rate)
+	RetryAfter time.Duration
+}
+
+// RedisLimiter redis rate limiter, allows rate requests per period across instances.
+type RedisLimiter struct {
+	pool    RedisPool
+	key     string
+	rate    int
+	per     time.Duration
+	setting *limiterSetting
+}
+
+// NewRedisLimiter returns a new rate limiter which allows rate requests per period, token bucket is used by default.
+func NewRedisLimiter(pool RedisPool, key string, rate int, per time.Duration, options ...LimiterOption) *RedisLimiter {
+	setting := new(limiterSetting)
+
+	for _, option := range options {
+		option.apply(setting)
+	}
+
+	return &RedisLimiter{
+		pool:    pool,
+		key:     key,
+		rate:    rate,
+		per:     per,
+		setting: setting,
+	}
+}
+
+// Allow reports whether a request is allowed.
+func (l *RedisLimiter) Allow(ctx context.Context) (*RedisLimitResult, error) {
+	return l.AllowN(ctx, 1)
+}
+
+// AllowN reports whether n requests are allowed at once.
+func (l *RedisLimiter) AllowN(ctx context.Context, n int) (*RedisLimitResult, error) {
+	var (
+		reply []int64
+		err   error
+	)
+
+	period := int64(l.per / time.Millisecond)
+
+	if l.setting.slidingWindow {
+		token, terr := mutexToken()
+
+		if terr != nil {
+			return nil, terr
+		}
+
+		reply, err = redis.Int64s(limiterSlidingWindowScript.Do(ctx, l.pool, l.key, l.rate, period, n, token))
+	} else {
+		reply, err = redis.Int64s(limiterTokenBucketScript.Do(ctx, l.pool, l.key, l.rate, period, n))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(reply) != 3 {
+		return nil, errors.New("yiigo: invalid redis limiter reply")
+	}
+
+	result := &RedisLimitResult{
+		Allowed:    reply[0] == 1,
+		Remaining:  int(reply[1]),
+		RetryAfter: time.Duration(reply[2]) * time.Millisecond,
+	}
+
+	if reply[2] < 0 {
+		result.RetryAfter = -1
+	}
+
+	return result, nil
+}
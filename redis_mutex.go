@@ -0,0 +1,225 @@
+package yiigo
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrMutexNotAcquired returned by Lock when the lock is held by others.
+	ErrMutexNotAcquired = errors.New("yiigo: mutex not acquired")
+
+	// ErrMutexNotHeld returned by Unlock when the lock is expired or held by others.
+	ErrMutexNotHeld = errors.New("yiigo: mutex not held")
+)
+
+// delete the key only when the token matches
+var mutexUnlockScript = NewRedisScript(1, `if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+else
+	return 0
+end`)
+
+// extend the ttl only when the token matches
+var mutexRenewScript = NewRedisScript(1, `if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+else
+	return 0
+end`)
+
+// mutexSetting mutex setting
+type mutexSetting struct {
+	ttl           time.Duration
+	retryInterval time.Duration
+	watchdog      time.Duration
+}
+
+// MutexOption configures how we set up the mutex
+type MutexOption interface {
+	apply(*mutexSetting)
+}
+
+// funcMutexOption implements mutex option
+type funcMutexOption struct {
+	f func(*mutexSetting)
+}
+
+func (fo *funcMutexOption) apply(s *mutexSetting) {
+	fo.f(s)
+}
+
+func newFuncMutexOption(f func(*mutexSetting)) *funcMutexOption {
+	return &funcMutexOption{f: f}
+}
+
+// WithMutexTTL specifies the expiration of the lock, default is 10s.
+func WithMutexTTL(d time.Duration) MutexOption {
+	return newFuncMutexOption(func(s *mutexSetting) {
+		s.ttl = d
+	})
+}
+
+// WithMutexRetryInterval specifies Lock to block and retry with the interval until ctx expires.
+func WithMutexRetryInterval(d time.Duration) MutexOption {
+	return newFuncMutexOption(func(s *mutexSetting) {
+		s.retryInterval = d
+	})
+}
+
+// WithMutexWatchdog specifies to extend the ttl with the interval while the lock is held,
+// until Unlock is called or the ctx of Lock is cancelled. The interval should be shorter than the ttl.
+func WithMutexWatchdog(interval time.Duration) MutexOption {
+	return newFuncMutexOption(func(s *mutexSetting) {
+		s.watchdog = interval
+	})
+}
+
+// RedisMutex redis distributed mutex, a RedisMutex should not be shared by goroutines.
+type RedisMutex struct {
+	pool    RedisPool
+	key     string
+	token   string
+	setting *mutexSetting
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// NewRedisMutex returns a new redis mutex.
+func NewRedisMutex(pool RedisPool, key string, options ...MutexOption) *RedisMutex {
+	setting := &mutexSetting{
+		ttl: 10 * time.Second,
+	}
+
+	for _, option := range options {
+		option.apply(setting)
+	}
+
+	return &RedisMutex{
+		pool:    pool,
+		key:     key,
+		setting: setting,
+	}
+}
+
+// Lock acquires the lock with SET NX PX, ErrMutexNotAcquired is returned when the lock is held by others.
+// With WithMutexRetryInterval, it blocks and retries until ctx expires.
+func (m *RedisMutex) Lock(ctx context.Context) error {
+	token, err := mutexToken()
+
+	if err != nil {
+		return err
+	}
+
+	key := redisPrefixKeys(ctx, m.pool, 1, []interface{}{m.key})[0]
+
+	for {
+		_, err := redis.String(redisDo(ctx, m.pool, "SET", key, token, "NX", "PX", int64(m.setting.ttl/time.Millisecond)))
+
+		if err == nil {
+			m.token = token
+
+			if m.setting.watchdog > 0 {
+				m.stop = make(chan struct{})
+				m.stopped = make(chan struct{})
+
+				go m.renew(ctx, token, m.stop, m.stopped)
+			}
+
+			return nil
+		}
+
+		if err != redis.ErrNil {
+			return err
+		}
+
+		if m.setting.retryInterval <= 0 {
+			return ErrMutexNotAcquired
+		}
+
+		timer := time.NewTimer(m.setting.retryInterval)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Unlock releases the lock only when it is held by this mutex, ErrMutexNotHeld is returned otherwise.
+func (m *RedisMutex) Unlock(ctx context.Context) error {
+	if m.token == "" {
+		return ErrMutexNotHeld
+	}
+
+	// stop renewing before deleting, otherwise the lock may be resurrected
+	if m.stop != nil {
+		close(m.stop)
+		<-m.stopped
+
+		m.stop, m.stopped = nil, nil
+	}
+
+	n, err := redis.Int(mutexUnlockScript.Do(ctx, m.pool, m.key, m.token))
+
+	if err != nil {
+		return err
+	}
+
+	m.token = ""
+
+	if n == 0 {
+		return ErrMutexNotHeld
+	}
+
+	return nil
+}
+
+// renew extends the ttl periodically until stopped, ctx is cancelled or the lock is lost.
+func (m *RedisMutex) renew(ctx context.Context, token string, stop <-chan struct{}, stopped chan<- struct{}) {
+	defer close(stopped)
+
+	ticker := time.NewTicker(m.setting.watchdog)
+
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := redis.Int(mutexRenewScript.Do(ctx, m.pool, m.key, token, int64(m.setting.ttl/time.Millisecond)))
+
+			if err != nil {
+				logThrottled(ctx, zap.WarnLevel, "yiigo: redis mutex renew error", zap.String("key", m.key), zap.Error(err))
+
+				continue
+			}
+
+			// expired or held by others
+			if n == 0 {
+				return
+			}
+		}
+	}
+}
+
+func mutexToken() (string, error) {
+	b := make([]byte, 16)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
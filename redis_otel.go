@@ -0,0 +1,53 @@
+//go:build otel
+// +build otel
+
+package yiigo
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// redisOTelHook traces the redis commands with OpenTelemetry
+type redisOTelHook struct {
+	name   string
+	tracer trace.Tracer
+}
+
+// NewRedisOTelHook returns a hook which creates a client span for every redis command, requires the build tag `otel`.
+// The name is the pool name recorded in the span attributes.
+func NewRedisOTelHook(name string) RedisHook {
+	return &redisOTelHook{
+		name:   name,
+		tracer: otel.Tracer("github.com/shenghui0779/yiigo"),
+	}
+}
+
+func (h *redisOTelHook) BeforeDo(ctx context.Context, cmd string, args []interface{}) context.Context {
+	ctx, _ = h.tracer.Start(ctx, "redis "+cmd,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "redis"),
+			attribute.String("db.operation", cmd),
+			attribute.String("yiigo.redis.pool", h.name),
+		),
+	)
+
+	return ctx
+}
+
+func (h *redisOTelHook) AfterDo(ctx context.Context, cmd string, err error, duration time.Duration) {
+	span := trace.SpanFromContext(ctx)
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
@@ -0,0 +1,61 @@
+//go:build prometheus
+// +build prometheus
+
+package yiigo
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	redisCapacityDesc   = prometheus.NewDesc("yiigo_redis_pool_capacity", "The capacity of the redis pool.", []string{"name"}, nil)
+	redisAvailableDesc  = prometheus.NewDesc("yiigo_redis_pool_available", "The number of available connections.", []string{"name"}, nil)
+	redisActiveDesc     = prometheus.NewDesc("yiigo_redis_pool_active", "The number of opened connections.", []string{"name"}, nil)
+	redisInUseDesc      = prometheus.NewDesc("yiigo_redis_pool_in_use", "The number of connections in use.", []string{"name"}, nil)
+	redisWaitersDesc    = prometheus.NewDesc("yiigo_redis_pool_waiters", "The number of callers waiting for a connection.", []string{"name"}, nil)
+	redisWaitCountDesc  = prometheus.NewDesc("yiigo_redis_pool_wait_count_total", "The total number of waits for a connection.", []string{"name"}, nil)
+	redisWaitTimeDesc   = prometheus.NewDesc("yiigo_redis_pool_wait_seconds_total", "The total time waited for a connection.", []string{"name"}, nil)
+	redisDialErrorsDesc = prometheus.NewDesc("yiigo_redis_pool_dial_errors_total", "The total number of dial errors.", []string{"name"}, nil)
+	redisReconnectsDesc = prometheus.NewDesc("yiigo_redis_pool_reconnects_total", "The total number of reconnects of broken connections.", []string{"name"}, nil)
+	redisExpiredDesc    = prometheus.NewDesc("yiigo_redis_pool_expired_total", "The total number of connections replaced by max lifetime.", []string{"name"}, nil)
+)
+
+type redisCollector struct{}
+
+// RedisCollector returns a prometheus collector for all the registered redis pools, requires the build tag `prometheus`.
+func RedisCollector() prometheus.Collector {
+	return redisCollector{}
+}
+
+func (redisCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- redisCapacityDesc
+	ch <- redisAvailableDesc
+	ch <- redisActiveDesc
+	ch <- redisInUseDesc
+	ch <- redisWaitersDesc
+	ch <- redisWaitCountDesc
+	ch <- redisWaitTimeDesc
+	ch <- redisDialErrorsDesc
+	ch <- redisReconnectsDesc
+	ch <- redisExpiredDesc
+}
+
+func (redisCollector) Collect(ch chan<- prometheus.Metric) {
+	redisMap.Range(func(key, value interface{}) bool {
+		name := key.(string)
+		stats := value.(*RedisPoolResource).Stats()
+
+		ch <- prometheus.MustNewConstMetric(redisCapacityDesc, prometheus.GaugeValue, float64(stats.Capacity), name)
+		ch <- prometheus.MustNewConstMetric(redisAvailableDesc, prometheus.GaugeValue, float64(stats.Available), name)
+		ch <- prometheus.MustNewConstMetric(redisActiveDesc, prometheus.GaugeValue, float64(stats.Active), name)
+		ch <- prometheus.MustNewConstMetric(redisInUseDesc, prometheus.GaugeValue, float64(stats.InUse), name)
+		ch <- prometheus.MustNewConstMetric(redisWaitersDesc, prometheus.GaugeValue, float64(stats.Waiters), name)
+		ch <- prometheus.MustNewConstMetric(redisWaitCountDesc, prometheus.CounterValue, float64(stats.WaitCount), name)
+		ch <- prometheus.MustNewConstMetric(redisWaitTimeDesc, prometheus.CounterValue, stats.WaitTime.Seconds(), name)
+		ch <- prometheus.MustNewConstMetric(redisDialErrorsDesc, prometheus.CounterValue, float64(stats.DialErrors), name)
+		ch <- prometheus.MustNewConstMetric(redisReconnectsDesc, prometheus.CounterValue, float64(stats.Reconnects), name)
+		ch <- prometheus.MustNewConstMetric(redisExpiredDesc, prometheus.CounterValue, float64(stats.Expired), name)
+
+		return true
+	})
+}
@@ -0,0 +1,63 @@
+//go:build prometheus
+// +build prometheus
+
+package yiigo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisCollector(t *testing.T) {
+	server := newTestRedisServer(t, nil, nil)
+
+	defer server.Close()
+
+	RegisterRedis("collector", server.Addr(), WithRedisPool(WithPoolSize(1), WithPoolLimit(1)))
+
+	conn, err := Redis("collector").Get()
+
+	assert.Nil(t, err)
+
+	waited := make(chan RedisConn)
+
+	go func() {
+		c, _ := Redis("collector").Get()
+
+		waited <- c
+	}()
+
+	for i := 0; i < 100 && Redis("collector").Stats().Waiters == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	registry := prometheus.NewPedanticRegistry()
+
+	assert.Nil(t, registry.Register(RedisCollector()))
+
+	families, err := registry.Gather()
+
+	assert.Nil(t, err)
+
+	gauges := make(map[string]float64)
+
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if label.GetName() == "name" && label.GetValue() == "collector" && m.GetGauge() != nil {
+					gauges[family.GetName()] = m.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+
+	assert.Equal(t, float64(1), gauges["yiigo_redis_pool_capacity"])
+	assert.Equal(t, float64(1), gauges["yiigo_redis_pool_in_use"])
+	assert.Equal(t, float64(1), gauges["yiigo_redis_pool_waiters"])
+
+	Redis("collector").Put(conn)
+	Redis("collector").Put(<-waited)
+}
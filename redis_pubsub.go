@@ -0,0 +1,433 @@
+package yiigo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"go.uber.org/zap"
+)
+
+var (
+	redisPubSubPingInterval = 30 * time.Second
+	redisPubSubMinBackoff   = 100 * time.Millisecond
+	redisPubSubMaxBackoff   = 10 * time.Second
+	redisPubSubWorkers      = 16
+)
+
+// errRedisPongTimeout the subscriber connection is considered dead
+var errRedisPongTimeout = errors.New("yiigo: redis subscriber pong timeout")
+
+// subscribeSetting subscriber setting
+type subscribeSetting struct {
+	pingInterval time.Duration
+}
+
+// SubscribeOption configures how we set up the subscriber
+type SubscribeOption interface {
+	apply(*subscribeSetting)
+}
+
+// funcSubscribeOption implements subscribe option
+type funcSubscribeOption struct {
+	f func(*subscribeSetting)
+}
+
+func (fo *funcSubscribeOption) apply(s *subscribeSetting) {
+	fo.f(s)
+}
+
+func newFuncSubscribeOption(f func(*subscribeSetting)) *funcSubscribeOption {
+	return &funcSubscribeOption{f: f}
+}
+
+// WithSubscribePingInterval specifies how often the subscriber PINGs the connection, default is 30s.
+// Keep it below the idle timeout of the network (eg: load balancers, NAT) to keep the connection alive.
+// The connection is considered dead and resubscribed when the PONG is not received within the read timeout of pool.
+func WithSubscribePingInterval(d time.Duration) SubscribeOption {
+	return newFuncSubscribeOption(func(s *subscribeSetting) {
+		s.pingInterval = d
+	})
+}
+
+// RedisSubscriber redis subscriber, owns a dedicated connection and resubscribes automatically when the connection drops.
+type RedisSubscriber struct {
+	// int64 first for the 64-bit alignment of atomic operations
+	lastPing    int64
+	lastMessage int64
+
+	pool     *RedisPoolResource
+	setting  *subscribeSetting
+	channels map[string]func(channel string, data []byte)
+	patterns map[string]func(channel string, data []byte)
+	psc      *redis.PubSubConn
+	workers  chan struct{}
+	errs     chan error
+	mutex    sync.Mutex
+}
+
+// Subscribe subscribes the channels with a dedicated connection, the messages are dispatched to the handler in order.
+// The subscriber stops when ctx is cancelled or a permanent failure (eg: ACL denied) occurs.
+func (r *RedisPoolResource) Subscribe(ctx context.Context, channels []string, handler func(channel string, data []byte), options ...SubscribeOption) *RedisSubscriber {
+	s := newRedisSubscriber(r, nil, options)
+
+	for _, v := range channels {
+		s.channels[v] = handler
+	}
+
+	go s.run(ctx)
+
+	return s
+}
+
+// SubscribeRoutes subscribes the exact channels and the PSUBSCRIBE patterns with a dedicated connection,
+// the messages are dispatched to the matching handlers on a bounded worker pool.
+// The panics of handlers are recovered and logged, see Subscribe for the lifecycle.
+func (r *RedisPoolResource) SubscribeRoutes(ctx context.Context, channels map[string]func(data []byte), patterns map[string]func(channel string, data []byte), options ...SubscribeOption) *RedisSubscriber {
+	s := newRedisSubscriber(r, make(chan struct{}, redisPubSubWorkers), options)
+
+	for k, v := range channels {
+		s.channels[k] = redisChannelHandler(v)
+	}
+
+	for k, v := range patterns {
+		s.patterns[k] = v
+	}
+
+	go s.run(ctx)
+
+	return s
+}
+
+func newRedisSubscriber(pool *RedisPoolResource, workers chan struct{}, options []SubscribeOption) *RedisSubscriber {
+	setting := &subscribeSetting{
+		pingInterval: redisPubSubPingInterval,
+	}
+
+	for _, option := range options {
+		option.apply(setting)
+	}
+
+	return &RedisSubscriber{
+		pool:     pool,
+		setting:  setting,
+		channels: make(map[string]func(channel string, data []byte)),
+		patterns: make(map[string]func(channel string, data []byte)),
+		workers:  workers,
+		errs:     make(chan error, 1),
+	}
+}
+
+func redisChannelHandler(handler func(data []byte)) func(channel string, data []byte) {
+	return func(channel string, data []byte) {
+		handler(data)
+	}
+}
+
+// Errors returns a channel which receives the permanent failure, it is closed when the subscriber stops.
+func (s *RedisSubscriber) Errors() <-chan error {
+	return s.errs
+}
+
+// LastPing returns the time when the last PONG is received, zero if none yet.
+// It is updated once per ping interval for a live connection, which helps to build the liveness probes.
+func (s *RedisSubscriber) LastPing() time.Time {
+	return unixNanoTime(atomic.LoadInt64(&s.lastPing))
+}
+
+// LastMessage returns the time when the last message is received, zero if none yet.
+func (s *RedisSubscriber) LastMessage() time.Time {
+	return unixNanoTime(atomic.LoadInt64(&s.lastMessage))
+}
+
+func unixNanoTime(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, n)
+}
+
+// AddChannel subscribes a channel at runtime without tearing down the connection.
+func (s *RedisSubscriber) AddChannel(channel string, handler func(data []byte)) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.channels[channel] = redisChannelHandler(handler)
+
+	if s.psc == nil {
+		// subscribed when connected
+		return nil
+	}
+
+	return s.psc.Subscribe(channel)
+}
+
+// RemoveChannel unsubscribes a channel at runtime without tearing down the connection.
+func (s *RedisSubscriber) RemoveChannel(channel string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.channels, channel)
+
+	if s.psc == nil {
+		return nil
+	}
+
+	return s.psc.Unsubscribe(channel)
+}
+
+// AddPattern subscribes a pattern at runtime without tearing down the connection.
+func (s *RedisSubscriber) AddPattern(pattern string, handler func(channel string, data []byte)) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.patterns[pattern] = handler
+
+	if s.psc == nil {
+		return nil
+	}
+
+	return s.psc.PSubscribe(pattern)
+}
+
+// RemovePattern unsubscribes a pattern at runtime without tearing down the connection.
+func (s *RedisSubscriber) RemovePattern(pattern string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.patterns, pattern)
+
+	if s.psc == nil {
+		return nil
+	}
+
+	return s.psc.PUnsubscribe(pattern)
+}
+
+func (s *RedisSubscriber) run(ctx context.Context) {
+	defer close(s.errs)
+
+	backoff := redisPubSubMinBackoff
+
+	for {
+		subscribed, err := s.serve(ctx)
+
+		if err == nil {
+			return
+		}
+
+		if _, ok := err.(redis.Error); ok {
+			s.errs <- err
+
+			return
+		}
+
+		logThrottled(ctx, zap.ErrorLevel, "yiigo: redis subscriber error", zap.Error(err))
+
+		if subscribed {
+			backoff = redisPubSubMinBackoff
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		if backoff *= 2; backoff > redisPubSubMaxBackoff {
+			backoff = redisPubSubMaxBackoff
+		}
+	}
+}
+
+// subscribe subscribes the channels and patterns with the connection, the runtime changes go to the connection since then.
+func (s *RedisSubscriber) subscribe(psc *redis.PubSubConn) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	channels := make([]interface{}, 0, len(s.channels))
+
+	for k := range s.channels {
+		channels = append(channels, k)
+	}
+
+	patterns := make([]interface{}, 0, len(s.patterns))
+
+	for k := range s.patterns {
+		patterns = append(patterns, k)
+	}
+
+	if len(channels) != 0 {
+		if err := psc.Subscribe(channels...); err != nil {
+			return err
+		}
+	}
+
+	if len(patterns) != 0 {
+		if err := psc.PSubscribe(patterns...); err != nil {
+			return err
+		}
+	}
+
+	s.psc = psc
+
+	return nil
+}
+
+func (s *RedisSubscriber) unsubscribe() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.psc = nil
+}
+
+// serve subscribes with a new connection and dispatches the messages until ctx is cancelled (returns nil) or the connection fails.
+// The connection is PINGed every ping interval, it fails when the PONG is not received within the read timeout.
+// Note: the ordered handlers of Subscribe run on the receiving goroutine, a handler slower than the read timeout delays the PONG.
+func (s *RedisSubscriber) serve(ctx context.Context) (bool, error) {
+	conn, err := s.pool.dial(ctx)
+
+	if err != nil {
+		return false, err
+	}
+
+	psc := &redis.PubSubConn{Conn: conn}
+
+	defer psc.Close()
+
+	if err := s.subscribe(psc); err != nil {
+		return false, err
+	}
+
+	defer s.unsubscribe()
+
+	pongTimeout := s.pool.setting.readTimeout
+
+	if pongTimeout <= 0 {
+		pongTimeout = s.setting.pingInterval
+	}
+
+	errc := make(chan error, 1)
+	pongc := make(chan struct{}, 1)
+
+	go func() {
+		for {
+			// backstop in case the PINGs are blocked
+			switch v := psc.ReceiveWithTimeout(s.setting.pingInterval + pongTimeout).(type) {
+			case redis.Message:
+				atomic.StoreInt64(&s.lastMessage, time.Now().UnixNano())
+
+				s.dispatch(v)
+			case redis.Pong:
+				atomic.StoreInt64(&s.lastPing, time.Now().UnixNano())
+
+				select {
+				case pongc <- struct{}{}:
+				default:
+				}
+			case error:
+				errc <- v
+
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(s.setting.pingInterval)
+
+	defer ticker.Stop()
+
+	// not nil while waiting for the PONG
+	var pong *time.Timer
+
+	defer func() {
+		if pong != nil {
+			pong.Stop()
+		}
+	}()
+
+	for {
+		var pongDeadline <-chan time.Time
+
+		if pong != nil {
+			pongDeadline = pong.C
+		}
+
+		select {
+		case <-ctx.Done():
+			s.mutex.Lock()
+			psc.Unsubscribe()
+			psc.PUnsubscribe()
+			s.mutex.Unlock()
+
+			return true, nil
+		case err := <-errc:
+			return true, err
+		case <-pongc:
+			if pong != nil {
+				pong.Stop()
+				pong = nil
+			}
+		case <-pongDeadline:
+			return true, errRedisPongTimeout
+		case <-ticker.C:
+			// the previous PING is outstanding
+			if pong != nil {
+				continue
+			}
+
+			s.mutex.Lock()
+			err := psc.Ping("")
+			s.mutex.Unlock()
+
+			if err != nil {
+				return true, err
+			}
+
+			pong = time.NewTimer(pongTimeout)
+		}
+	}
+}
+
+// dispatch runs the handler of message in order, or on the worker pool for the routes.
+func (s *RedisSubscriber) dispatch(msg redis.Message) {
+	s.mutex.Lock()
+
+	handler := s.channels[msg.Channel]
+
+	if msg.Pattern != "" {
+		handler = s.patterns[msg.Pattern]
+	}
+
+	s.mutex.Unlock()
+
+	// unsubscribed meanwhile
+	if handler == nil {
+		return
+	}
+
+	if s.workers == nil {
+		handler(msg.Channel, msg.Data)
+
+		return
+	}
+
+	s.workers <- struct{}{}
+
+	go func() {
+		defer func() {
+			<-s.workers
+
+			if err := recover(); err != nil {
+				logger().Error("yiigo: redis subscriber handler panic", zap.String("channel", msg.Channel), zap.Error(fmt.Errorf("%v", err)), zap.Stack("stack"))
+			}
+		}()
+
+		handler(msg.Channel, msg.Data)
+	}()
+}
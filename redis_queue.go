@@ -0,0 +1,262 @@
+package yiigo
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"go.uber.org/zap"
+)
+
+// move the entries of processing list back to the queue
+// KEYS[1] processing list, KEYS[2] queue
+var queueRestoreScript = NewRedisScript(2, `local n = 0
+
+while redis.call("RPOPLPUSH", KEYS[1], KEYS[2]) do
+	n = n + 1
+end
+
+return n`)
+
+// requeue the entries of the consumers without heartbeat since the deadline
+// KEYS[1] consumers (sorted set scored by heartbeat), KEYS[2] queue, ARGV[1] deadline (ms)
+var queueReapScript = NewRedisScript(2, `local n = 0
+
+for _, c in ipairs(redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1])) do
+	local processing = KEYS[2] .. ":processing:" .. c
+
+	while redis.call("RPOPLPUSH", processing, KEYS[2]) do
+		n = n + 1
+	end
+
+	redis.call("ZREM", KEYS[1], c)
+end
+
+return n`)
+
+// move the failed entry from processing list to the tail of queue
+// KEYS[1] processing list, KEYS[2] queue, ARGV[1] payload
+var queueRetryScript = NewRedisScript(2, `if redis.call("LREM", KEYS[1], 1, ARGV[1]) == 1 then
+	redis.call("LPUSH", KEYS[2], ARGV[1])
+end
+
+return 1`)
+
+// queueSetting queue consumer setting
+type queueSetting struct {
+	consumer          string
+	visibilityTimeout time.Duration
+	block             time.Duration
+}
+
+// QueueOption configures how we set up the queue consumer
+type QueueOption interface {
+	apply(*queueSetting)
+}
+
+// funcQueueOption implements queue option
+type funcQueueOption struct {
+	f func(*queueSetting)
+}
+
+func (fo *funcQueueOption) apply(s *queueSetting) {
+	fo.f(s)
+}
+
+func newFuncQueueOption(f func(*queueSetting)) *funcQueueOption {
+	return &funcQueueOption{f: f}
+}
+
+// WithQueueConsumer specifies the consumer name which owns the processing list, default is a random token.
+// A stable name (eg: hostname) restores the jobs left by the previous process immediately.
+func WithQueueConsumer(name string) QueueOption {
+	return newFuncQueueOption(func(s *queueSetting) {
+		s.consumer = name
+	})
+}
+
+// WithQueueVisibilityTimeout specifies how long the jobs of a consumer without heartbeat are requeued, default is 5min.
+func WithQueueVisibilityTimeout(d time.Duration) QueueOption {
+	return newFuncQueueOption(func(s *queueSetting) {
+		s.visibilityTimeout = d
+	})
+}
+
+// WithQueueBlock specifies the timeout of BRPOPLPUSH, default is 5s (rounded up to seconds).
+func WithQueueBlock(d time.Duration) QueueOption {
+	return newFuncQueueOption(func(s *queueSetting) {
+		s.block = d
+	})
+}
+
+// RedisQueue reliable job queue on redis list, the jobs are moved to the processing list of consumer until handled.
+type RedisQueue struct {
+	pool *RedisPoolResource
+	name string
+}
+
+// NewRedisQueue returns a new job queue, the name is prefixed by WithRedisKeyPrefix.
+func NewRedisQueue(pool *RedisPoolResource, name string) *RedisQueue {
+	return &RedisQueue{
+		pool: pool,
+		name: name,
+	}
+}
+
+// Push adds a job to the queue.
+func (q *RedisQueue) Push(ctx context.Context, payload []byte) error {
+	_, err := q.pool.Do(ctx, "LPUSH", q.name, payload)
+
+	return err
+}
+
+// Depth returns the number of jobs waiting in the queue.
+func (q *RedisQueue) Depth(ctx context.Context) (int64, error) {
+	return redis.Int64(q.pool.Do(ctx, "LLEN", q.name))
+}
+
+// Consume dispatches the jobs to the handler until ctx is cancelled, the in-flight job is finished before returning.
+// The job is removed when the handler returns nil, otherwise it is moved to the tail of queue for retrying.
+// The jobs of the consumers without heartbeat longer than the visibility timeout are requeued.
+func (q *RedisQueue) Consume(ctx context.Context, handler func(payload []byte) error, options ...QueueOption) error {
+	setting := &queueSetting{
+		visibilityTimeout: 5 * time.Minute,
+		block:             5 * time.Second,
+	}
+
+	for _, option := range options {
+		option.apply(setting)
+	}
+
+	if setting.consumer == "" {
+		token, err := mutexToken()
+
+		if err != nil {
+			return err
+		}
+
+		setting.consumer = token
+	}
+
+	processing := q.name + ":processing:" + setting.consumer
+	consumers := q.name + ":consumers"
+
+	// the jobs left by the previous process with the same consumer name
+	if _, err := queueRestoreScript.Do(ctx, q.pool, processing, q.name); err != nil {
+		return err
+	}
+
+	if err := q.heartbeat(ctx, consumers, setting.consumer); err != nil {
+		return err
+	}
+
+	// keep the heartbeat while the handler is running, until the in-flight job is finished
+	stop := make(chan struct{})
+
+	defer close(stop)
+
+	go func() {
+		ticker := time.NewTicker(setting.visibilityTimeout / 3)
+
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := q.heartbeat(context.Background(), consumers, setting.consumer); err != nil {
+					logThrottled(ctx, zap.ErrorLevel, "yiigo: redis queue heartbeat error", zap.String("queue", q.name), zap.Error(err))
+				}
+
+				deadline := time.Now().Add(-setting.visibilityTimeout).UnixNano() / int64(time.Millisecond)
+
+				if _, err := queueReapScript.Do(context.Background(), q.pool, consumers, q.name, deadline); err != nil {
+					logThrottled(ctx, zap.ErrorLevel, "yiigo: redis queue reap error", zap.String("queue", q.name), zap.Error(err))
+				}
+			}
+		}
+	}()
+
+	keys := q.pool.prefixKeys(ctx, 2, []interface{}{q.name, processing})
+	block := int64(math.Ceil(setting.block.Seconds()))
+
+	if block < 1 {
+		block = 1
+	}
+
+	backoff := redisPubSubMinBackoff
+
+	for ctx.Err() == nil {
+		payload, err := q.pop(ctx, keys, block)
+
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+
+			if err == ErrRedisClosed {
+				return err
+			}
+
+			logThrottled(ctx, zap.ErrorLevel, "yiigo: redis queue consume error", zap.String("queue", q.name), zap.Error(err))
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(backoff):
+			}
+
+			if backoff *= 2; backoff > redisPubSubMaxBackoff {
+				backoff = redisPubSubMaxBackoff
+			}
+
+			continue
+		}
+
+		backoff = redisPubSubMinBackoff
+
+		// BRPOPLPUSH timed out
+		if payload == nil {
+			continue
+		}
+
+		// not interrupted by ctx, the job is finished
+		if err := handler(payload); err != nil {
+			CtxLogger(ctx).Error("yiigo: redis queue handler error", zap.String("queue", q.name), zap.Error(err))
+
+			if _, err := queueRetryScript.Do(context.Background(), q.pool, processing, q.name, payload); err != nil {
+				logThrottled(ctx, zap.ErrorLevel, "yiigo: redis queue retry error", zap.String("queue", q.name), zap.Error(err))
+			}
+
+			continue
+		}
+
+		if _, err := q.pool.do(context.Background(), "LREM", keys[1], 1, payload); err != nil {
+			logThrottled(ctx, zap.ErrorLevel, "yiigo: redis queue ack error", zap.String("queue", q.name), zap.Error(err))
+		}
+	}
+
+	return nil
+}
+
+func (q *RedisQueue) pop(ctx context.Context, keys []interface{}, block int64) ([]byte, error) {
+	// the read timeout of connection must cover the block
+	rctx, cancel := context.WithTimeout(ctx, time.Duration(block)*time.Second+q.pool.setting.readTimeout)
+
+	defer cancel()
+
+	payload, err := redis.Bytes(q.pool.do(rctx, "BRPOPLPUSH", keys[0], keys[1], block))
+
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+
+	return payload, err
+}
+
+func (q *RedisQueue) heartbeat(ctx context.Context, consumers, consumer string) error {
+	_, err := q.pool.Do(ctx, "ZADD", consumers, time.Now().UnixNano()/int64(time.Millisecond), consumer)
+
+	return err
+}
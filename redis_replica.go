@@ -0,0 +1,51 @@
+package yiigo
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// redisReplicaDownTime how long a replica is skipped by ReadOnly after failed to dial
+var redisReplicaDownTime = 5 * time.Second
+
+// newRedisReplicaPool returns the pool of a replica, which shares the setting of primary except the replicas.
+func newRedisReplicaPool(name, address string, setting *redisSetting) *RedisPoolResource {
+	s := *setting
+
+	s.replicas = nil
+	s.failoverAddrs = nil
+
+	return newRedisPoolResource(fmt.Sprintf("%s@%s", name, address), address, &s)
+}
+
+// markDown marks the pool down for a while, the replica is skipped by ReadOnly meanwhile.
+func (r *RedisPoolResource) markDown() {
+	atomic.StoreInt64(&r.downUntil, time.Now().Add(redisReplicaDownTime).UnixNano())
+}
+
+func (r *RedisPoolResource) isDown() bool {
+	return time.Now().UnixNano() < atomic.LoadInt64(&r.downUntil)
+}
+
+// ReadOnly returns a replica pool in round-robin for reads, eg: pool.ReadOnly().CacheGet(ctx, key, &v).
+// The replicas failed to dial recently are skipped, the pool itself (primary) is returned when all replicas are down or not specified.
+func (r *RedisPoolResource) ReadOnly() *RedisPoolResource {
+	n := len(r.replicas)
+
+	if n == 0 {
+		return r
+	}
+
+	start := int(atomic.AddUint32(&r.replicaNext, 1))
+
+	for i := 0; i < n; i++ {
+		replica := r.replicas[(start+i)%n]
+
+		if !replica.isDown() && atomic.LoadInt32(&replica.closed) == 0 {
+			return replica
+		}
+	}
+
+	return r
+}
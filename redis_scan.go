@@ -0,0 +1,147 @@
+package yiigo
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+)
+
+// RedisZMember the member of sorted set with score
+type RedisZMember struct {
+	Member string
+	Score  float64
+}
+
+// ScanKeys iterates the keys matching the pattern with SCAN, fn is invoked per batch until the cursor returns to 0.
+// The iteration stops when fn returns an error or ctx is cancelled, the error is returned.
+// The pattern is prefixed by WithRedisKeyPrefix and the prefix is trimmed from the keys passed to fn.
+func ScanKeys(ctx context.Context, pool RedisPool, match string, count int, fn func(keys []string) error) error {
+	prefix := redisPrefix(ctx, pool)
+
+	if prefix != "" && match == "" {
+		match = "*"
+	}
+
+	return redisScan(ctx, pool, "SCAN", nil, prefix+match, count, func(values []interface{}) error {
+		keys, err := redis.Strings(values, nil)
+
+		if err != nil {
+			return err
+		}
+
+		for i, k := range keys {
+			keys[i] = strings.TrimPrefix(k, prefix)
+		}
+
+		return fn(keys)
+	})
+}
+
+// HScan iterates the fields of hash with HSCAN, see ScanKeys for the iteration.
+func HScan(ctx context.Context, pool RedisPool, key, match string, count int, fn func(fields map[string]string) error) error {
+	return redisScan(ctx, pool, "HSCAN", redisPrefixKeys(ctx, pool, 1, []interface{}{key}), match, count, func(values []interface{}) error {
+		fields, err := redis.StringMap(values, nil)
+
+		if err != nil {
+			return err
+		}
+
+		return fn(fields)
+	})
+}
+
+// SScan iterates the members of set with SSCAN, see ScanKeys for the iteration.
+func SScan(ctx context.Context, pool RedisPool, key, match string, count int, fn func(members []string) error) error {
+	return redisScan(ctx, pool, "SSCAN", redisPrefixKeys(ctx, pool, 1, []interface{}{key}), match, count, func(values []interface{}) error {
+		members, err := redis.Strings(values, nil)
+
+		if err != nil {
+			return err
+		}
+
+		return fn(members)
+	})
+}
+
+// ZScan iterates the members of sorted set with ZSCAN, see ScanKeys for the iteration.
+func ZScan(ctx context.Context, pool RedisPool, key, match string, count int, fn func(members []RedisZMember) error) error {
+	return redisScan(ctx, pool, "ZSCAN", redisPrefixKeys(ctx, pool, 1, []interface{}{key}), match, count, func(values []interface{}) error {
+		if len(values)%2 != 0 {
+			return errors.New("yiigo: invalid redis ZSCAN reply")
+		}
+
+		members := make([]RedisZMember, 0, len(values)/2)
+
+		for i := 0; i < len(values); i += 2 {
+			member, err := redis.String(values[i], nil)
+
+			if err != nil {
+				return err
+			}
+
+			score, err := redis.Float64(values[i+1], nil)
+
+			if err != nil {
+				return err
+			}
+
+			members = append(members, RedisZMember{Member: member, Score: score})
+		}
+
+		return fn(members)
+	})
+}
+
+// redisScan drives the cursor of SCAN family commands to completion with one connection.
+// Note: an empty batch does not mean the end, only the cursor 0 does.
+func redisScan(ctx context.Context, pool RedisPool, cmd string, key []interface{}, match string, count int, fn func(values []interface{}) error) (err error) {
+	conn, err := redisGet(ctx, pool)
+
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		pool.Put(conn, err)
+	}()
+
+	cursor := "0"
+
+	for {
+		args := append(redis.Args{}, key...).Add(cursor)
+
+		if match != "" {
+			args = args.Add("MATCH", match)
+		}
+
+		if count > 0 {
+			args = args.Add("COUNT", count)
+		}
+
+		var reply []interface{}
+
+		if reply, err = redis.Values(conn.DoContext(ctx, cmd, args...)); err != nil {
+			return err
+		}
+
+		var values []interface{}
+
+		if _, err = redis.Scan(reply, &cursor, &values); err != nil {
+			return errors.Wrapf(err, "yiigo: invalid redis %s reply", cmd)
+		}
+
+		if err = fn(values); err != nil {
+			return err
+		}
+
+		if cursor == "0" {
+			return nil
+		}
+
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
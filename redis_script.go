@@ -0,0 +1,64 @@
+package yiigo
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// RedisScript redis lua script, safe for concurrent use.
+type RedisScript struct {
+	keyCount int
+	src      string
+	hash     string
+}
+
+// NewRedisScript returns a new lua script, keyCount is the number of the keys in keysAndArgs.
+func NewRedisScript(keyCount int, src string) *RedisScript {
+	h := sha1.New()
+	h.Write([]byte(src))
+
+	return &RedisScript{
+		keyCount: keyCount,
+		src:      src,
+		hash:     hex.EncodeToString(h.Sum(nil)),
+	}
+}
+
+// Hash returns the sha1 of the script.
+func (s *RedisScript) Hash() string {
+	return s.hash
+}
+
+// Do evaluates the script with EVALSHA, the script is loaded by SCRIPT LOAD when the server replies NOSCRIPT
+// (eg: redis is restarted or the script cache is flushed).
+func (s *RedisScript) Do(ctx context.Context, pool RedisPool, keysAndArgs ...interface{}) (reply interface{}, err error) {
+	conn, err := redisGet(ctx, pool)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		pool.Put(conn, err)
+	}()
+
+	args := make([]interface{}, 0, len(keysAndArgs)+2)
+	args = append(args, s.hash, s.keyCount)
+	args = append(args, redisPrefixKeys(ctx, pool, s.keyCount, keysAndArgs)...)
+
+	reply, err = conn.DoContext(ctx, "EVALSHA", args...)
+
+	if e, ok := err.(redis.Error); !ok || !strings.HasPrefix(string(e), "NOSCRIPT") {
+		return reply, err
+	}
+
+	if _, err = conn.DoContext(ctx, "SCRIPT", "LOAD", s.src); err != nil {
+		return nil, err
+	}
+
+	return conn.DoContext(ctx, "EVALSHA", args...)
+}
@@ -0,0 +1,371 @@
+package yiigo
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// streamSetting stream consumer setting
+type streamSetting struct {
+	block         time.Duration
+	count         int
+	claimIdle     time.Duration
+	claimInterval time.Duration
+}
+
+// StreamOption configures how we set up the stream consumer
+type StreamOption interface {
+	apply(*streamSetting)
+}
+
+// funcStreamOption implements stream option
+type funcStreamOption struct {
+	f func(*streamSetting)
+}
+
+func (fo *funcStreamOption) apply(s *streamSetting) {
+	fo.f(s)
+}
+
+func newFuncStreamOption(f func(*streamSetting)) *funcStreamOption {
+	return &funcStreamOption{f: f}
+}
+
+// WithStreamBlock specifies the BLOCK of XREADGROUP, default is 5s.
+func WithStreamBlock(d time.Duration) StreamOption {
+	return newFuncStreamOption(func(s *streamSetting) {
+		s.block = d
+	})
+}
+
+// WithStreamCount specifies the COUNT of XREADGROUP and XAUTOCLAIM, default is 10.
+func WithStreamCount(n int) StreamOption {
+	return newFuncStreamOption(func(s *streamSetting) {
+		s.count = n
+	})
+}
+
+// WithStreamClaimIdle specifies the idle time after which the pending entries are reclaimed, default is 5min.
+func WithStreamClaimIdle(d time.Duration) StreamOption {
+	return newFuncStreamOption(func(s *streamSetting) {
+		s.claimIdle = d
+	})
+}
+
+// WithStreamClaimInterval specifies how often the pending entries are reclaimed by XAUTOCLAIM, default is 1min.
+// A negative value disables the reclaiming.
+func WithStreamClaimInterval(d time.Duration) StreamOption {
+	return newFuncStreamOption(func(s *streamSetting) {
+		s.claimInterval = d
+	})
+}
+
+// StreamStats the counters of stream consumer
+type StreamStats struct {
+	// Processed the entries acked after the handler succeeded
+	Processed int64
+	// Failed the entries which the handler failed, they are left pending and reclaimed later
+	Failed int64
+	// Reclaimed the pending entries claimed by XAUTOCLAIM
+	Reclaimed int64
+}
+
+// StreamConsumer redis stream consumer of a consumer group (redis 6.2+).
+type StreamConsumer struct {
+	// int64 first for the 64-bit alignment of atomic operations
+	processed int64
+	failed    int64
+	reclaimed int64
+
+	pool     RedisPool
+	stream   string
+	group    string
+	consumer string
+	setting  *streamSetting
+}
+
+// NewStreamConsumer returns a new consumer of the stream group, the stream is prefixed by WithRedisKeyPrefix.
+func NewStreamConsumer(pool RedisPool, stream, group, consumer string, options ...StreamOption) *StreamConsumer {
+	setting := &streamSetting{
+		block:         5 * time.Second,
+		count:         10,
+		claimIdle:     5 * time.Minute,
+		claimInterval: time.Minute,
+	}
+
+	for _, option := range options {
+		option.apply(setting)
+	}
+
+	return &StreamConsumer{
+		pool:     pool,
+		stream:   stream,
+		group:    group,
+		consumer: consumer,
+		setting:  setting,
+	}
+}
+
+// Stats returns the counters of the consumer.
+func (c *StreamConsumer) Stats() StreamStats {
+	return StreamStats{
+		Processed: atomic.LoadInt64(&c.processed),
+		Failed:    atomic.LoadInt64(&c.failed),
+		Reclaimed: atomic.LoadInt64(&c.reclaimed),
+	}
+}
+
+// streamEntry an entry of stream, fields is nil when the entry is deleted.
+type streamEntry struct {
+	id     string
+	fields map[string]string
+}
+
+// Run creates the group if missing (MKSTREAM) and dispatches the entries to the handler until ctx is cancelled.
+// The entry is acked when the handler returns nil, otherwise it is left pending and reclaimed after the claim idle.
+// The network errors are retried with backoff, nil is returned when ctx is cancelled.
+func (c *StreamConsumer) Run(ctx context.Context, handler func(id string, fields map[string]string) error) error {
+	stream := redisKey(redisPrefixKeys(ctx, c.pool, 1, []interface{}{c.stream})[0])
+
+	if err := c.createGroup(ctx, stream); err != nil {
+		return err
+	}
+
+	backoff := redisPubSubMinBackoff
+	lastClaim := time.Time{}
+
+	for ctx.Err() == nil {
+		err := c.serve(ctx, stream, handler, &lastClaim)
+
+		if err == nil || ctx.Err() != nil {
+			break
+		}
+
+		if err == ErrRedisClosed {
+			return err
+		}
+
+		if redisErr, ok := err.(redis.Error); ok {
+			if !strings.HasPrefix(string(redisErr), "NOGROUP") {
+				return err
+			}
+
+			// the stream or group is deleted
+			if err = c.createGroup(ctx, stream); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		logThrottled(ctx, zap.ErrorLevel, "yiigo: redis stream consumer error", zap.String("stream", stream), zap.String("group", c.group), zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+
+		if backoff *= 2; backoff > redisPubSubMaxBackoff {
+			backoff = redisPubSubMaxBackoff
+		}
+	}
+
+	return nil
+}
+
+func (c *StreamConsumer) createGroup(ctx context.Context, stream string) error {
+	_, err := redisDo(ctx, c.pool, "XGROUP", "CREATE", stream, c.group, "$", "MKSTREAM")
+
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return errors.Wrap(err, "yiigo: create redis stream group error")
+	}
+
+	return nil
+}
+
+// serve reads the new entries and reclaims the pending entries periodically until ctx is cancelled or an error occurs.
+func (c *StreamConsumer) serve(ctx context.Context, stream string, handler func(id string, fields map[string]string) error, lastClaim *time.Time) error {
+	for ctx.Err() == nil {
+		if c.setting.claimInterval >= 0 && time.Since(*lastClaim) >= c.setting.claimInterval {
+			if err := c.claim(ctx, stream, handler); err != nil {
+				return err
+			}
+
+			*lastClaim = time.Now()
+		}
+
+		entries, err := c.read(ctx, stream)
+
+		if err != nil {
+			return err
+		}
+
+		for _, e := range entries {
+			// the rest are left pending
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			c.handle(stream, e, handler)
+		}
+	}
+
+	return nil
+}
+
+// readTimeout returns the read timeout of the pool, the default one for the pools other than *RedisPoolResource.
+func (c *StreamConsumer) readTimeout() time.Duration {
+	if r, ok := c.pool.(*RedisPoolResource); ok {
+		return r.setting.readTimeout
+	}
+
+	return 10 * time.Second
+}
+
+func (c *StreamConsumer) read(ctx context.Context, stream string) ([]streamEntry, error) {
+	// the read timeout of connection must cover the BLOCK
+	rctx, cancel := context.WithTimeout(ctx, c.setting.block+c.readTimeout())
+
+	defer cancel()
+
+	reply, err := redis.Values(redisDo(rctx, c.pool, "XREADGROUP", "GROUP", c.group, c.consumer,
+		"COUNT", c.setting.count, "BLOCK", int64(c.setting.block/time.Millisecond), "STREAMS", stream, ">"))
+
+	if err != nil {
+		// BLOCK timed out
+		if err == redis.ErrNil {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	// [[stream, entries]]
+	var entries []streamEntry
+
+	for _, v := range reply {
+		values, err := redis.Values(v, nil)
+
+		if err != nil || len(values) != 2 {
+			return nil, errors.New("yiigo: invalid redis XREADGROUP reply")
+		}
+
+		list, err := parseStreamEntries(values[1])
+
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, list...)
+	}
+
+	return entries, nil
+}
+
+// claim transfers the pending entries idle longer than claimIdle to this consumer with XAUTOCLAIM.
+func (c *StreamConsumer) claim(ctx context.Context, stream string, handler func(id string, fields map[string]string) error) error {
+	cursor := "0-0"
+
+	for ctx.Err() == nil {
+		// [cursor, entries, (deleted ids, redis 7+)]
+		reply, err := redis.Values(redisDo(ctx, c.pool, "XAUTOCLAIM", stream, c.group, c.consumer,
+			int64(c.setting.claimIdle/time.Millisecond), cursor, "COUNT", c.setting.count))
+
+		if err != nil {
+			return err
+		}
+
+		if len(reply) < 2 {
+			return errors.New("yiigo: invalid redis XAUTOCLAIM reply")
+		}
+
+		if cursor, err = redis.String(reply[0], nil); err != nil {
+			return errors.Wrap(err, "yiigo: invalid redis XAUTOCLAIM reply")
+		}
+
+		entries, err := parseStreamEntries(reply[1])
+
+		if err != nil {
+			return err
+		}
+
+		atomic.AddInt64(&c.reclaimed, int64(len(entries)))
+
+		for _, e := range entries {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			c.handle(stream, e, handler)
+		}
+
+		if cursor == "0-0" {
+			break
+		}
+	}
+
+	return nil
+}
+
+func (c *StreamConsumer) handle(stream string, e streamEntry, handler func(id string, fields map[string]string) error) {
+	// the deleted entry is acked without handling
+	if e.fields != nil {
+		if err := handler(e.id, e.fields); err != nil {
+			atomic.AddInt64(&c.failed, 1)
+
+			logger().Error("yiigo: redis stream handler error", zap.String("stream", stream), zap.String("id", e.id), zap.Error(err))
+
+			return
+		}
+
+		atomic.AddInt64(&c.processed, 1)
+	}
+
+	// ack even if ctx is cancelled meanwhile, the entry has been handled
+	if _, err := redisDo(context.Background(), c.pool, "XACK", stream, c.group, e.id); err != nil {
+		logThrottled(context.Background(), zap.ErrorLevel, "yiigo: redis stream ack error", zap.String("stream", stream), zap.String("id", e.id), zap.Error(err))
+	}
+}
+
+// parseStreamEntries parses [[id, [field, value, ...]], ...]
+func parseStreamEntries(reply interface{}) ([]streamEntry, error) {
+	values, err := redis.Values(reply, nil)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "yiigo: invalid redis stream entries")
+	}
+
+	entries := make([]streamEntry, 0, len(values))
+
+	for _, v := range values {
+		entry, err := redis.Values(v, nil)
+
+		if err != nil || len(entry) != 2 {
+			return nil, errors.New("yiigo: invalid redis stream entry")
+		}
+
+		id, err := redis.String(entry[0], nil)
+
+		if err != nil {
+			return nil, errors.Wrap(err, "yiigo: invalid redis stream entry")
+		}
+
+		e := streamEntry{id: id}
+
+		if entry[1] != nil {
+			if e.fields, err = redis.StringMap(entry[1], nil); err != nil {
+				return nil, errors.Wrap(err, "yiigo: invalid redis stream entry")
+			}
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
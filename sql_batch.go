@@ -0,0 +1,156 @@
+package yiigo
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// defaultMaxPlaceholders returns the max placeholders of a statement by driver, eg: 65535 of mysql and postgres, 999 of sqlite3 (before 3.32.0)
+func defaultMaxPlaceholders(driver DBDriver) int {
+	if driver == SQLite {
+		return 999
+	}
+
+	return 65535
+}
+
+// SQLBuilderOption configures how we set up the SQL builder
+type SQLBuilderOption interface {
+	apply(*SQLBuilder)
+}
+
+// funcSQLBuilderOption implements SQL builder option
+type funcSQLBuilderOption struct {
+	f func(*SQLBuilder)
+}
+
+func (fo *funcSQLBuilderOption) apply(b *SQLBuilder) {
+	fo.f(b)
+}
+
+func newFuncSQLBuilderOption(f func(*SQLBuilder)) *funcSQLBuilderOption {
+	return &funcSQLBuilderOption{f: f}
+}
+
+// WithMaxPlaceholders specifies the max placeholders of a statement built by InsertBatch,
+// the rows are split into multiple statements above it.
+func WithMaxPlaceholders(n int) SQLBuilderOption {
+	return newFuncSQLBuilderOption(func(b *SQLBuilder) {
+		b.maxPlaceholders = n
+	})
+}
+
+// InsertBatch returns the batch insert statements and binds of rows, eg: INSERT INTO user (name, age) VALUES (?, ?), (?, ?).
+// The rows are split into multiple statements when the placeholders exceed the max (see WithMaxPlaceholders).
+// The placeholders are rebound by the driver, eg: $1, $2 of postgres.
+func (b *SQLBuilder) InsertBatch(table string, columns []string, rows [][]interface{}) ([]string, [][]interface{}) {
+	if len(columns) == 0 || len(rows) == 0 {
+		return nil, nil
+	}
+
+	for _, row := range rows {
+		if len(row) != len(columns) {
+			logger().Error(fmt.Sprintf("yiigo: invalid row for batch insert, expects %d values, got %d", len(columns), len(row)))
+
+			return nil, nil
+		}
+	}
+
+	limit := b.maxPlaceholders
+
+	if limit <= 0 {
+		limit = defaultMaxPlaceholders(b.driver)
+	}
+
+	size := limit / len(columns)
+
+	if size < 1 {
+		size = 1
+	}
+
+	prefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES ", table, strings.Join(columns, ", "))
+	phrs := batchPlaceholders(len(columns))
+
+	queries := make([]string, 0, (len(rows)+size-1)/size)
+	binds := make([][]interface{}, 0, cap(queries))
+
+	for start := 0; start < len(rows); start += size {
+		end := start + size
+
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		values := make([]string, 0, end-start)
+		args := make([]interface{}, 0, (end-start)*len(columns))
+
+		for _, row := range rows[start:end] {
+			values = append(values, phrs)
+			args = append(args, row...)
+		}
+
+		query := sqlx.Rebind(sqlx.BindType(string(b.driver)), prefix+strings.Join(values, ", "))
+
+		if isDebug() {
+			logger().Info(query, zap.Any("binds", args))
+		}
+
+		queries = append(queries, query)
+		binds = append(binds, args)
+	}
+
+	return queries, binds
+}
+
+// InsertBatchStructs is the same as InsertBatch, the columns and rows are taken from data by the `db` tags (the same as ToBatchInsert),
+// the unexported fields are skipped.
+// data expects `[]struct`, `[]*struct`.
+func (b *SQLBuilder) InsertBatchStructs(table string, data interface{}) ([]string, [][]interface{}) {
+	v := reflect.Indirect(reflect.ValueOf(data))
+
+	if v.Kind() != reflect.Slice {
+		logger().Error("yiigo: invalid data type for batch insert, expects []struct, []*struct")
+
+		return nil, nil
+	}
+
+	t := v.Type().Elem()
+
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct {
+		logger().Error("yiigo: invalid data type for batch insert, expects []struct, []*struct")
+
+		return nil, nil
+	}
+
+	fields, columns := batchStructColumns(t)
+
+	rows := make([][]interface{}, 0, v.Len())
+
+	for i := 0; i < v.Len(); i++ {
+		e := reflect.Indirect(v.Index(i))
+
+		if !e.IsValid() {
+			logger().Error("yiigo: invalid data for batch insert, nil element", zap.Int("index", i))
+
+			return nil, nil
+		}
+
+		row := make([]interface{}, 0, len(fields))
+
+		for _, j := range fields {
+			row = append(row, e.Field(j).Interface())
+		}
+
+		rows = append(rows, row)
+	}
+
+	return b.InsertBatch(table, columns, rows)
+}
@@ -0,0 +1,72 @@
+package yiigo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInsertBatch(t *testing.T) {
+	queries, binds := builder.InsertBatch("user", []string{"name", "age"}, [][]interface{}{
+		{"shenghui0779", 29},
+		{"test", 20},
+	})
+
+	assert.Equal(t, []string{"INSERT INTO user (name, age) VALUES (?, ?), (?, ?)"}, queries)
+	assert.Equal(t, [][]interface{}{{"shenghui0779", 29, "test", 20}}, binds)
+
+	// chunked, 2 rows of each statement
+	pgBuilder := NewSQLBuilder(Postgres, WithMaxPlaceholders(5))
+
+	queries, binds = pgBuilder.InsertBatch("user", []string{"name", "age"}, [][]interface{}{
+		{"a", 1},
+		{"b", 2},
+		{"c", 3},
+	})
+
+	assert.Equal(t, []string{
+		"INSERT INTO user (name, age) VALUES ($1, $2), ($3, $4)",
+		"INSERT INTO user (name, age) VALUES ($1, $2)",
+	}, queries)
+	assert.Equal(t, [][]interface{}{{"a", 1, "b", 2}, {"c", 3}}, binds)
+
+	// mismatched row
+	queries, binds = builder.InsertBatch("user", []string{"name", "age"}, [][]interface{}{{"a"}})
+
+	assert.Nil(t, queries)
+	assert.Nil(t, binds)
+
+	queries, _ = builder.InsertBatch("user", []string{"name", "age"}, nil)
+
+	assert.Nil(t, queries)
+}
+
+func TestInsertBatchStructs(t *testing.T) {
+	type User struct {
+		ID     int    `db:"-"`
+		Name   string `db:"name"`
+		Gender string `db:"gender"`
+		Age    int
+		note   string
+	}
+
+	queries, binds := NewSQLBuilder(Postgres, WithMaxPlaceholders(6)).InsertBatchStructs("user", []*User{
+		{Name: "shenghui0779", Gender: "M", Age: 29},
+		{Name: "test", Gender: "W", Age: 20},
+		{Name: "foo", Gender: "M", Age: 18},
+	})
+
+	assert.Equal(t, []string{
+		"INSERT INTO user (name, gender, Age) VALUES ($1, $2, $3), ($4, $5, $6)",
+		"INSERT INTO user (name, gender, Age) VALUES ($1, $2, $3)",
+	}, queries)
+	assert.Equal(t, [][]interface{}{{"shenghui0779", "M", 29, "test", "W", 20}, {"foo", "M", 18}}, binds)
+
+	queries, _ = builder.InsertBatchStructs("user", []User{{Name: "shenghui0779"}})
+
+	assert.Equal(t, []string{"INSERT INTO user (name, gender, Age) VALUES (?, ?, ?)"}, queries)
+
+	queries, _ = builder.InsertBatchStructs("user", []int{1})
+
+	assert.Nil(t, queries)
+}
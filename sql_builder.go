@@ -12,7 +12,8 @@ import (
 
 // SQLBuilder build SQL statement
 type SQLBuilder struct {
-	driver DBDriver
+	driver          DBDriver
+	maxPlaceholders int
 }
 
 // Wrap wrap query clauses
@@ -27,8 +28,14 @@ func (b *SQLBuilder) Wrap(options ...QueryOption) *QueryWrapper {
 }
 
 // NewSQLBuilder returns new SQL builder
-func NewSQLBuilder(driver DBDriver) *SQLBuilder {
-	return &SQLBuilder{driver: driver}
+func NewSQLBuilder(driver DBDriver, options ...SQLBuilderOption) *SQLBuilder {
+	builder := &SQLBuilder{driver: driver}
+
+	for _, option := range options {
+		option.apply(builder)
+	}
+
+	return builder
 }
 
 // SQLClause SQL clause
@@ -117,15 +124,15 @@ func (w *QueryWrapper) ToQuery() (string, []interface{}) {
 	query, binds, err := sqlx.In(strings.Join(clauses, " "), w.binds...)
 
 	if err != nil {
-		logger.Error("yiigo: build 'IN' query error", zap.Error(err))
+		logger().Error("yiigo: build 'IN' query error", zap.Error(err))
 
 		return "", nil
 	}
 
 	query = sqlx.Rebind(sqlx.BindType(string(w.driver)), query)
 
-	if debug {
-		logger.Info(query, zap.Any("binds", binds))
+	if isDebug() {
+		logger().Info(query, zap.Any("binds", binds))
 	}
 
 	return query, binds
@@ -141,7 +148,7 @@ func (w *QueryWrapper) ToInsert(data interface{}) (string, []interface{}) {
 		x, ok := data.(X)
 
 		if !ok {
-			logger.Error("yiigo: invalid data type for insert, expects struct, *struct, yiigo.X")
+			logger().Error("yiigo: invalid data type for insert, expects struct, *struct, yiigo.X")
 
 			return "", nil
 		}
@@ -150,7 +157,7 @@ func (w *QueryWrapper) ToInsert(data interface{}) (string, []interface{}) {
 	case reflect.Struct:
 		w.insertWithStruct(v)
 	default:
-		logger.Error("yiigo: invalid data type for insert, expects struct, *struct, yiigo.X")
+		logger().Error("yiigo: invalid data type for insert, expects struct, *struct, yiigo.X")
 
 		return "", nil
 	}
@@ -165,8 +172,8 @@ func (w *QueryWrapper) ToInsert(data interface{}) (string, []interface{}) {
 
 	query := sqlx.Rebind(sqlx.BindType(string(w.driver)), strings.Join(clauses, " "))
 
-	if debug {
-		logger.Info(query, zap.Any("binds", w.binds))
+	if isDebug() {
+		logger().Info(query, zap.Any("binds", w.binds))
 	}
 
 	return query, w.binds
@@ -230,7 +237,7 @@ func (w *QueryWrapper) ToBatchInsert(data interface{}) (string, []interface{}) {
 			x, ok := data.([]X)
 
 			if !ok {
-				logger.Error("yiigo: invalid data type for batch insert, expects []struct, []*struct, []yiigo.X")
+				logger().Error("yiigo: invalid data type for batch insert, expects []struct, []*struct, []yiigo.X")
 
 				return "", nil
 			}
@@ -240,19 +247,19 @@ func (w *QueryWrapper) ToBatchInsert(data interface{}) (string, []interface{}) {
 			w.batchInsertWithStruct(v)
 		case reflect.Ptr:
 			if e.Elem().Kind() != reflect.Struct {
-				logger.Error("yiigo: invalid data type for batch insert, expects []struct, []*struct, []yiigo.X")
+				logger().Error("yiigo: invalid data type for batch insert, expects []struct, []*struct, []yiigo.X")
 
 				return "", nil
 			}
 
 			w.batchInsertWithStruct(v)
 		default:
-			logger.Error("yiigo: invalid data type for batch insert, expects []struct, []*struct, []yiigo.X")
+			logger().Error("yiigo: invalid data type for batch insert, expects []struct, []*struct, []yiigo.X")
 
 			return "", nil
 		}
 	default:
-		logger.Error("yiigo: invalid data type for batch insert, expects []struct, []*struct, []yiigo.X")
+		logger().Error("yiigo: invalid data type for batch insert, expects []struct, []*struct, []yiigo.X")
 
 		return "", nil
 	}
@@ -261,8 +268,8 @@ func (w *QueryWrapper) ToBatchInsert(data interface{}) (string, []interface{}) {
 
 	query := sqlx.Rebind(sqlx.BindType(string(w.driver)), strings.Join(clauses, " "))
 
-	if debug {
-		logger.Info(query, zap.Any("binds", w.binds))
+	if isDebug() {
+		logger().Info(query, zap.Any("binds", w.binds))
 	}
 
 	return query, w.binds
@@ -280,54 +287,72 @@ func (w *QueryWrapper) batchInsertWithMap(data []X) {
 		w.columns = append(w.columns, k)
 	}
 
-	for _, x := range data {
-		phrs := make([]string, 0, fieldNum)
+	phrs := batchPlaceholders(fieldNum)
 
+	for _, x := range data {
 		for _, v := range w.columns {
-			phrs = append(phrs, "?")
 			w.binds = append(w.binds, x[v])
 		}
 
-		w.values = append(w.values, fmt.Sprintf("(%s)", strings.Join(phrs, ", ")))
+		w.values = append(w.values, phrs)
 	}
 }
 
 func (w *QueryWrapper) batchInsertWithStruct(v reflect.Value) {
-	first := reflect.Indirect(v.Index(0))
+	fields, columns := batchStructColumns(reflect.Indirect(v.Index(0)).Type())
 
 	dataLen := v.Len()
-	fieldNum := first.NumField()
 
-	w.columns = make([]string, 0, fieldNum)
+	w.columns = columns
 	w.values = make([]string, 0, dataLen)
-	w.binds = make([]interface{}, 0, fieldNum*dataLen)
+	w.binds = make([]interface{}, 0, len(fields)*dataLen)
 
-	t := first.Type()
+	phrs := batchPlaceholders(len(fields))
 
 	for i := 0; i < dataLen; i++ {
-		phrs := make([]string, 0, fieldNum)
+		e := reflect.Indirect(v.Index(i))
 
-		for j := 0; j < fieldNum; j++ {
-			column := t.Field(j).Tag.Get("db")
+		for _, j := range fields {
+			w.binds = append(w.binds, e.Field(j).Interface())
+		}
 
-			if column == "-" {
-				continue
-			}
+		w.values = append(w.values, phrs)
+	}
+}
 
-			if i == 0 {
-				if column == "" {
-					column = t.Field(j).Name
-				}
+// batchStructColumns returns the indexes and columns (by the `db` tags) of the fields of t,
+// the ones tagged "-" and the unexported ones are skipped.
+func batchStructColumns(t reflect.Type) ([]int, []string) {
+	fields := make([]int, 0, t.NumField())
+	columns := make([]string, 0, t.NumField())
 
-				w.columns = append(w.columns, column)
-			}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
 
-			phrs = append(phrs, "?")
-			w.binds = append(w.binds, reflect.Indirect(v.Index(i)).Field(j).Interface())
+		if f.PkgPath != "" {
+			continue
+		}
+
+		column := f.Tag.Get("db")
+
+		if column == "-" {
+			continue
 		}
 
-		w.values = append(w.values, fmt.Sprintf("(%s)", strings.Join(phrs, ", ")))
+		if column == "" {
+			column = f.Name
+		}
+
+		fields = append(fields, i)
+		columns = append(columns, column)
 	}
+
+	return fields, columns
+}
+
+// batchPlaceholders returns the placeholders of a row, eg: (?, ?, ?).
+func batchPlaceholders(n int) string {
+	return fmt.Sprintf("(%s)", strings.TrimSuffix(strings.Repeat("?, ", n), ", "))
 }
 
 // ToUpdate returns update statement and binds.
@@ -340,7 +365,7 @@ func (w *QueryWrapper) ToUpdate(data interface{}) (string, []interface{}) {
 		x, ok := data.(X)
 
 		if !ok {
-			logger.Error("yiigo: invalid data type for update, expects struct, *struct, yiigo.X")
+			logger().Error("yiigo: invalid data type for update, expects struct, *struct, yiigo.X")
 
 			return "", nil
 		}
@@ -349,7 +374,7 @@ func (w *QueryWrapper) ToUpdate(data interface{}) (string, []interface{}) {
 	case reflect.Struct:
 		w.updateWithStruct(v)
 	default:
-		logger.Error("yiigo: invalid data type for update, expects struct, *struct, yiigo.X")
+		logger().Error("yiigo: invalid data type for update, expects struct, *struct, yiigo.X")
 
 		return "", nil
 	}
@@ -366,15 +391,15 @@ func (w *QueryWrapper) ToUpdate(data interface{}) (string, []interface{}) {
 	query, binds, err := sqlx.In(strings.Join(clauses, " "), w.binds...)
 
 	if err != nil {
-		logger.Error("yiigo: build 'IN' query error", zap.Error(err))
+		logger().Error("yiigo: build 'IN' query error", zap.Error(err))
 
 		return "", nil
 	}
 
 	query = sqlx.Rebind(sqlx.BindType(string(w.driver)), query)
 
-	if debug {
-		logger.Info(query, zap.Any("binds", binds))
+	if isDebug() {
+		logger().Info(query, zap.Any("binds", binds))
 	}
 
 	return query, binds
@@ -438,15 +463,15 @@ func (w *QueryWrapper) ToDelete() (string, []interface{}) {
 	query, binds, err := sqlx.In(strings.Join(clauses, " "), w.binds...)
 
 	if err != nil {
-		logger.Error("yiigo: build 'IN' query error", zap.Error(err))
+		logger().Error("yiigo: build 'IN' query error", zap.Error(err))
 
 		return "", nil
 	}
 
 	query = sqlx.Rebind(sqlx.BindType(string(w.driver)), query)
 
-	if debug {
-		logger.Info(query, zap.Any("binds", binds))
+	if isDebug() {
+		logger().Info(query, zap.Any("binds", binds))
 	}
 
 	return query, binds